@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/xthexder/go-jack"
+)
+
+// portDirection says whether a MIDI port carries events into or out of the
+// bridge.
+type portDirection int
+
+const (
+	portInput portDirection = iota
+	portOutput
+)
+
+func (d portDirection) String() string {
+	if d == portInput {
+		return "in"
+	}
+	return "out"
+}
+
+// midiBackend is the MIDI system the bridge exchanges events with. The
+// bridge registers its ports and callbacks before Activate; after that the
+// process callback runs once per period of nframes on the backend's
+// real-time thread, where ports are read and written.
+//
+// Events use jack.MidiData whatever the backend: Time is the frame offset
+// within the current period.
+type midiBackend interface {
+	RegisterPort(name string, dir portDirection) (midiPort, error)
+	SetProcessCallback(process func(nframes uint32) int) error
+	SetSampleRateCallback(callback func(rate uint32)) error
+	SampleRate() uint32
+
+	// Frame time at the start of the current period, and frames elapsed
+	// since then; used to map wall-clock times to frames.
+	LastFrameTime() uint32
+	FramesSinceCycleStart() uint32
+
+	// Transport reports the backend's transport at the start of the
+	// current period, or false if the backend has none. It is only called
+	// from the process callback.
+	Transport() (transportPosition, bool)
+
+	// ExternalPorts lists the full names of other clients' MIDI ports
+	// with the given direction: portInput for ports that receive MIDI,
+	// portOutput for ports that send it.
+	ExternalPorts(dir portDirection) ([]string, error)
+
+	// ListPorts describes every MIDI port of the backend, for --list-ports.
+	ListPorts() ([]portInfo, error)
+
+	// Connect routes MIDI from the source port to the destination port,
+	// by full name. It returns errAlreadyConnected if they are connected.
+	Connect(source, destination string) error
+
+	// SetPortRegistrationCallback sets a function called whenever a port
+	// appears. It runs on a backend thread, so it must not block or call
+	// back into the backend.
+	SetPortRegistrationCallback(callback func()) error
+
+	// SetPortDisconnectCallback sets a function called with the full name
+	// of the source port whenever a connection is removed. It runs on a
+	// backend thread, so it must not block or call back into the backend.
+	SetPortDisconnectCallback(callback func(source string)) error
+
+	Activate() error
+
+	// Deactivate stops the process callback: once it returns, the callback
+	// is not running and is not called again.
+	Deactivate() error
+	Close() error
+}
+
+// transportPosition is the state of a backend's transport. The musical
+// position is only set when bbt is true; with JACK that takes a timebase
+// master, such as a DAW.
+type transportPosition struct {
+	rolling bool
+	frame   uint32 // Transport position in frames
+
+	bbt          bool
+	bar, beat    int32 // Both count from 1
+	tick         int32 // Within the beat, 0 up to ticksPerBeat
+	beatsPerBar  float64
+	beatType     float64 // Note value of a beat: 4 for quarter notes
+	ticksPerBeat float64
+	bpm          float64 // Tempo in beats of beatType
+}
+
+var errAlreadyConnected = errors.New("ports are already connected")
+
+// midiPort is a port registered with a midiBackend. Its methods are only
+// called from the process callback.
+type midiPort interface {
+	Name() string // Full name, e.g. client:port
+
+	// ClearBuffer starts a period on an output port; events written after
+	// it are delivered at the end of the period.
+	ClearBuffer(nframes uint32)
+	WriteEvent(event *jack.MidiData) error
+
+	// ReadEvents returns the events received on an input port during the
+	// period, in offset order.
+	ReadEvents(nframes uint32) []*jack.MidiData
+}
+
+// backendOpener connects to a MIDI system as the named client.
+type backendOpener func(clientName string) (midiBackend, error)
+
+// backends are the MIDI systems selectable with --backend
+var backends = map[string]backendOpener{
+	"jack": openJACKBackend,
+	"alsa": openALSABackend,
+}
+
+// lookupBackend returns the opener for a backend name; empty means JACK.
+func lookupBackend(name string) (backendOpener, error) {
+	if name == "" {
+		name = "jack"
+	}
+	open, ok := backends[name]
+	if !ok {
+		names := make([]string, 0, len(backends))
+		for n := range backends {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown MIDI backend %q (expected %s)", name, strings.Join(names, " or "))
+	}
+	return open, nil
+}
@@ -0,0 +1,891 @@
+//go:build linux
+
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/GeoffreyPlitt/debuggo"
+	"github.com/xthexder/go-jack"
+)
+
+var debugALSA = debuggo.Debug("alsa")
+
+// The ALSA sequencer has no periods or sample rate of its own, so the
+// backend runs the process callback from a timer at this nominal rate and
+// period. Each callback covers the frames elapsed since the previous one,
+// giving a constant latency of about one period; events written at an
+// offset within the period are scheduled that long after it on a sequencer
+// queue, so their spacing is kept.
+const (
+	alsaSampleRate = 48000
+	alsaPeriod     = 64 * time.Second / alsaSampleRate
+	alsaSeqDevice  = "/dev/snd/seq"
+)
+
+// Kernel sequencer ABI, from include/uapi/sound/asound_sequencer.h
+const (
+	seqEventSize = 28 // sizeof(struct snd_seq_event)
+
+	seqEventNoteOn      = 6
+	seqEventNoteOff     = 7
+	seqEventKeyPress    = 8
+	seqEventController  = 10
+	seqEventPgmChange   = 11
+	seqEventChanPress   = 12
+	seqEventPitchBend   = 13
+	seqEventSongPos     = 20
+	seqEventSongSel     = 21
+	seqEventQFrame      = 22
+	seqEventStart       = 30
+	seqEventContinue    = 31
+	seqEventStop        = 32
+	seqEventClock       = 36
+	seqEventTuneRequest = 40
+	seqEventReset       = 41
+	seqEventSensing     = 42
+	seqEventPortStart   = 63
+	seqEventPortUnsub   = 67
+	seqEventSysEx       = 130
+
+	seqTimeStampReal = 1 << 0
+	seqTimeModeRel   = 1 << 1
+
+	seqEventLengthVariable = 1 << 2
+	seqEventLengthMask     = 3 << 2
+	seqExtMask             = 0xC0000000
+
+	seqQueueDirect        = 253
+	seqAddressUnknown     = 253
+	seqAddressSubscribers = 254
+
+	seqUserClient = 1
+
+	seqClientSystem    = 0
+	seqPortSystemTimer = 0
+	seqPortAnnounce    = 1
+	seqMaxClients      = 192
+	seqPortCapNoExport = 1 << 7
+
+	seqPortCapRead      = 1 << 0
+	seqPortCapWrite     = 1 << 1
+	seqPortCapSubsRead  = 1 << 5
+	seqPortCapSubsWrite = 1 << 6
+
+	seqPortTypeMIDIGeneric = 1 << 1
+	seqPortTypeHardware    = 1 << 16
+	seqPortTypeSoftware    = 1 << 17
+	seqPortTypeApplication = 1 << 20
+
+	seqQuerySubsRead  = 0
+	seqQuerySubsWrite = 1
+)
+
+// seqAddr mirrors struct snd_seq_addr.
+type seqAddr struct {
+	client uint8
+	port   uint8
+}
+
+// seqClientInfo mirrors struct snd_seq_client_info.
+type seqClientInfo struct {
+	client          int32
+	clientType      int32
+	name            [64]byte
+	filter          uint32
+	multicastFilter [8]byte
+	eventFilter     [32]byte
+	numPorts        int32
+	eventLost       int32
+	card            int32
+	pid             int32
+	midiVersion     uint32
+	groupFilter     uint32
+	reserved        [48]byte
+}
+
+// seqPortInfo mirrors struct snd_seq_port_info.
+type seqPortInfo struct {
+	addr         seqAddr
+	name         [64]byte
+	capability   uint32
+	portType     uint32
+	midiChannels int32
+	midiVoices   int32
+	synthVoices  int32
+	readUse      int32
+	writeUse     int32
+	kernel       uintptr
+	flags        uint32
+	timeQueue    uint8
+	direction    uint8
+	umpGroup     uint8
+	reserved     [57]byte
+}
+
+// seqPortSubscribe mirrors struct snd_seq_port_subscribe.
+type seqPortSubscribe struct {
+	sender   seqAddr
+	dest     seqAddr
+	voices   uint32
+	flags    uint32
+	queue    uint8
+	pad      [3]byte
+	reserved [64]byte
+}
+
+// seqQueueInfo mirrors struct snd_seq_queue_info.
+type seqQueueInfo struct {
+	queue    int32
+	owner    int32
+	locked   uint8 // 1-bit field; name packs after it
+	name     [64]byte
+	flags    uint32
+	reserved [60]byte
+}
+
+// seqQuerySubs mirrors struct snd_seq_query_subs.
+type seqQuerySubs struct {
+	root     seqAddr
+	subsType int32 // seqQuerySubsRead or seqQuerySubsWrite
+	index    int32
+	numSubs  int32
+	addr     seqAddr
+	queue    uint8
+	flags    uint32
+	reserved [64]byte
+}
+
+// seqIoctl builds a sequencer ioctl request number, like _IOC('S', nr, T).
+func seqIoctl(dir, nr, size uintptr) uintptr {
+	return dir<<30 | size<<16 | 'S'<<8 | nr
+}
+
+const (
+	iocWrite = 1
+	iocRead  = 2
+)
+
+var (
+	seqIoctlClientID        = seqIoctl(iocRead, 0x01, unsafe.Sizeof(int32(0)))
+	seqIoctlGetClientInfo   = seqIoctl(iocRead|iocWrite, 0x10, unsafe.Sizeof(seqClientInfo{}))
+	seqIoctlSetClientInfo   = seqIoctl(iocWrite, 0x11, unsafe.Sizeof(seqClientInfo{}))
+	seqIoctlCreatePort      = seqIoctl(iocRead|iocWrite, 0x20, unsafe.Sizeof(seqPortInfo{}))
+	seqIoctlSubscribePort   = seqIoctl(iocWrite, 0x30, unsafe.Sizeof(seqPortSubscribe{}))
+	seqIoctlCreateQueue     = seqIoctl(iocRead|iocWrite, 0x32, unsafe.Sizeof(seqQueueInfo{}))
+	seqIoctlDeleteQueue     = seqIoctl(iocWrite, 0x33, unsafe.Sizeof(seqQueueInfo{}))
+	seqIoctlQuerySubs       = seqIoctl(iocRead|iocWrite, 0x4F, unsafe.Sizeof(seqQuerySubs{}))
+	seqIoctlQueryNextClient = seqIoctl(iocRead|iocWrite, 0x51, unsafe.Sizeof(seqClientInfo{}))
+	seqIoctlQueryNextPort   = seqIoctl(iocRead|iocWrite, 0x52, unsafe.Sizeof(seqPortInfo{}))
+)
+
+// alsaBackend runs the bridge as an ALSA sequencer client, talking to the
+// kernel sequencer directly so no libasound is needed.
+type alsaBackend struct {
+	fd         int
+	client     uint8
+	clientName string
+	queue      int // Schedules events written at an offset; -1 sends them at once
+
+	mu      sync.Mutex // Guards ports against the period goroutine
+	ports   []*alsaPort
+	process func(nframes uint32) int
+
+	announce   *seqAddr // Port receiving System:Announce events, if any
+	registered func()   // Called when another client's port appears
+	disconnect func(source string)
+
+	start      time.Time
+	cycleFrame atomic.Uint32 // Frame time at the start of the current period
+	nextFrame  uint32        // Start of the next period; period goroutine only
+	readBuf    []byte
+	writeBuf   []byte
+	done       chan struct{}
+	stopped    chan struct{}
+}
+
+// openALSABackend creates a sequencer client with the given name.
+func openALSABackend(clientName string) (midiBackend, error) {
+	fd, err := syscall.Open(alsaSeqDevice, syscall.O_RDWR|syscall.O_NONBLOCK|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open ALSA sequencer %s: %w", alsaSeqDevice, err)
+	}
+	a := &alsaBackend{
+		fd:         fd,
+		clientName: clientName,
+		queue:      -1,
+		readBuf:    make([]byte, 64*1024),
+		writeBuf:   make([]byte, 0, 64*1024),
+	}
+
+	var id int32
+	if err := a.ioctl(seqIoctlClientID, unsafe.Pointer(&id)); err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("cannot get ALSA client id: %w", err)
+	}
+	a.client = uint8(id)
+
+	info := seqClientInfo{client: id}
+	if err := a.ioctl(seqIoctlGetClientInfo, unsafe.Pointer(&info)); err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("cannot get ALSA client info: %w", err)
+	}
+	info.clientType = seqUserClient
+	info.name = [64]byte{}
+	copy(info.name[:len(info.name)-1], clientName)
+	if err := a.ioctl(seqIoctlSetClientInfo, unsafe.Pointer(&info)); err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("cannot set ALSA client name: %w", err)
+	}
+
+	debugALSA("Opened ALSA sequencer client %d (%s)", a.client, clientName)
+	return a, nil
+}
+
+func (a *alsaBackend) ioctl(request uintptr, arg unsafe.Pointer) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(a.fd), request, uintptr(arg)); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func (a *alsaBackend) RegisterPort(name string, dir portDirection) (midiPort, error) {
+	info := seqPortInfo{
+		addr:         seqAddr{client: a.client},
+		portType:     seqPortTypeMIDIGeneric | seqPortTypeSoftware | seqPortTypeApplication,
+		midiChannels: 16,
+	}
+	copy(info.name[:len(info.name)-1], name)
+	if dir == portOutput {
+		info.capability = seqPortCapRead | seqPortCapSubsRead
+	} else {
+		info.capability = seqPortCapWrite | seqPortCapSubsWrite
+	}
+	if err := a.ioctl(seqIoctlCreatePort, unsafe.Pointer(&info)); err != nil {
+		return nil, fmt.Errorf("failed to create ALSA %s port %s: %w", dir, name, err)
+	}
+
+	port := &alsaPort{backend: a, name: name, dir: dir, addr: info.addr}
+	a.mu.Lock()
+	a.ports = append(a.ports, port)
+	a.mu.Unlock()
+	return port, nil
+}
+
+// subscribe connects a sender port to a destination port.
+func (a *alsaBackend) subscribe(sender, dest seqAddr) error {
+	sub := seqPortSubscribe{sender: sender, dest: dest}
+	if err := a.ioctl(seqIoctlSubscribePort, unsafe.Pointer(&sub)); err != nil {
+		return fmt.Errorf("cannot connect ALSA port %d:%d to %d:%d: %w", sender.client, sender.port, dest.client, dest.port, err)
+	}
+	return nil
+}
+
+// seqPort is a sequencer port found by listPorts.
+type seqPort struct {
+	name     string // client:port
+	client   string
+	addr     seqAddr
+	caps     uint32
+	portType uint32
+}
+
+// listPorts returns every exported port of every sequencer client.
+func (a *alsaBackend) listPorts() []seqPort {
+	var ports []seqPort
+	client := seqClientInfo{client: -1}
+	for a.ioctl(seqIoctlQueryNextClient, unsafe.Pointer(&client)) == nil {
+		port := seqPortInfo{addr: seqAddr{client: uint8(client.client), port: 255}}
+		for a.ioctl(seqIoctlQueryNextPort, unsafe.Pointer(&port)) == nil {
+			if port.capability&seqPortCapNoExport == 0 {
+				ports = append(ports, seqPort{
+					name:     cString(client.name[:]) + ":" + cString(port.name[:]),
+					client:   cString(client.name[:]),
+					addr:     port.addr,
+					caps:     port.capability,
+					portType: port.portType,
+				})
+			}
+		}
+		if client.client >= seqMaxClients-1 {
+			break
+		}
+	}
+	return ports
+}
+
+// cString converts a NUL-terminated C string buffer.
+func cString(b []byte) string {
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i])
+		}
+	}
+	return string(b)
+}
+
+func (a *alsaBackend) ExternalPorts(dir portDirection) ([]string, error) {
+	ports := a.listPorts()
+	want := uint32(seqPortCapWrite | seqPortCapSubsWrite)
+	if dir == portOutput {
+		want = seqPortCapRead | seqPortCapSubsRead
+	}
+	var names []string
+	for _, port := range ports {
+		if port.addr.client != a.client && port.addr.client != seqClientSystem && port.caps&want == want {
+			names = append(names, port.name)
+		}
+	}
+	return names, nil
+}
+
+// ListPorts describes the sequencer's MIDI ports. A port that both sends
+// and receives is listed once for each direction; ports of kernel drivers
+// for hardware are physical. ALSA ports have no aliases.
+func (a *alsaBackend) ListPorts() ([]portInfo, error) {
+	ports := a.listPorts()
+	names := make(map[seqAddr]string, len(ports))
+	for _, port := range ports {
+		names[port.addr] = port.name
+	}
+
+	var infos []portInfo
+	for _, port := range ports {
+		if port.addr.client == seqClientSystem {
+			continue // Timer and announcements, not MIDI
+		}
+		portType := "virtual"
+		if port.portType&seqPortTypeHardware != 0 {
+			portType = "physical"
+		}
+		for _, dir := range []portDirection{portOutput, portInput} {
+			caps, subsType := uint32(seqPortCapRead|seqPortCapSubsRead), int32(seqQuerySubsRead)
+			if dir == portInput {
+				caps, subsType = seqPortCapWrite|seqPortCapSubsWrite, seqQuerySubsWrite
+			}
+			if port.caps&caps != caps {
+				continue
+			}
+			infos = append(infos, portInfo{
+				Name:        port.name,
+				Client:      port.client,
+				Direction:   dir.String(),
+				Type:        portType,
+				Connections: a.connections(port.addr, subsType, names),
+			})
+		}
+	}
+	return infos, nil
+}
+
+// connections returns the names of the ports subscribed to a port: those
+// it sends to for seqQuerySubsRead, those it receives from for
+// seqQuerySubsWrite.
+func (a *alsaBackend) connections(addr seqAddr, subsType int32, names map[seqAddr]string) []string {
+	var connected []string
+	query := seqQuerySubs{root: addr, subsType: subsType}
+	for ; a.ioctl(seqIoctlQuerySubs, unsafe.Pointer(&query)) == nil; query.index++ {
+		name, ok := names[query.addr]
+		if !ok {
+			name = fmt.Sprintf("%d:%d", query.addr.client, query.addr.port)
+		}
+		connected = append(connected, name)
+		if query.index+1 >= query.numSubs {
+			break
+		}
+	}
+	return connected
+}
+
+func (a *alsaBackend) Connect(source, destination string) error {
+	ports := a.listPorts()
+	find := func(name string) (seqAddr, error) {
+		for _, port := range ports {
+			if port.name == name {
+				return port.addr, nil
+			}
+		}
+		return seqAddr{}, fmt.Errorf("no ALSA port named %s", name)
+	}
+	sender, err := find(source)
+	if err != nil {
+		return err
+	}
+	dest, err := find(destination)
+	if err != nil {
+		return err
+	}
+
+	err = a.subscribe(sender, dest)
+	if errors.Is(err, syscall.EBUSY) {
+		return errAlreadyConnected
+	}
+	return err
+}
+
+// SetPortRegistrationCallback subscribes a private port to System:Announce,
+// whose port start events are passed on from the period goroutine.
+func (a *alsaBackend) SetPortRegistrationCallback(callback func()) error {
+	if err := a.listenAnnounce(); err != nil {
+		return err
+	}
+	a.registered = callback
+	return nil
+}
+
+// SetPortDisconnectCallback passes on the unsubscribe events of
+// System:Announce, like SetPortRegistrationCallback.
+func (a *alsaBackend) SetPortDisconnectCallback(callback func(source string)) error {
+	if err := a.listenAnnounce(); err != nil {
+		return err
+	}
+	a.disconnect = callback
+	return nil
+}
+
+// listenAnnounce creates the private port subscribed to System:Announce,
+// once.
+func (a *alsaBackend) listenAnnounce() error {
+	if a.announce != nil {
+		return nil
+	}
+	info := seqPortInfo{
+		addr:       seqAddr{client: a.client},
+		capability: seqPortCapWrite | seqPortCapNoExport,
+		portType:   seqPortTypeApplication,
+	}
+	copy(info.name[:], "announce")
+	if err := a.ioctl(seqIoctlCreatePort, unsafe.Pointer(&info)); err != nil {
+		return fmt.Errorf("failed to create ALSA announce port: %w", err)
+	}
+	if err := a.subscribe(seqAddr{seqClientSystem, seqPortAnnounce}, info.addr); err != nil {
+		return err
+	}
+	a.announce = &info.addr
+	return nil
+}
+
+func (a *alsaBackend) SetProcessCallback(process func(nframes uint32) int) error {
+	a.process = process
+	return nil
+}
+
+// SetSampleRateCallback accepts the callback, which is never called: the
+// nominal sample rate is fixed.
+func (a *alsaBackend) SetSampleRateCallback(callback func(rate uint32)) error {
+	return nil
+}
+
+func (a *alsaBackend) SampleRate() uint32 {
+	return alsaSampleRate
+}
+
+func (a *alsaBackend) LastFrameTime() uint32 {
+	return a.cycleFrame.Load()
+}
+
+func (a *alsaBackend) FramesSinceCycleStart() uint32 {
+	return a.frameAt(time.Now()) - a.cycleFrame.Load()
+}
+
+// Transport reports no transport: the sequencer has queues, but no shared
+// song position for clients to follow.
+func (a *alsaBackend) Transport() (transportPosition, bool) {
+	return transportPosition{}, false
+}
+
+// frameAt converts a wall-clock time to the backend's nominal frame time.
+func (a *alsaBackend) frameAt(t time.Time) uint32 {
+	return uint32(uint64(t.Sub(a.start).Seconds() * alsaSampleRate))
+}
+
+func (a *alsaBackend) Activate() error {
+	if a.process == nil {
+		return errors.New("failed to activate ALSA client: no process callback")
+	}
+	if a.done != nil {
+		return errors.New("ALSA client already active")
+	}
+	if a.queue < 0 {
+		if err := a.startQueue(); err != nil {
+			debugALSA("No sequencer queue, events go out at the end of the period: %v", err)
+		}
+	}
+	a.start = time.Now()
+	a.done = make(chan struct{})
+	a.stopped = make(chan struct{})
+	go a.run()
+	return nil
+}
+
+func (a *alsaBackend) Deactivate() error {
+	if a.done != nil {
+		close(a.done)
+		<-a.stopped
+		a.done = nil
+	}
+	return nil
+}
+
+func (a *alsaBackend) Close() error {
+	a.Deactivate()
+	if a.queue >= 0 {
+		// Closing the client drops events still scheduled in the last period
+		time.Sleep(alsaPeriod)
+		info := seqQueueInfo{queue: int32(a.queue)}
+		a.ioctl(seqIoctlDeleteQueue, unsafe.Pointer(&info))
+		a.queue = -1
+	}
+	if err := syscall.Close(a.fd); err != nil {
+		return fmt.Errorf("failed to close ALSA client: %w", err)
+	}
+	return nil
+}
+
+// startQueue creates and starts the sequencer queue that schedules events
+// written at an offset within the period.
+func (a *alsaBackend) startQueue() error {
+	info := seqQueueInfo{owner: int32(a.client)}
+	copy(info.name[:len(info.name)-1], a.clientName)
+	if err := a.ioctl(seqIoctlCreateQueue, unsafe.Pointer(&info)); err != nil {
+		return fmt.Errorf("cannot create queue: %w", err)
+	}
+
+	// Queues are started by the system timer port
+	var event [seqEventSize]byte
+	event[0] = seqEventStart
+	event[3] = seqQueueDirect
+	event[12], event[13] = a.client, seqAddressUnknown
+	event[14], event[15] = seqClientSystem, seqPortSystemTimer
+	event[16] = uint8(info.queue)
+	if _, err := syscall.Write(a.fd, event[:]); err != nil {
+		a.ioctl(seqIoctlDeleteQueue, unsafe.Pointer(&info))
+		return fmt.Errorf("cannot start queue: %w", err)
+	}
+	a.queue = int(info.queue)
+	return nil
+}
+
+// run calls the process callback once per period until Deactivate.
+func (a *alsaBackend) run() {
+	defer close(a.stopped)
+
+	ticker := time.NewTicker(alsaPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-a.done:
+			return
+		case now := <-ticker.C:
+			a.cycle(now)
+		}
+	}
+}
+
+// cycle runs one period covering the frames since the previous one: it
+// collects incoming events, calls the process callback, then sends
+// everything written to the output ports.
+func (a *alsaBackend) cycle(now time.Time) {
+	frame := a.frameAt(now)
+	nframes := frame - a.nextFrame
+	if nframes == 0 {
+		return
+	}
+	a.cycleFrame.Store(a.nextFrame)
+	a.nextFrame = frame
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.readEvents()
+	a.process(nframes)
+
+	a.writeBuf = a.writeBuf[:0]
+	for _, port := range a.ports {
+		a.writeBuf = append(a.writeBuf, port.out...)
+		port.out = port.out[:0]
+		port.in = port.in[:0]
+	}
+	if len(a.writeBuf) > 0 {
+		if _, err := syscall.Write(a.fd, a.writeBuf); err != nil {
+			debugALSA("Failed to send MIDI events: %v", err)
+		}
+	}
+}
+
+// readEvents reads all pending sequencer events into the input ports.
+func (a *alsaBackend) readEvents() {
+	for {
+		n, err := syscall.Read(a.fd, a.readBuf)
+		if err != nil || n <= 0 {
+			if err != nil && err != syscall.EAGAIN {
+				debugALSA("Failed to read MIDI events: %v", err)
+			}
+			return
+		}
+
+		buf := a.readBuf[:n]
+		for len(buf) >= seqEventSize {
+			event := buf[:seqEventSize]
+			size := seqEventSize
+			var ext []byte
+			if event[1]&seqEventLengthMask == seqEventLengthVariable {
+				extLen := int(binary.NativeEndian.Uint32(event[16:]) &^ seqExtMask)
+				if size+extLen > len(buf) {
+					break
+				}
+				ext = buf[size : size+extLen]
+				size += extLen
+			}
+
+			if a.announce != nil && event[15] == a.announce.port {
+				switch {
+				case event[0] == seqEventPortStart && a.registered != nil:
+					a.registered()
+				case event[0] == seqEventPortUnsub && a.disconnect != nil:
+					a.unsubscribed(event)
+				}
+			} else {
+				for _, port := range a.ports {
+					if port.dir == portInput && port.addr.port == event[15] {
+						port.receive(event, ext)
+					}
+				}
+			}
+			buf = buf[size:]
+		}
+	}
+}
+
+// unsubscribed reports a removed connection from one of the client's ports;
+// the event data holds the sender and destination addresses.
+func (a *alsaBackend) unsubscribed(event []byte) {
+	sender := seqAddr{client: event[16], port: event[17]}
+	if sender.client != a.client {
+		return
+	}
+	for _, port := range a.ports {
+		if port.addr == sender {
+			a.disconnect(port.Name())
+		}
+	}
+}
+
+// alsaPort is a sequencer port of an alsaBackend.
+type alsaPort struct {
+	backend *alsaBackend
+	name    string
+	dir     portDirection
+	addr    seqAddr
+	in      []*jack.MidiData // Events received this period
+	out     []byte           // Encoded events written this period
+	sysex   []byte           // Incoming SysEx split across events
+}
+
+func (p *alsaPort) Name() string {
+	return p.backend.clientName + ":" + p.name
+}
+
+func (p *alsaPort) ClearBuffer(nframes uint32) {
+	p.out = p.out[:0]
+}
+
+// WriteEvent queues an event to be sent to the port's subscribers at the
+// end of the period, delayed by its offset within the period if the
+// backend has a sequencer queue.
+func (p *alsaPort) WriteEvent(event *jack.MidiData) error {
+	var header [seqEventSize]byte
+	ext, ok := encodeSeqEvent(header[:], event.Buffer)
+	if !ok {
+		return fmt.Errorf("cannot send % X to the ALSA sequencer", event.Buffer)
+	}
+	header[3] = seqQueueDirect
+	if event.Time > 0 && p.backend.queue >= 0 {
+		delay := time.Duration(event.Time) * time.Second / alsaSampleRate
+		header[1] |= seqTimeStampReal | seqTimeModeRel
+		header[3] = uint8(p.backend.queue)
+		binary.NativeEndian.PutUint32(header[4:], uint32(delay/time.Second))
+		binary.NativeEndian.PutUint32(header[8:], uint32(delay%time.Second))
+	}
+	header[12], header[13] = p.addr.client, p.addr.port
+	header[14], header[15] = seqAddressSubscribers, seqAddressUnknown
+	p.out = append(p.out, header[:]...)
+	p.out = append(p.out, ext...)
+	return nil
+}
+
+func (p *alsaPort) ReadEvents(nframes uint32) []*jack.MidiData {
+	return p.in
+}
+
+// receive decodes one sequencer event addressed to the port, reassembling
+// SysEx messages the sequencer delivers in chunks.
+func (p *alsaPort) receive(event, ext []byte) {
+	if event[0] == seqEventSysEx {
+		if len(ext) > 0 && ext[0] == 0xF0 {
+			p.sysex = p.sysex[:0]
+		}
+		p.sysex = append(p.sysex, ext...)
+		if len(p.sysex) == 0 || p.sysex[len(p.sysex)-1] != 0xF7 {
+			return // Wait for the rest
+		}
+		ext = p.sysex
+	}
+
+	if data := decodeSeqEvent(event, ext); data != nil {
+		p.in = append(p.in, &jack.MidiData{Buffer: data})
+	}
+	if event[0] == seqEventSysEx {
+		p.sysex = p.sysex[:0]
+	}
+}
+
+// encodeSeqEvent fills in the type and data of a sequencer event from a
+// complete MIDI message; variable-length data to append after the event is
+// returned separately. It reports false for messages the sequencer has no
+// event type for.
+func encodeSeqEvent(event []byte, data []byte) ([]byte, bool) {
+	if len(data) == 0 {
+		return nil, false
+	}
+	status := data[0]
+	note := func(eventType byte) ([]byte, bool) {
+		if len(data) < 3 {
+			return nil, false
+		}
+		event[0] = eventType
+		event[16], event[17], event[18] = status&0x0F, data[1], data[2]
+		return nil, true
+	}
+	control := func(eventType byte, channel byte, param uint32, value int32) ([]byte, bool) {
+		event[0] = eventType
+		event[16] = channel
+		binary.NativeEndian.PutUint32(event[20:], param)
+		binary.NativeEndian.PutUint32(event[24:], uint32(value))
+		return nil, true
+	}
+	simple := func(eventType byte) ([]byte, bool) {
+		event[0] = eventType
+		return nil, true
+	}
+
+	switch {
+	case status == 0xF0:
+		event[0] = seqEventSysEx
+		event[1] = seqEventLengthVariable
+		binary.NativeEndian.PutUint32(event[16:], uint32(len(data)))
+		return data, true
+	case status >= 0xF0:
+		switch status {
+		case 0xF1, 0xF3:
+			if len(data) < 2 {
+				return nil, false
+			}
+			eventType := byte(seqEventQFrame)
+			if status == 0xF3 {
+				eventType = seqEventSongSel
+			}
+			return control(eventType, 0, 0, int32(data[1]))
+		case 0xF2:
+			if len(data) < 3 {
+				return nil, false
+			}
+			return control(seqEventSongPos, 0, 0, int32(data[1])|int32(data[2])<<7)
+		case 0xF6:
+			return simple(seqEventTuneRequest)
+		case 0xF8:
+			return simple(seqEventClock)
+		case 0xFA:
+			return simple(seqEventStart)
+		case 0xFB:
+			return simple(seqEventContinue)
+		case 0xFC:
+			return simple(seqEventStop)
+		case 0xFE:
+			return simple(seqEventSensing)
+		case 0xFF:
+			return simple(seqEventReset)
+		}
+		return nil, false
+	}
+
+	channel := status & 0x0F
+	switch status & 0xF0 {
+	case 0x80:
+		return note(seqEventNoteOff)
+	case 0x90:
+		return note(seqEventNoteOn)
+	case 0xA0:
+		return note(seqEventKeyPress)
+	}
+
+	if len(data) < channelMessageLength(status&0xF0) {
+		return nil, false
+	}
+	switch status & 0xF0 {
+	case 0xB0:
+		return control(seqEventController, channel, uint32(data[1]), int32(data[2]))
+	case 0xC0:
+		return control(seqEventPgmChange, channel, 0, int32(data[1]))
+	case 0xD0:
+		return control(seqEventChanPress, channel, 0, int32(data[1]))
+	default: // 0xE0, Pitch Bend
+		return control(seqEventPitchBend, channel, 0, (int32(data[1])|int32(data[2])<<7)-pitchBendCenter)
+	}
+}
+
+// decodeSeqEvent converts a sequencer event back to a MIDI message, or nil
+// for event types that have no MIDI equivalent.
+func decodeSeqEvent(event []byte, ext []byte) []byte {
+	channel := event[16] & 0x0F
+	param := byte(binary.NativeEndian.Uint32(event[20:]) & 0x7F)
+	value := int32(binary.NativeEndian.Uint32(event[24:]))
+
+	switch event[0] {
+	case seqEventNoteOn:
+		return []byte{0x90 | channel, event[17] & 0x7F, event[18] & 0x7F}
+	case seqEventNoteOff:
+		return []byte{0x80 | channel, event[17] & 0x7F, event[18] & 0x7F}
+	case seqEventKeyPress:
+		return []byte{0xA0 | channel, event[17] & 0x7F, event[18] & 0x7F}
+	case seqEventController:
+		return []byte{0xB0 | channel, param, byte(value & 0x7F)}
+	case seqEventPgmChange:
+		return []byte{0xC0 | channel, byte(value & 0x7F)}
+	case seqEventChanPress:
+		return []byte{0xD0 | channel, byte(value & 0x7F)}
+	case seqEventPitchBend:
+		bend := value + pitchBendCenter
+		return []byte{0xE0 | channel, byte(bend & 0x7F), byte(bend >> 7 & 0x7F)}
+	case seqEventSongPos:
+		return []byte{0xF2, byte(value & 0x7F), byte(value >> 7 & 0x7F)}
+	case seqEventSongSel:
+		return []byte{0xF3, byte(value & 0x7F)}
+	case seqEventQFrame:
+		return []byte{0xF1, byte(value & 0x7F)}
+	case seqEventTuneRequest:
+		return []byte{0xF6}
+	case seqEventClock:
+		return []byte{0xF8}
+	case seqEventStart:
+		return []byte{0xFA}
+	case seqEventContinue:
+		return []byte{0xFB}
+	case seqEventStop:
+		return []byte{0xFC}
+	case seqEventSensing:
+		return []byte{0xFE}
+	case seqEventReset:
+		return []byte{0xFF}
+	case seqEventSysEx:
+		return append([]byte(nil), ext...)
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+//go:build linux && cgo && alsa_abi
+
+package main
+
+/*
+#include <stddef.h>
+#include <sys/ioctl.h>
+#include <sound/asequencer.h>
+
+enum {
+	seq_event_size          = sizeof(struct snd_seq_event),
+	seq_event_type          = offsetof(struct snd_seq_event, type),
+	seq_event_flags         = offsetof(struct snd_seq_event, flags),
+	seq_event_queue         = offsetof(struct snd_seq_event, queue),
+	seq_event_time_sec      = offsetof(struct snd_seq_event, time.time.tv_sec),
+	seq_event_time_nsec     = offsetof(struct snd_seq_event, time.time.tv_nsec),
+	seq_event_source        = offsetof(struct snd_seq_event, source),
+	seq_event_dest          = offsetof(struct snd_seq_event, dest),
+	seq_event_note_channel  = offsetof(struct snd_seq_event, data.note.channel),
+	seq_event_note_note     = offsetof(struct snd_seq_event, data.note.note),
+	seq_event_note_velocity = offsetof(struct snd_seq_event, data.note.velocity),
+	seq_event_control_param = offsetof(struct snd_seq_event, data.control.param),
+	seq_event_control_value = offsetof(struct snd_seq_event, data.control.value),
+	seq_event_ext_len       = offsetof(struct snd_seq_event, data.ext.len),
+	seq_event_ext_ptr       = offsetof(struct snd_seq_event, data.ext.ptr),
+	seq_event_queue_queue   = offsetof(struct snd_seq_event, data.queue.queue),
+	seq_event_connect_dest  = offsetof(struct snd_seq_event, data.connect.dest),
+
+	seq_client_info_name      = offsetof(struct snd_seq_client_info, name),
+	seq_client_info_filter    = offsetof(struct snd_seq_client_info, filter),
+	seq_client_info_num_ports = offsetof(struct snd_seq_client_info, num_ports),
+	seq_client_info_pid       = offsetof(struct snd_seq_client_info, pid),
+
+	seq_port_info_name       = offsetof(struct snd_seq_port_info, name),
+	seq_port_info_capability = offsetof(struct snd_seq_port_info, capability),
+	seq_port_info_type       = offsetof(struct snd_seq_port_info, type),
+	seq_port_info_kernel     = offsetof(struct snd_seq_port_info, kernel),
+	seq_port_info_flags      = offsetof(struct snd_seq_port_info, flags),
+	seq_port_info_time_queue = offsetof(struct snd_seq_port_info, time_queue),
+
+	seq_port_subscribe_dest  = offsetof(struct snd_seq_port_subscribe, dest),
+	seq_port_subscribe_flags = offsetof(struct snd_seq_port_subscribe, flags),
+	seq_port_subscribe_queue = offsetof(struct snd_seq_port_subscribe, queue),
+
+	seq_queue_info_owner = offsetof(struct snd_seq_queue_info, owner),
+	seq_queue_info_name  = offsetof(struct snd_seq_queue_info, name),
+	seq_queue_info_flags = offsetof(struct snd_seq_queue_info, flags),
+
+	seq_query_subs_type     = offsetof(struct snd_seq_query_subs, type),
+	seq_query_subs_num_subs = offsetof(struct snd_seq_query_subs, num_subs),
+	seq_query_subs_addr     = offsetof(struct snd_seq_query_subs, addr),
+	seq_query_subs_flags    = offsetof(struct snd_seq_query_subs, flags),
+};
+
+static unsigned long seq_ioctl_client_id(void) { return SNDRV_SEQ_IOCTL_CLIENT_ID; }
+static unsigned long seq_ioctl_get_client_info(void) { return SNDRV_SEQ_IOCTL_GET_CLIENT_INFO; }
+static unsigned long seq_ioctl_set_client_info(void) { return SNDRV_SEQ_IOCTL_SET_CLIENT_INFO; }
+static unsigned long seq_ioctl_create_port(void) { return SNDRV_SEQ_IOCTL_CREATE_PORT; }
+static unsigned long seq_ioctl_subscribe_port(void) { return SNDRV_SEQ_IOCTL_SUBSCRIBE_PORT; }
+static unsigned long seq_ioctl_create_queue(void) { return SNDRV_SEQ_IOCTL_CREATE_QUEUE; }
+static unsigned long seq_ioctl_delete_queue(void) { return SNDRV_SEQ_IOCTL_DELETE_QUEUE; }
+static unsigned long seq_ioctl_query_subs(void) { return SNDRV_SEQ_IOCTL_QUERY_SUBS; }
+static unsigned long seq_ioctl_query_next_client(void) { return SNDRV_SEQ_IOCTL_QUERY_NEXT_CLIENT; }
+static unsigned long seq_ioctl_query_next_port(void) { return SNDRV_SEQ_IOCTL_QUERY_NEXT_PORT; }
+*/
+import "C"
+
+// seqHeaderABI reports the sizes, field offsets and ioctl numbers of the
+// kernel sequencer ABI as compiled from <sound/asequencer.h>, so the tests
+// can check the hand-written mirrors in backend_alsa.go against them.
+// Fields added with MIDI 2.0 support are left out, as older headers do
+// not have them.
+func seqHeaderABI() map[string]uintptr {
+	return map[string]uintptr{
+		"sizeof(snd_seq_event)":          C.sizeof_struct_snd_seq_event,
+		"sizeof(snd_seq_client_info)":    C.sizeof_struct_snd_seq_client_info,
+		"sizeof(snd_seq_port_info)":      C.sizeof_struct_snd_seq_port_info,
+		"sizeof(snd_seq_port_subscribe)": C.sizeof_struct_snd_seq_port_subscribe,
+		"sizeof(snd_seq_queue_info)":     C.sizeof_struct_snd_seq_queue_info,
+		"sizeof(snd_seq_query_subs)":     C.sizeof_struct_snd_seq_query_subs,
+
+		"snd_seq_event.type":               C.seq_event_type,
+		"snd_seq_event.flags":              C.seq_event_flags,
+		"snd_seq_event.queue":              C.seq_event_queue,
+		"snd_seq_event.time.time.tv_sec":   C.seq_event_time_sec,
+		"snd_seq_event.time.time.tv_nsec":  C.seq_event_time_nsec,
+		"snd_seq_event.source":             C.seq_event_source,
+		"snd_seq_event.dest":               C.seq_event_dest,
+		"snd_seq_event.data.note.channel":  C.seq_event_note_channel,
+		"snd_seq_event.data.note.note":     C.seq_event_note_note,
+		"snd_seq_event.data.note.velocity": C.seq_event_note_velocity,
+		"snd_seq_event.data.control.param": C.seq_event_control_param,
+		"snd_seq_event.data.control.value": C.seq_event_control_value,
+		"snd_seq_event.data.ext.len":       C.seq_event_ext_len,
+		"snd_seq_event.data.ext.ptr":       C.seq_event_ext_ptr,
+		"snd_seq_event.data.queue.queue":   C.seq_event_queue_queue,
+		"snd_seq_event.data.connect.dest":  C.seq_event_connect_dest,
+
+		"snd_seq_client_info.name":      C.seq_client_info_name,
+		"snd_seq_client_info.filter":    C.seq_client_info_filter,
+		"snd_seq_client_info.num_ports": C.seq_client_info_num_ports,
+		"snd_seq_client_info.pid":       C.seq_client_info_pid,
+
+		"snd_seq_port_info.name":       C.seq_port_info_name,
+		"snd_seq_port_info.capability": C.seq_port_info_capability,
+		"snd_seq_port_info.type":       C.seq_port_info_type,
+		"snd_seq_port_info.kernel":     C.seq_port_info_kernel,
+		"snd_seq_port_info.flags":      C.seq_port_info_flags,
+		"snd_seq_port_info.time_queue": C.seq_port_info_time_queue,
+
+		"snd_seq_port_subscribe.dest":  C.seq_port_subscribe_dest,
+		"snd_seq_port_subscribe.flags": C.seq_port_subscribe_flags,
+		"snd_seq_port_subscribe.queue": C.seq_port_subscribe_queue,
+
+		"snd_seq_queue_info.owner": C.seq_queue_info_owner,
+		"snd_seq_queue_info.name":  C.seq_queue_info_name,
+		"snd_seq_queue_info.flags": C.seq_queue_info_flags,
+
+		"snd_seq_query_subs.type":     C.seq_query_subs_type,
+		"snd_seq_query_subs.num_subs": C.seq_query_subs_num_subs,
+		"snd_seq_query_subs.addr":     C.seq_query_subs_addr,
+		"snd_seq_query_subs.flags":    C.seq_query_subs_flags,
+
+		"SNDRV_SEQ_IOCTL_CLIENT_ID":         uintptr(C.seq_ioctl_client_id()),
+		"SNDRV_SEQ_IOCTL_GET_CLIENT_INFO":   uintptr(C.seq_ioctl_get_client_info()),
+		"SNDRV_SEQ_IOCTL_SET_CLIENT_INFO":   uintptr(C.seq_ioctl_set_client_info()),
+		"SNDRV_SEQ_IOCTL_CREATE_PORT":       uintptr(C.seq_ioctl_create_port()),
+		"SNDRV_SEQ_IOCTL_SUBSCRIBE_PORT":    uintptr(C.seq_ioctl_subscribe_port()),
+		"SNDRV_SEQ_IOCTL_CREATE_QUEUE":      uintptr(C.seq_ioctl_create_queue()),
+		"SNDRV_SEQ_IOCTL_DELETE_QUEUE":      uintptr(C.seq_ioctl_delete_queue()),
+		"SNDRV_SEQ_IOCTL_QUERY_SUBS":        uintptr(C.seq_ioctl_query_subs()),
+		"SNDRV_SEQ_IOCTL_QUERY_NEXT_CLIENT": uintptr(C.seq_ioctl_query_next_client()),
+		"SNDRV_SEQ_IOCTL_QUERY_NEXT_PORT":   uintptr(C.seq_ioctl_query_next_port()),
+	}
+}
@@ -0,0 +1,95 @@
+//go:build linux && cgo && alsa_abi
+
+package main
+
+import (
+	"testing"
+	"unsafe"
+)
+
+// TestSeqABI checks the sequencer structs, event layout and ioctl numbers
+// in backend_alsa.go against <sound/asequencer.h>. It needs the kernel
+// headers, so it only runs with go test -tags alsa_abi.
+func TestSeqABI(t *testing.T) {
+	var (
+		client    seqClientInfo
+		port      seqPortInfo
+		subscribe seqPortSubscribe
+		queue     seqQueueInfo
+		subs      seqQuerySubs
+	)
+	mirror := map[string]uintptr{
+		"sizeof(snd_seq_event)":          seqEventSize,
+		"sizeof(snd_seq_client_info)":    unsafe.Sizeof(client),
+		"sizeof(snd_seq_port_info)":      unsafe.Sizeof(port),
+		"sizeof(snd_seq_port_subscribe)": unsafe.Sizeof(subscribe),
+		"sizeof(snd_seq_queue_info)":     unsafe.Sizeof(queue),
+		"sizeof(snd_seq_query_subs)":     unsafe.Sizeof(subs),
+
+		// Offsets used by encodeSeqEvent, decodeSeqEvent and WriteEvent
+		"snd_seq_event.type":               0,
+		"snd_seq_event.flags":              1,
+		"snd_seq_event.queue":              3,
+		"snd_seq_event.time.time.tv_sec":   4,
+		"snd_seq_event.time.time.tv_nsec":  8,
+		"snd_seq_event.source":             12,
+		"snd_seq_event.dest":               14,
+		"snd_seq_event.data.note.channel":  16,
+		"snd_seq_event.data.note.note":     17,
+		"snd_seq_event.data.note.velocity": 18,
+		"snd_seq_event.data.control.param": 20,
+		"snd_seq_event.data.control.value": 24,
+		"snd_seq_event.data.ext.len":       16,
+		"snd_seq_event.data.ext.ptr":       20,
+		"snd_seq_event.data.queue.queue":   16,
+		"snd_seq_event.data.connect.dest":  18,
+
+		"snd_seq_client_info.name":      unsafe.Offsetof(client.name),
+		"snd_seq_client_info.filter":    unsafe.Offsetof(client.filter),
+		"snd_seq_client_info.num_ports": unsafe.Offsetof(client.numPorts),
+		"snd_seq_client_info.pid":       unsafe.Offsetof(client.pid),
+
+		"snd_seq_port_info.name":       unsafe.Offsetof(port.name),
+		"snd_seq_port_info.capability": unsafe.Offsetof(port.capability),
+		"snd_seq_port_info.type":       unsafe.Offsetof(port.portType),
+		"snd_seq_port_info.kernel":     unsafe.Offsetof(port.kernel),
+		"snd_seq_port_info.flags":      unsafe.Offsetof(port.flags),
+		"snd_seq_port_info.time_queue": unsafe.Offsetof(port.timeQueue),
+
+		"snd_seq_port_subscribe.dest":  unsafe.Offsetof(subscribe.dest),
+		"snd_seq_port_subscribe.flags": unsafe.Offsetof(subscribe.flags),
+		"snd_seq_port_subscribe.queue": unsafe.Offsetof(subscribe.queue),
+
+		"snd_seq_queue_info.owner": unsafe.Offsetof(queue.owner),
+		"snd_seq_queue_info.name":  unsafe.Offsetof(queue.name),
+		"snd_seq_queue_info.flags": unsafe.Offsetof(queue.flags),
+
+		"snd_seq_query_subs.type":     unsafe.Offsetof(subs.subsType),
+		"snd_seq_query_subs.num_subs": unsafe.Offsetof(subs.numSubs),
+		"snd_seq_query_subs.addr":     unsafe.Offsetof(subs.addr),
+		"snd_seq_query_subs.flags":    unsafe.Offsetof(subs.flags),
+
+		"SNDRV_SEQ_IOCTL_CLIENT_ID":         seqIoctlClientID,
+		"SNDRV_SEQ_IOCTL_GET_CLIENT_INFO":   seqIoctlGetClientInfo,
+		"SNDRV_SEQ_IOCTL_SET_CLIENT_INFO":   seqIoctlSetClientInfo,
+		"SNDRV_SEQ_IOCTL_CREATE_PORT":       seqIoctlCreatePort,
+		"SNDRV_SEQ_IOCTL_SUBSCRIBE_PORT":    seqIoctlSubscribePort,
+		"SNDRV_SEQ_IOCTL_CREATE_QUEUE":      seqIoctlCreateQueue,
+		"SNDRV_SEQ_IOCTL_DELETE_QUEUE":      seqIoctlDeleteQueue,
+		"SNDRV_SEQ_IOCTL_QUERY_SUBS":        seqIoctlQuerySubs,
+		"SNDRV_SEQ_IOCTL_QUERY_NEXT_CLIENT": seqIoctlQueryNextClient,
+		"SNDRV_SEQ_IOCTL_QUERY_NEXT_PORT":   seqIoctlQueryNextPort,
+	}
+
+	header := seqHeaderABI()
+	for name, want := range header {
+		got, ok := mirror[name]
+		if !ok {
+			t.Errorf("%s not checked", name)
+			continue
+		}
+		if got != want {
+			t.Errorf("Expected %s %#x, got %#x", name, want, got)
+		}
+	}
+}
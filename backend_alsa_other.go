@@ -0,0 +1,11 @@
+//go:build !linux
+
+package main
+
+import "errors"
+
+// openALSABackend is only available on Linux, where the kernel provides
+// the ALSA sequencer.
+func openALSABackend(clientName string) (midiBackend, error) {
+	return nil, errors.New("the ALSA backend is only available on Linux")
+}
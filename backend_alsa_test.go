@@ -0,0 +1,195 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"os"
+	"testing"
+	"unsafe"
+
+	"github.com/hypebeast/go-osc/osc"
+	"github.com/xthexder/go-jack"
+)
+
+func TestSeqStructSizes(t *testing.T) {
+	if unsafe.Sizeof(uintptr(0)) != 8 {
+		t.Skip("sizes checked for 64-bit platforms")
+	}
+	if size := unsafe.Sizeof(seqClientInfo{}); size != 188 {
+		t.Errorf("Expected snd_seq_client_info size 188, got %d", size)
+	}
+	if size := unsafe.Sizeof(seqPortInfo{}); size != 168 {
+		t.Errorf("Expected snd_seq_port_info size 168, got %d", size)
+	}
+	if size := unsafe.Sizeof(seqPortSubscribe{}); size != 80 {
+		t.Errorf("Expected snd_seq_port_subscribe size 80, got %d", size)
+	}
+	if size := unsafe.Sizeof(seqQuerySubs{}); size != 88 {
+		t.Errorf("Expected snd_seq_query_subs size 88, got %d", size)
+	}
+	if seqIoctlCreatePort != 0xC0A85320 {
+		t.Errorf("Expected SNDRV_SEQ_IOCTL_CREATE_PORT 0xC0A85320, got %#x", seqIoctlCreatePort)
+	}
+}
+
+func TestSeqEventRoundTrip(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      []byte
+		eventType byte
+	}{
+		{"Note On", []byte{0x93, 60, 100}, seqEventNoteOn},
+		{"Note On velocity 0", []byte{0x90, 60, 0}, seqEventNoteOn},
+		{"Note Off", []byte{0x80, 60, 64}, seqEventNoteOff},
+		{"Poly Pressure", []byte{0xA2, 60, 30}, seqEventKeyPress},
+		{"Control Change", []byte{0xBF, 7, 127}, seqEventController},
+		{"Program Change", []byte{0xC9, 5}, seqEventPgmChange},
+		{"Channel Pressure", []byte{0xD0, 90}, seqEventChanPress},
+		{"Pitch Bend center", []byte{0xE0, 0x00, 0x40}, seqEventPitchBend},
+		{"Pitch Bend min", []byte{0xE1, 0x00, 0x00}, seqEventPitchBend},
+		{"Pitch Bend max", []byte{0xE1, 0x7F, 0x7F}, seqEventPitchBend},
+		{"Song Position", []byte{0xF2, 0x10, 0x02}, seqEventSongPos},
+		{"Song Select", []byte{0xF3, 3}, seqEventSongSel},
+		{"Clock", []byte{0xF8}, seqEventClock},
+		{"Start", []byte{0xFA}, seqEventStart},
+		{"Continue", []byte{0xFB}, seqEventContinue},
+		{"Stop", []byte{0xFC}, seqEventStop},
+		{"SysEx", []byte{0xF0, 0x7E, 0x7F, 0x06, 0x01, 0xF7}, seqEventSysEx},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := make([]byte, seqEventSize)
+			ext, ok := encodeSeqEvent(event, tt.data)
+			if !ok {
+				t.Fatalf("Cannot encode % X", tt.data)
+			}
+			if event[0] != tt.eventType {
+				t.Errorf("Expected event type %d, got %d", tt.eventType, event[0])
+			}
+			if decoded := decodeSeqEvent(event, ext); !bytes.Equal(decoded, tt.data) {
+				t.Errorf("Expected % X after round trip, got % X", tt.data, decoded)
+			}
+		})
+	}
+
+	// Truncated and unsupported messages are refused
+	for _, data := range [][]byte{nil, {0x90, 60}, {0xB0, 7}, {0xC0}, {0xF4}} {
+		if _, ok := encodeSeqEvent(make([]byte, seqEventSize), data); ok {
+			t.Errorf("Expected % X to be refused", data)
+		}
+	}
+}
+
+func TestALSAPortSysExChunks(t *testing.T) {
+	port := &alsaPort{dir: portInput}
+	event := make([]byte, seqEventSize)
+	event[0] = seqEventSysEx
+
+	port.receive(event, []byte{0xF0, 0x43, 0x10})
+	if len(port.in) != 0 {
+		t.Fatalf("Expected no event before the end of the SysEx, got %v", port.in)
+	}
+	port.receive(event, []byte{0x4C, 0x00, 0xF7})
+	if len(port.in) != 1 || !bytes.Equal(port.in[0].Buffer, []byte{0xF0, 0x43, 0x10, 0x4C, 0x00, 0xF7}) {
+		t.Errorf("Expected the reassembled SysEx, got %v", port.in)
+	}
+}
+
+func TestALSAPortWriteEventOffset(t *testing.T) {
+	tests := []struct {
+		name  string
+		queue int
+		time  uint32
+		flags byte
+		dest  byte
+		nsec  uint32
+	}{
+		{"Start of period", 5, 0, 0, seqQueueDirect, 0},
+		{"Offset 48 frames", 5, 48, seqTimeStampReal | seqTimeModeRel, 5, 1000000},
+		{"Offset without queue", -1, 48, 0, seqQueueDirect, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			port := &alsaPort{backend: &alsaBackend{queue: tt.queue}}
+			if err := port.WriteEvent(&jack.MidiData{Time: tt.time, Buffer: []byte{0x90, 60, 100}}); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(port.out) != seqEventSize {
+				t.Fatalf("Expected %d bytes, got %d", seqEventSize, len(port.out))
+			}
+			if flags := port.out[1] &^ seqEventLengthMask; flags != tt.flags {
+				t.Errorf("Expected flags %#x, got %#x", tt.flags, flags)
+			}
+			if port.out[3] != tt.dest {
+				t.Errorf("Expected queue %d, got %d", tt.dest, port.out[3])
+			}
+			if sec := binary.NativeEndian.Uint32(port.out[4:]); sec != 0 {
+				t.Errorf("Expected 0 s, got %d", sec)
+			}
+			if nsec := binary.NativeEndian.Uint32(port.out[8:]); nsec != tt.nsec {
+				t.Errorf("Expected %d ns, got %d", tt.nsec, nsec)
+			}
+		})
+	}
+}
+
+// TestALSABackendLoopback runs the bridge on the kernel sequencer with its
+// output connected to its input, so OSC in comes back as OSC out.
+func TestALSABackendLoopback(t *testing.T) {
+	if _, err := os.Stat(alsaSeqDevice); err != nil {
+		t.Skipf("ALSA sequencer not available: %v", err)
+	}
+	backend, err := openALSABackend("osc-midi-bridge-test")
+	if err != nil {
+		t.Skipf("Cannot open ALSA sequencer: %v", err)
+	}
+
+	conn := listenOSC(t)
+	bridge, err := newBridge(Config{
+		ClientName:      "osc-midi-bridge-test",
+		PortName:        "midi_out",
+		OSCTargetHost:   "127.0.0.1",
+		OSCTargetPort:   conn.LocalAddr().(*net.UDPAddr).Port,
+		PitchBendFormat: pitchBendSigned,
+	}, func(string) (midiBackend, error) { return backend, nil })
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer bridge.Cleanup()
+
+	alsa := backend.(*alsaBackend)
+	out := bridge.outPorts[0].port.(*alsaPort)
+	in := bridge.inPorts[0].port.(*alsaPort)
+	if err := alsa.subscribe(out.addr, in.addr); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := bridge.activate(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if alsa.queue < 0 {
+		t.Error("Expected the backend to start a sequencer queue")
+	}
+
+	// --list-ports shows the loop from both ends
+	ports, err := alsa.ListPorts()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, port := range ports {
+		if port.Name == out.Name() && port.Direction == "out" && (len(port.Connections) != 1 || port.Connections[0] != in.Name()) {
+			t.Errorf("Expected %s connected to %s, got %v", out.Name(), in.Name(), port.Connections)
+		}
+	}
+
+	bridge.dispatcher.Dispatch(osc.NewMessage("/midi/2/note_on", int32(60), int32(100)))
+
+	msg := receiveOSC(t, conn)
+	if msg.Address != "/midi/2/note_on" || len(msg.Arguments) != 2 || msg.Arguments[1] != int32(100) {
+		t.Errorf("Expected /midi/2/note_on [60 100], got %v", msg)
+	}
+}
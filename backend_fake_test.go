@@ -0,0 +1,289 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/xthexder/go-jack"
+)
+
+// fakeBackend is an in-memory midiBackend for tests. Nothing happens on its
+// own: each call to cycle runs the process callback for one period, with
+// the frame counter advancing by exactly nframes.
+type fakeBackend struct {
+	mu         sync.Mutex
+	sampleRate uint32
+	frame      uint32 // Frame time at the start of the current period
+	process    func(nframes uint32) int
+	rateChange func(rate uint32)
+	ports      map[string]*fakePort
+	active     bool
+	closed     bool
+	period     sync.Mutex         // Held while the process callback runs
+	transport  *transportPosition // Set between cycles; nil for none
+
+	clientName  string
+	external    map[string]portDirection // Other clients' ports by full name
+	connections map[[2]string]bool       // Source and destination full names
+	registered  func()
+	disconnect  func(source string)
+}
+
+func newFakeBackend(sampleRate uint32) *fakeBackend {
+	return &fakeBackend{
+		sampleRate:  sampleRate,
+		ports:       make(map[string]*fakePort),
+		external:    make(map[string]portDirection),
+		connections: make(map[[2]string]bool),
+	}
+}
+
+// opener returns a backendOpener that hands out this backend.
+func (f *fakeBackend) opener() backendOpener {
+	return func(clientName string) (midiBackend, error) {
+		f.clientName = clientName
+		return f, nil
+	}
+}
+
+func (f *fakeBackend) RegisterPort(name string, dir portDirection) (midiPort, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, exists := f.ports[name]; exists {
+		return nil, fmt.Errorf("port %s exists already", name)
+	}
+	port := &fakePort{name: name, fullName: f.clientName + ":" + name, dir: dir}
+	f.ports[name] = port
+	return port, nil
+}
+
+func (f *fakeBackend) SetProcessCallback(process func(nframes uint32) int) error {
+	f.process = process
+	return nil
+}
+
+func (f *fakeBackend) SetSampleRateCallback(callback func(rate uint32)) error {
+	f.rateChange = callback
+	return nil
+}
+
+func (f *fakeBackend) SampleRate() uint32            { return f.sampleRate }
+func (f *fakeBackend) LastFrameTime() uint32         { return f.frame }
+func (f *fakeBackend) FramesSinceCycleStart() uint32 { return 0 }
+
+func (f *fakeBackend) Transport() (transportPosition, bool) {
+	if f.transport == nil {
+		return transportPosition{}, false
+	}
+	return *f.transport, true
+}
+
+func (f *fakeBackend) ExternalPorts(dir portDirection) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var names []string
+	for name, d := range f.external {
+		if d == dir {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// ListPorts lists the other clients' ports with their connections.
+func (f *fakeBackend) ListPorts() ([]portInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var ports []portInfo
+	for name, dir := range f.external {
+		info := portInfo{
+			Name:      name,
+			Client:    strings.SplitN(name, ":", 2)[0],
+			Direction: dir.String(),
+			Type:      "virtual",
+		}
+		for c := range f.connections {
+			if dir == portOutput && c[0] == name {
+				info.Connections = append(info.Connections, c[1])
+			} else if dir == portInput && c[1] == name {
+				info.Connections = append(info.Connections, c[0])
+			}
+		}
+		sort.Strings(info.Connections)
+		ports = append(ports, info)
+	}
+	sort.Slice(ports, func(i, j int) bool { return ports[i].Name < ports[j].Name })
+	return ports, nil
+}
+
+func (f *fakeBackend) Connect(source, destination string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	key := [2]string{source, destination}
+	if f.connections[key] {
+		return errAlreadyConnected
+	}
+	f.connections[key] = true
+	return nil
+}
+
+func (f *fakeBackend) SetPortRegistrationCallback(callback func()) error {
+	f.registered = callback
+	return nil
+}
+
+func (f *fakeBackend) SetPortDisconnectCallback(callback func(source string)) error {
+	f.disconnect = callback
+	return nil
+}
+
+// disconnected simulates removing a connection from a source port.
+func (f *fakeBackend) disconnected(source, destination string) {
+	f.mu.Lock()
+	delete(f.connections, [2]string{source, destination})
+	callback := f.disconnect
+	f.mu.Unlock()
+	if callback != nil {
+		callback(source)
+	}
+}
+
+// addExternalPort simulates another client registering a port.
+func (f *fakeBackend) addExternalPort(name string, dir portDirection) {
+	f.mu.Lock()
+	f.external[name] = dir
+	callback := f.registered
+	f.mu.Unlock()
+	if callback != nil {
+		callback()
+	}
+}
+
+// connected reports whether two ports were connected.
+func (f *fakeBackend) connected(source, destination string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.connections[[2]string{source, destination}]
+}
+
+func (f *fakeBackend) Activate() error {
+	if f.process == nil {
+		return errors.New("no process callback")
+	}
+	f.mu.Lock()
+	f.active = true
+	f.mu.Unlock()
+	return nil
+}
+
+func (f *fakeBackend) Deactivate() error {
+	f.period.Lock()
+	defer f.period.Unlock()
+	f.mu.Lock()
+	f.active = false
+	f.mu.Unlock()
+	return nil
+}
+
+func (f *fakeBackend) Close() error {
+	f.Deactivate()
+	f.closed = true
+	return nil
+}
+
+// port returns a registered port by name, or nil.
+func (f *fakeBackend) port(name string) *fakePort {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.ports[name]
+}
+
+// setSampleRate changes the sample rate as a server restart would.
+func (f *fakeBackend) setSampleRate(rate uint32) {
+	f.sampleRate = rate
+	if f.rateChange != nil {
+		f.rateChange(rate)
+	}
+}
+
+// cycle runs the process callback for one period of nframes. Events sent to
+// input ports beforehand are delivered in this period.
+func (f *fakeBackend) cycle(nframes uint32) {
+	f.period.Lock()
+	defer f.period.Unlock()
+	f.runPeriod(nframes)
+}
+
+// cycleActive runs a period like cycle if the backend is active, as its
+// real-time thread would, and reports whether it did.
+func (f *fakeBackend) cycleActive(nframes uint32) bool {
+	f.period.Lock()
+	defer f.period.Unlock()
+	f.mu.Lock()
+	active := f.active
+	f.mu.Unlock()
+	if active {
+		f.runPeriod(nframes)
+	}
+	return active
+}
+
+func (f *fakeBackend) runPeriod(nframes uint32) {
+	f.process(nframes)
+	f.mu.Lock()
+	for _, port := range f.ports {
+		port.pending = nil
+	}
+	f.mu.Unlock()
+	f.frame += nframes
+}
+
+// fakePort is a port of a fakeBackend.
+type fakePort struct {
+	name     string
+	fullName string
+	dir      portDirection
+	pending  []*jack.MidiData // Input delivered in the next period
+	written  []jack.MidiData  // Output of the last period
+}
+
+func (p *fakePort) Name() string { return p.fullName }
+
+func (p *fakePort) ClearBuffer(nframes uint32) {
+	p.written = p.written[:0]
+}
+
+func (p *fakePort) WriteEvent(event *jack.MidiData) error {
+	if p.dir != portOutput {
+		return fmt.Errorf("port %s is not an output", p.name)
+	}
+	if n := len(p.written); n > 0 && event.Time < p.written[n-1].Time {
+		return fmt.Errorf("event at %d written after %d", event.Time, p.written[n-1].Time)
+	}
+	// Copy, as callers reuse their buffers
+	p.written = append(p.written, jack.MidiData{
+		Time:   event.Time,
+		Buffer: append([]byte(nil), event.Buffer...),
+	})
+	return nil
+}
+
+func (p *fakePort) ReadEvents(nframes uint32) []*jack.MidiData {
+	return p.pending
+}
+
+// send queues an incoming event at the given offset of the next period.
+func (p *fakePort) send(offset uint32, data ...byte) {
+	p.pending = append(p.pending, &jack.MidiData{Time: offset, Buffer: data})
+	sort.SliceStable(p.pending, func(i, j int) bool {
+		return p.pending[i].Time < p.pending[j].Time
+	})
+}
@@ -0,0 +1,289 @@
+package main
+
+/*
+#cgo linux LDFLAGS: -ljack
+#cgo darwin LDFLAGS: -ljack
+
+#include <stdlib.h>
+#include <jack/jack.h>
+
+// jack_client_open is variadic, which cgo can't call
+static jack_client_t *open_jack_client(const char *name) {
+	return jack_client_open(name, JackNoStartServer, NULL);
+}
+
+// query_transport fills pos and returns whether the transport is rolling
+static int query_transport(jack_client_t *client, jack_position_t *pos) {
+	jack_transport_state_t state = jack_transport_query(client, pos);
+	return state == JackTransportRolling || state == JackTransportLooping;
+}
+*/
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"github.com/xthexder/go-jack"
+)
+
+// jackBackend runs the bridge as a JACK client.
+type jackBackend struct {
+	client *jack.Client
+
+	// go-jack has no transport or port alias API and keeps its client
+	// handle private, so those go through a client of our own; nil if it
+	// could not be opened.
+	transport *C.jack_client_t
+	position  C.jack_position_t // Filled by Transport on the process thread
+}
+
+// openJACKBackend connects to a running JACK server.
+func openJACKBackend(clientName string) (midiBackend, error) {
+	client, status := jack.ClientOpen(clientName, jack.NoStartServer)
+	if status != 0 {
+		return nil, fmt.Errorf("cannot connect to JACK server (status %d): %s\n\nPlease ensure JACK is running. Start it with:\n  jackd -d dummy -r 48000 -p 64\n\nFor even lower latency, try:\n  jackd -d dummy -r 48000 -p 32  # 0.67ms latency", status, jack.StrError(status))
+	}
+
+	cname := C.CString(clientName + "-transport")
+	defer C.free(unsafe.Pointer(cname))
+	return &jackBackend{client: client, transport: C.open_jack_client(cname)}, nil
+}
+
+func (j *jackBackend) RegisterPort(name string, dir portDirection) (midiPort, error) {
+	flags := uint64(jack.PortIsInput)
+	if dir == portOutput {
+		flags = jack.PortIsOutput
+	}
+	port := j.client.PortRegister(name, jack.DEFAULT_MIDI_TYPE, flags, 0)
+	if port == nil {
+		if dir == portOutput {
+			return nil, errors.New("failed to create MIDI output port")
+		}
+		return nil, errors.New("failed to create MIDI input port")
+	}
+	return &jackPort{port: port}, nil
+}
+
+func (j *jackBackend) SetProcessCallback(process func(nframes uint32) int) error {
+	if code := j.client.SetProcessCallback(process); code != 0 {
+		return fmt.Errorf("failed to set process callback: %s", jack.StrError(code))
+	}
+	return nil
+}
+
+func (j *jackBackend) SetSampleRateCallback(callback func(rate uint32)) error {
+	if code := j.client.SetSampleRateCallback(func(rate uint32) int {
+		callback(rate)
+		return 0
+	}); code != 0 {
+		return fmt.Errorf("failed to set sample rate callback: %s", jack.StrError(code))
+	}
+	return nil
+}
+
+func (j *jackBackend) SampleRate() uint32 {
+	return j.client.GetSampleRate()
+}
+
+func (j *jackBackend) LastFrameTime() uint32 {
+	return j.client.GetLastFrameTime()
+}
+
+func (j *jackBackend) FramesSinceCycleStart() uint32 {
+	return j.client.GetFramesSinceCycleStart()
+}
+
+func (j *jackBackend) Transport() (transportPosition, bool) {
+	if j.transport == nil {
+		return transportPosition{}, false
+	}
+	pos := &j.position
+	transport := transportPosition{
+		rolling: C.query_transport(j.transport, pos) != 0,
+		frame:   uint32(pos.frame),
+	}
+	if pos.valid&C.JackPositionBBT != 0 {
+		transport.bbt = true
+		transport.bar = int32(pos.bar)
+		transport.beat = int32(pos.beat)
+		transport.tick = int32(pos.tick)
+		transport.beatsPerBar = float64(pos.beats_per_bar)
+		transport.beatType = float64(pos.beat_type)
+		transport.ticksPerBeat = float64(pos.ticks_per_beat)
+		transport.bpm = float64(pos.beats_per_minute)
+	}
+	return transport, true
+}
+
+func (j *jackBackend) ExternalPorts(dir portDirection) ([]string, error) {
+	flags := uint64(jack.PortIsInput)
+	if dir == portOutput {
+		flags = jack.PortIsOutput
+	}
+	own := j.client.GetName() + ":"
+	var ports []string
+	for _, name := range j.client.GetPorts("", jack.DEFAULT_MIDI_TYPE, flags) {
+		if !strings.HasPrefix(name, own) {
+			ports = append(ports, name)
+		}
+	}
+	return ports, nil
+}
+
+func (j *jackBackend) Connect(source, destination string) error {
+	switch code := j.client.Connect(source, destination); code {
+	case 0:
+		return nil
+	case int(syscall.EEXIST):
+		return errAlreadyConnected
+	default:
+		return fmt.Errorf("cannot connect %s to %s: %s", source, destination, jack.StrError(code))
+	}
+}
+
+func (j *jackBackend) SetPortRegistrationCallback(callback func()) error {
+	if code := j.client.SetPortRegistrationCallback(func(port jack.PortId, registered bool) {
+		if registered {
+			callback()
+		}
+	}); code != 0 {
+		return fmt.Errorf("failed to set port registration callback: %s", jack.StrError(code))
+	}
+	return nil
+}
+
+func (j *jackBackend) SetPortDisconnectCallback(callback func(source string)) error {
+	if code := j.client.SetPortConnectCallback(func(source, destination jack.PortId, connected bool) {
+		if connected {
+			return
+		}
+		if port := j.client.GetPortById(source); port != nil {
+			callback(port.GetName())
+		}
+	}); code != 0 {
+		return fmt.Errorf("failed to set port connect callback: %s", jack.StrError(code))
+	}
+	return nil
+}
+
+func (j *jackBackend) Activate() error {
+	if code := j.client.Activate(); code != 0 {
+		return fmt.Errorf("failed to activate JACK client: %s", jack.StrError(code))
+	}
+	return nil
+}
+
+// Deactivate closes the client, which go-jack offers instead of
+// jack_deactivate: jack_client_close stops the process callback before
+// returning. Close is then a no-op.
+func (j *jackBackend) Deactivate() error {
+	return j.Close()
+}
+
+func (j *jackBackend) Close() error {
+	code := j.client.Close()
+	if j.transport != nil {
+		C.jack_client_close(j.transport)
+		j.transport = nil
+	}
+	if code != 0 {
+		return fmt.Errorf("failed to close JACK client: %s", jack.StrError(code))
+	}
+	return nil
+}
+
+// jackPort is a JACK MIDI port. The output buffer is only valid for the
+// period it was cleared in.
+type jackPort struct {
+	port   *jack.Port
+	buffer jack.MidiBuffer
+}
+
+func (p *jackPort) Name() string {
+	return p.port.GetName()
+}
+
+func (p *jackPort) ClearBuffer(nframes uint32) {
+	p.buffer = p.port.MidiClearBuffer(nframes)
+}
+
+func (p *jackPort) WriteEvent(event *jack.MidiData) error {
+	if code := p.port.MidiEventWrite(event, p.buffer); code != 0 {
+		return fmt.Errorf("failed to write MIDI event: %s", jack.StrError(code))
+	}
+	return nil
+}
+
+func (p *jackPort) ReadEvents(nframes uint32) []*jack.MidiData {
+	return p.port.GetMidiEvents(nframes)
+}
+
+// ListPorts describes the JACK MIDI ports with their direction, type,
+// client, aliases and connections.
+func (j *jackBackend) ListPorts() ([]portInfo, error) {
+	// go-jack has no jack_port_flags, so flags come from filtered queries
+	outputs := make(map[string]bool)
+	for _, name := range j.client.GetPorts("", jack.DEFAULT_MIDI_TYPE, jack.PortIsOutput) {
+		outputs[name] = true
+	}
+	physical := make(map[string]bool)
+	for _, name := range j.client.GetPorts("", jack.DEFAULT_MIDI_TYPE, jack.PortIsPhysical) {
+		physical[name] = true
+	}
+
+	var ports []portInfo
+	for _, name := range j.client.GetPorts("", jack.DEFAULT_MIDI_TYPE, 0) {
+		port := j.client.GetPortByName(name)
+		if port == nil {
+			continue // Unregistered since listing
+		}
+		info := portInfo{
+			Name:        name,
+			Client:      port.GetClientName(),
+			Direction:   portInput.String(),
+			Type:        "virtual",
+			Aliases:     jackPortAliases(j.transport, name),
+			Connections: port.GetConnections(),
+		}
+		if outputs[name] {
+			info.Direction = portOutput.String()
+		}
+		if physical[name] {
+			info.Type = "physical"
+		}
+		ports = append(ports, info)
+	}
+	return ports, nil
+}
+
+// jackPortAliases returns the aliases of the named port, using a client
+// opened with open_jack_client; nil if there is none.
+func jackPortAliases(client *C.jack_client_t, name string) []string {
+	if client == nil {
+		return nil
+	}
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+	handle := C.jack_port_by_name(client, cname)
+	if handle == nil {
+		return nil // Unregistered since listing
+	}
+
+	size := C.size_t(C.jack_port_name_size())
+	var buffers [2]*C.char
+	for i := range buffers {
+		buffers[i] = (*C.char)(C.calloc(1, size))
+		defer C.free(unsafe.Pointer(buffers[i]))
+	}
+
+	var aliases []string
+	n := int(C.jack_port_get_aliases(handle, &buffers[0]))
+	for i := 0; i < n && i < len(buffers); i++ {
+		aliases = append(aliases, C.GoString(buffers[i]))
+	}
+	return aliases
+}
@@ -1,8 +1,16 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/GeoffreyPlitt/debuggo"
 	"github.com/hypebeast/go-osc/osc"
@@ -11,68 +19,344 @@ import (
 
 var debugBridge = debuggo.Debug("bridge")
 
+// defaultSubscriptionTTL is how long a /bridge/subscribe target receives
+// messages unless renewed.
+const defaultSubscriptionTTL = 60 * time.Second
+
+// subscriptionCheckInterval is how often the OSC sender drops expired
+// subscriptions when nothing is being sent; at most the subscription
+// lifetime.
+const subscriptionCheckInterval = time.Second
+
+// drainTimeout bounds how long Cleanup waits for queued MIDI events to be
+// written, and then for queued OSC messages to be sent.
+const drainTimeout = time.Second
+
 type MidiEvent struct {
 	midiData *jack.MidiData
+	at       time.Time   // Wall-clock time to play at; zero plays immediately
+	port     *bridgePort // Output port; nil for the first
+}
+
+// Config holds the settings used to construct a Bridge.
+type Config struct {
+	OSCPort         int
+	OSCTransport    string // udp (default), tcp-slip or tcp-len; used for input and output
+	WSPort          int    // Port of the WebSocket endpoint; 0 disables it
+	WSOrigin        string // Comma-separated origins besides the bridge's own allowed to open WebSockets; * allows any
+	ClientName      string
+	PortName        string
+	OSCTargetHost   string
+	OSCTargetPort   int
+	OSCTargets      []OSCTarget   // Filtered targets; replace OSCTargetHost:OSCTargetPort when set
+	SubscriptionTTL time.Duration // Lifetime of /bridge/subscribe targets and reply peers; 0 means the default
+	ReplyTo         string        // Also send to OSC senders: off (default), last or all; UDP only
+	ReplyFromServer bool          // Reply from the OSC server's socket instead of a new one
+	MulticastGroup  string        // IPv4 multicast group the OSC server joins; optional
+	MulticastTTL    int           // TTL of packets to multicast targets; 0 keeps them on this host
+	MulticastIface  string        // Interface for multicast input and output; empty lets the system choose
+	PitchBendFormat string        // signed, unsigned or float (see utils.go)
+	ClockDivider    int           // Emit one /midi/clock per N incoming ticks
+	ClockBPM        float64       // Tempo of the internal MIDI clock; 0 disables it
+	MappingFile     string        // Optional YAML or JSON OSC↔MIDI mapping file
+	ChannelBase     int           // Number of MIDI channel 1 in OSC paths: 0 or 1
+	Backend         string        // MIDI system: jack (default) or alsa
+	Ports           []PortConfig  // Named ports; PortName and InPortName are used for a direction without any
+	InPortName      string        // Default input port name; empty means midi_in
+	ConnectOut      string        // Regexp of external ports to connect the output ports to
+	ConnectIn       string        // Regexp of external ports to connect to the input ports
+	MPELowerZone    int           // Member channels of the MPE lower zone; 0 disables it
+	MPEUpperZone    int           // Member channels of the MPE upper zone; 0 disables it
+	MIDI2           bool          // Send channel voice messages from MIDI input as MIDI 2.0 /ump
+	MaxNoteDuration time.Duration // Release notes sounding longer than this; 0 never does
+	AllNotesOff     bool          // Follow released notes with CC 123 on their channels
 }
 
 type Bridge struct {
-	oscServer     *osc.Server
-	jackClient    *jack.Client
-	midiOutPort   *jack.Port
-	midiInPort    *jack.Port
-	eventQueue    chan *MidiEvent
-	oscOutQueue   chan *osc.Message
-	oscTargetHost string
-	oscTargetPort int
+	oscServer       *osc.Server
+	dispatcher      *oscDispatcher
+	backend         midiBackend
+	outPorts        []*bridgePort // The first also receives unprefixed /midi addresses
+	inPorts         []*bridgePort
+	routePort       *bridgePort // Output port of the /port/<name> address being dispatched
+	eventQueue      chan *MidiEvent
+	pendingMidi     atomic.Int32   // Events queued or scheduled but not yet written; see drainMidi
+	scheduler       *midiScheduler // Timetagged events; RT thread only
+	oscOutQueue     chan *osc.Message
+	oscTransport    string
+	wsPort          int
+	wsOrigins       map[string]bool // Allowed besides same-origin pages; see checkWSOrigin
+	ws              *wsHub          // WebSocket clients, which also receive MIDI→OSC output
+	wsServer        *http.Server
+	targetsMu       sync.Mutex
+	targets         []oscRoute // Where MIDI→OSC messages go; see sendOSC
+	subscriptionTTL time.Duration
+	replyTo         string
+	replyFromServer bool
+	multicastGroup  net.IP // Joined by the OSC server; nil for none
+	multicastTTL    int
+	multicastIface  *net.Interface
+	pitchBendFormat string
+	channelBase     uint8 // OSC-facing number of MIDI channel 1
+	clockDivider    uint32
+	clock           *clockGenerator  // Internal MIDI clock; nil unless ClockBPM is set
+	clockOut        *jack.MidiData   // Reused for generated clock bytes
+	splitOut        *jack.MidiData   // Reused for each message of a multi-message event
+	noteOff         *jack.MidiData   // Reused for note-offs of hanging notes
+	periodTime      time.Time        // Wall-clock start of the current period; RT thread only
+	now             func() time.Time // Wall clock read by the process callback; tests replace it
+	maxNoteDuration time.Duration
+	allNotesOff     bool
+	releaseRequests chan chan struct{} // See releaseAllNotes
+	releaseAck      chan struct{}      // Closed once a release is delivered; RT thread only
+	activated       bool
+	sampleRate      atomic.Uint32
+	mappings        *mappingTable
+	midi2           bool
+	mpeZones        []*mpeZone
+	mpeMembers      [16]*mpeZone   // Zone of each member channel; nil for other channels
+	connectOut      *regexp.Regexp // Optional; see autoConnect
+	connectIn       *regexp.Regexp
+	portsChanged    chan struct{} // Signalled when another client registers a port
+	done            chan struct{} // Closed by Cleanup
+	senderDone      chan struct{} // Closed when the OSC sender and target queues have emptied the closed oscOutQueue
+	cleanup         sync.Once
+	cleanupErr      error
 }
 
-func NewBridge(oscPort int, clientName string, portName string, oscTargetHost string, oscTargetPort int) (*Bridge, error) {
+// NewBridge creates a bridge running on the configured MIDI backend.
+func NewBridge(cfg Config) (*Bridge, error) {
+	open, err := lookupBackend(cfg.Backend)
+	if err != nil {
+		return nil, err
+	}
+	return newBridge(cfg, open)
+}
+
+// newBridge validates the configuration, then creates a bridge on the
+// backend returned by open.
+func newBridge(cfg Config, open backendOpener) (*Bridge, error) {
+	if cfg.ClockDivider < 0 {
+		return nil, fmt.Errorf("invalid clock divider %d", cfg.ClockDivider)
+	}
+	if cfg.ClockBPM < 0 || cfg.ClockBPM > maxClockBPM {
+		return nil, fmt.Errorf("invalid clock tempo %g BPM (expected 0..%d)", cfg.ClockBPM, maxClockBPM)
+	}
+	if !validPitchBendFormat(cfg.PitchBendFormat) {
+		return nil, fmt.Errorf("invalid pitch bend format %q (expected signed, unsigned or float)", cfg.PitchBendFormat)
+	}
+	if cfg.SubscriptionTTL < 0 {
+		return nil, fmt.Errorf("invalid subscription lifetime %s", cfg.SubscriptionTTL)
+	}
+	if cfg.SubscriptionTTL == 0 {
+		cfg.SubscriptionTTL = defaultSubscriptionTTL
+	}
+	targets := cfg.OSCTargets
+	if len(targets) == 0 {
+		targets = []OSCTarget{{Host: cfg.OSCTargetHost, Port: cfg.OSCTargetPort}}
+	}
+	routes := make([]oscRoute, len(targets))
+	for i, target := range targets {
+		if target.Pattern != "" && target.Pattern[0] != '/' {
+			return nil, fmt.Errorf("invalid OSC target pattern %q", target.Pattern)
+		}
+		routes[i] = oscRoute{target: target}
+	}
+
+	if cfg.MulticastTTL < 0 || cfg.MulticastTTL > 255 {
+		return nil, fmt.Errorf("invalid multicast TTL %d (expected 0..255)", cfg.MulticastTTL)
+	}
+	multicastIface, err := multicastInterface(cfg.MulticastIface)
+	if err != nil {
+		return nil, err
+	}
+	var multicastGroup net.IP
+	if cfg.MulticastGroup != "" {
+		if multicastGroup, err = parseMulticastGroup(cfg.MulticastGroup); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.OSCTransport == "" {
+		cfg.OSCTransport = oscTransportUDP
+	}
+	if !validOSCTransport(cfg.OSCTransport) {
+		return nil, fmt.Errorf("invalid OSC transport %q (expected udp, tcp-slip or tcp-len)", cfg.OSCTransport)
+	}
+	if cfg.ReplyTo == "" {
+		cfg.ReplyTo = replyOff
+	}
+	if !validReplyMode(cfg.ReplyTo) {
+		return nil, fmt.Errorf("invalid reply mode %q (expected off, last or all)", cfg.ReplyTo)
+	}
+	if cfg.ReplyTo != replyOff && cfg.OSCTransport != oscTransportUDP {
+		return nil, fmt.Errorf("reply mode %s requires the udp OSC transport", cfg.ReplyTo)
+	}
+	if cfg.OSCTransport != oscTransportUDP {
+		if multicastGroup != nil {
+			return nil, errors.New("a multicast group requires the udp OSC transport")
+		}
+		for _, target := range targets {
+			if ip := net.ParseIP(target.Host); ip != nil && ip.IsMulticast() {
+				return nil, fmt.Errorf("multicast target %s requires the udp OSC transport", target)
+			}
+		}
+	}
+	wsOrigins, err := parseWSOrigins(cfg.WSOrigin)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.ChannelBase != 0 && cfg.ChannelBase != 1 {
+		return nil, fmt.Errorf("invalid channel base %d (expected 0 or 1)", cfg.ChannelBase)
+	}
+
+	mpeZones, err := newMPEZones(cfg.MPELowerZone, cfg.MPEUpperZone)
+	if err != nil {
+		return nil, err
+	}
+
+	var mappings *mappingTable
+	ports := cfg.Ports
+	if cfg.MappingFile != "" {
+		var err error
+		if mappings, err = loadMappings(cfg.MappingFile, cfg.ChannelBase); err != nil {
+			return nil, err
+		}
+		ports = append(append([]PortConfig(nil), ports...), mappings.ports...)
+	}
+	portNames := make(map[string]bool)
+	for _, port := range ports {
+		if err := validatePortName(port.Name); err != nil {
+			return nil, err
+		}
+		if portNames[port.Name] {
+			return nil, fmt.Errorf("port %s is declared more than once", port.Name)
+		}
+		portNames[port.Name] = true
+	}
+	inPortName := cfg.InPortName
+	if inPortName == "" {
+		inPortName = "midi_in"
+	}
+
+	connectOut, err := compileConnectPattern("connect-out", cfg.ConnectOut)
+	if err != nil {
+		return nil, err
+	}
+	connectIn, err := compileConnectPattern("connect-in", cfg.ConnectIn)
+	if err != nil {
+		return nil, err
+	}
+
 	// Create OSC server with dispatcher
-	dispatcher := osc.NewStandardDispatcher()
+	dispatcher := newOSCDispatcher()
 	server := &osc.Server{
-		Addr:       fmt.Sprintf(":%d", oscPort),
+		Addr:       fmt.Sprintf(":%d", cfg.OSCPort),
 		Dispatcher: dispatcher,
 	}
 
-	// Connect to JACK
-	client, status := jack.ClientOpen(clientName, jack.NoStartServer)
-	if status != 0 {
-		return nil, fmt.Errorf("cannot connect to JACK server (status %d): %s\n\nPlease ensure JACK is running. Start it with:\n  jackd -d dummy -r 48000 -p 64\n\nFor even lower latency, try:\n  jackd -d dummy -r 48000 -p 32  # 0.67ms latency", status, jack.StrError(status))
+	// Connect to the MIDI system
+	backend, err := open(cfg.ClientName)
+	if err != nil {
+		return nil, err
 	}
 
-	// Create MIDI output port
-	midiOutPort := client.PortRegister(portName, jack.DEFAULT_MIDI_TYPE, jack.PortIsOutput, 0)
-	if midiOutPort == nil {
-		client.Close()
-		return nil, errors.New("failed to create MIDI output port")
+	b := &Bridge{
+		oscServer:       server,
+		dispatcher:      dispatcher,
+		backend:         backend,
+		eventQueue:      make(chan *MidiEvent, 1024), // Pre-allocated queue
+		scheduler:       newMidiScheduler(1024),
+		oscOutQueue:     make(chan *osc.Message, 16), // OSC output queue
+		oscTransport:    cfg.OSCTransport,
+		wsPort:          cfg.WSPort,
+		wsOrigins:       wsOrigins,
+		ws:              newWSHub(),
+		targets:         routes,
+		subscriptionTTL: cfg.SubscriptionTTL,
+		replyTo:         cfg.ReplyTo,
+		replyFromServer: cfg.ReplyFromServer,
+		multicastGroup:  multicastGroup,
+		multicastTTL:    cfg.MulticastTTL,
+		multicastIface:  multicastIface,
+		pitchBendFormat: cfg.PitchBendFormat,
+		channelBase:     uint8(cfg.ChannelBase),
+		clockDivider:    uint32(cfg.ClockDivider),
+		clockOut:        &jack.MidiData{Buffer: make([]byte, 0, 3)},
+		splitOut:        &jack.MidiData{},
+		noteOff:         &jack.MidiData{Buffer: make([]byte, 0, 3)},
+		now:             time.Now,
+		maxNoteDuration: cfg.MaxNoteDuration,
+		allNotesOff:     cfg.AllNotesOff,
+		releaseRequests: make(chan chan struct{}, 1),
+		mappings:        mappings,
+		midi2:           cfg.MIDI2,
+		mpeZones:        mpeZones,
+		connectOut:      connectOut,
+		connectIn:       connectIn,
+		portsChanged:    make(chan struct{}, 1),
+		done:            make(chan struct{}),
+	}
+	if cfg.ClockBPM > 0 {
+		b.clock = newClockGenerator(cfg.ClockBPM)
+	}
+	for _, zone := range mpeZones {
+		for _, ch := range zone.members {
+			b.mpeMembers[ch] = zone
+		}
 	}
+	b.sampleRate.Store(backend.SampleRate())
+	b.wsServer = &http.Server{Handler: http.HandlerFunc(b.handleWebSocket)}
 
-	// Create MIDI input port
-	midiInPort := client.PortRegister("midi_in", jack.DEFAULT_MIDI_TYPE, jack.PortIsInput, 0)
-	if midiInPort == nil {
-		client.Close()
-		return nil, errors.New("failed to create MIDI input port")
+	// Create MIDI ports; a direction without named ports gets the default
+	if err := b.registerPorts(ports, cfg.PortName, inPortName); err != nil {
+		backend.Close()
+		return nil, err
 	}
 
-	b := &Bridge{
-		oscServer:     server,
-		jackClient:    client,
-		midiOutPort:   midiOutPort,
-		midiInPort:    midiInPort,
-		eventQueue:    make(chan *MidiEvent, 1024), // Pre-allocated queue
-		oscOutQueue:   make(chan *osc.Message, 16), // OSC output queue
-		oscTargetHost: oscTargetHost,
-		oscTargetPort: oscTargetPort,
+	// Track sample rate changes for the clock generator
+	if err := backend.SetSampleRateCallback(b.sampleRate.Store); err != nil {
+		backend.Close()
+		return nil, err
+	}
+
+	// Release the notes of output ports that lose a connection
+	if err := backend.SetPortDisconnectCallback(b.notifyPortDisconnected); err != nil {
+		backend.Close()
+		return nil, err
+	}
+
+	// Re-apply auto-connect patterns when ports appear
+	if connectOut != nil || connectIn != nil {
+		if err := backend.SetPortRegistrationCallback(b.notifyPortsChanged); err != nil {
+			backend.Close()
+			return nil, err
+		}
 	}
 
 	// Set up process callback
-	if code := client.SetProcessCallback(b.process); code != 0 {
-		client.Close()
-		return nil, fmt.Errorf("failed to set process callback: %s", jack.StrError(code))
+	if err := backend.SetProcessCallback(b.process); err != nil {
+		backend.Close()
+		return nil, err
 	}
 
 	// Set up OSC handlers
-	b.setupOSCHandlers()
+	if err := b.setupOSCHandlers(); err != nil {
+		backend.Close()
+		return nil, err
+	}
+	if err := b.setupMPEHandlers(); err != nil {
+		backend.Close()
+		return nil, err
+	}
+	if err := b.setupMappingHandlers(); err != nil {
+		backend.Close()
+		return nil, err
+	}
+	if err := b.sendMPEConfiguration(); err != nil {
+		backend.Close()
+		return nil, err
+	}
 
 	// Start OSC sender goroutine
 	b.startOSCSender()
@@ -80,54 +364,241 @@ func NewBridge(oscPort int, clientName string, portName string, oscTargetHost st
 	return b, nil
 }
 
-func (b *Bridge) Start() error {
-	if b.oscServer == nil || b.jackClient == nil {
+// registerPorts registers the named ports, plus an unprefixed default port
+// for each direction that has none.
+func (b *Bridge) registerPorts(ports []PortConfig, defaultOut, defaultIn string) error {
+	register := func(name string, dir portDirection, prefix string) error {
+		port, err := b.backend.RegisterPort(name, dir)
+		if err != nil {
+			return err
+		}
+		p := &bridgePort{name: name, dir: dir, prefix: prefix, port: port}
+		if dir == portOutput {
+			b.outPorts = append(b.outPorts, p)
+		} else {
+			b.inPorts = append(b.inPorts, p)
+		}
+		return nil
+	}
+
+	for _, port := range ports {
+		if err := register(port.Name, port.Direction, "/port/"+port.Name); err != nil {
+			return err
+		}
+	}
+	if len(b.outPorts) == 0 {
+		if err := register(defaultOut, portOutput, ""); err != nil {
+			return err
+		}
+	}
+	if len(b.inPorts) == 0 {
+		if err := register(defaultIn, portInput, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Start activates the bridge and serves OSC until ctx is cancelled, then
+// closes the OSC and WebSocket listeners and returns nil. It returns an
+// error if the bridge cannot start or the OSC server fails. Either way,
+// Cleanup delivers what is still queued and stops the MIDI backend.
+func (b *Bridge) Start(ctx context.Context) error {
+	if b.oscServer == nil || b.backend == nil {
 		return errors.New("bridge not initialized")
 	}
 
-	// Activate JACK client
-	if code := b.jackClient.Activate(); code != 0 {
-		return fmt.Errorf("failed to activate JACK client: %s", jack.StrError(code))
+	if err := b.activate(); err != nil {
+		return err
+	}
+
+	// Start WebSocket endpoint
+	if b.wsPort > 0 {
+		ln, err := net.Listen("tcp", fmt.Sprintf(":%d", b.wsPort))
+		if err != nil {
+			return err
+		}
+		debugBridge("Starting WebSocket endpoint on %s", ln.Addr())
+		go func() {
+			if err := b.serveWebSocket(ln); err != nil {
+				fmt.Printf("WARNING: WebSocket endpoint stopped: %v\n", err)
+			}
+		}()
 	}
 
 	// Start OSC server
-	debugBridge("Starting OSC server on %s", b.oscServer.Addr)
-	return b.oscServer.ListenAndServe()
+	debugBridge("Starting OSC %s server on %s", b.oscTransport, b.oscServer.Addr)
+	// The server only holds the address and dispatcher; reading is ours
+	var listener io.Closer
+	served := make(chan error, 1)
+	if b.oscTransport == oscTransportUDP {
+		var conn net.PacketConn
+		var err error
+		if b.multicastGroup != nil {
+			conn, err = b.listenOSCMulticast()
+		} else {
+			conn, err = net.ListenPacket("udp", b.oscServer.Addr)
+		}
+		if err != nil {
+			return err
+		}
+		listener = conn
+		go func() { served <- b.serveOSCPackets(conn) }()
+	} else {
+		ln, err := b.listenOSCStream()
+		if err != nil {
+			return err
+		}
+		listener = ln
+		go func() { served <- b.serveOSCStream(ln) }()
+	}
+
+	select {
+	case err := <-served:
+		listener.Close()
+		return err
+	case <-ctx.Done():
+	}
+
+	// Stop taking input; the server returns once its listener is closed
+	debugBridge("Stopping OSC server")
+	listener.Close()
+	<-served
+	if b.wsServer != nil {
+		b.wsServer.Close()
+	}
+	return nil
+}
+
+// activate starts the MIDI backend and connects the bridge's ports.
+func (b *Bridge) activate() error {
+	if err := b.backend.Activate(); err != nil {
+		return err
+	}
+	b.activated = true
+	if b.connectOut != nil || b.connectIn != nil {
+		b.autoConnect()
+		go b.watchPorts()
+	}
+	return nil
 }
 
-func (b *Bridge) Cleanup() {
+// Cleanup shuts the bridge down once Start has returned. The process
+// callback gets up to drainTimeout to write the queued MIDI events, sounding
+// notes are released, and the backend is deactivated before oscOutQueue is
+// closed, so the callback can never send on a closed channel. The OSC
+// sender then gets up to drainTimeout to send what is left. It returns an
+// error if anything was dropped or the backend failed to stop; later calls
+// return the same error.
+func (b *Bridge) Cleanup() error {
+	b.cleanup.Do(func() {
+		b.cleanupErr = b.shutdown()
+	})
+	return b.cleanupErr
+}
+
+func (b *Bridge) shutdown() error {
 	debugBridge("Cleaning up bridge resources")
+	var errs []error
+
+	// No more MIDI or OSC from handlers, whatever clients are still connected
+	if b.dispatcher != nil {
+		b.dispatcher.close()
+	}
+
+	if b.activated {
+		if err := b.drainMidi(); err != nil {
+			errs = append(errs, err)
+		}
+		// Notes must not hang once the bridge is gone
+		b.releaseAllNotes()
+	}
 
-	if b.oscServer != nil {
-		// OSC server cleanup happens when ListenAndServe returns
+	// Stop the port watcher
+	if b.done != nil {
+		close(b.done)
 	}
 
-	if b.jackClient != nil {
-		b.jackClient.Close()
+	if b.backend != nil {
+		if b.activated {
+			if err := b.backend.Deactivate(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		// Closing also stops the callback if deactivation failed
+		if err := b.backend.Close(); err != nil {
+			errs = append(errs, err)
+		}
 	}
 
-	// Close OSC output queue to signal sender goroutine to exit
+	// Nothing sends to the OSC output queue any more; let the sender empty it
 	if b.oscOutQueue != nil {
 		close(b.oscOutQueue)
+		if b.senderDone != nil {
+			select {
+			case <-b.senderDone:
+			case <-time.After(drainTimeout):
+				errs = append(errs, errors.New("timed out sending OSC to the targets, dropping the rest"))
+			}
+		}
+	}
+
+	// Disconnect WebSocket clients
+	if b.wsServer != nil {
+		b.wsServer.Close()
+	}
+	if b.ws != nil {
+		b.ws.close()
 	}
 
-	// Don't close the eventQueue channel if it's already nil or closed
-	// The channel will be garbage collected when the Bridge is freed
+	return errors.Join(errs...)
 }
 
-// JACK process callback - called by JACK in real-time thread
+// drainMidi waits up to drainTimeout for the process callback to write the
+// queued and timetagged MIDI events.
+func (b *Bridge) drainMidi() error {
+	deadline := time.Now().Add(drainTimeout)
+	for b.pendingMidi.Load() > 0 {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out writing MIDI, dropping %d events", b.pendingMidi.Load())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return nil
+}
+
+// Process callback - called by the MIDI backend in its real-time thread
 func (b *Bridge) process(nframes uint32) int {
 	// Handle outgoing MIDI (OSC → MIDI)
-	buffer := b.midiOutPort.MidiClearBuffer(nframes)
+	for _, port := range b.outPorts {
+		port.port.ClearBuffer(nframes)
+	}
+
+	// Reference point for mapping bundle timetags to frames in this period
+	cycleFrame := b.backend.LastFrameTime()
+	sampleRate := b.sampleRate.Load()
+	cycleTime := b.now()
+	if sampleRate > 0 {
+		elapsed := b.backend.FramesSinceCycleStart()
+		cycleTime = cycleTime.Add(-time.Duration(float64(elapsed) * float64(time.Second) / float64(sampleRate)))
+	}
+	b.periodTime = cycleTime
+
+	// Note-offs for hanging notes go first, at the start of the period
+	b.releaseHangingNotes(cycleTime)
 
 	processed := 0
 outgoingLoop:
 	for processed < 32 { // Process max 32 events per cycle
 		select {
 		case event := <-b.eventQueue:
-			event.midiData.Time = 0 // Immediate dispatch
-			if err := b.midiOutPort.MidiEventWrite(event.midiData, buffer); err != 0 {
-				debugBridge("Failed to write MIDI event: %v", err)
+			if event.at.IsZero() || sampleRate == 0 {
+				event.midiData.Time = 0 // Immediate dispatch
+				b.writeMidi(event.port, event.midiData)
+				b.pendingMidi.Add(-1)
+			} else if !b.scheduler.push(frameForTime(event.at, cycleTime, cycleFrame, sampleRate), event) {
+				debugBridge("MIDI scheduler full, dropping timetagged event")
+				b.pendingMidi.Add(-1)
 			}
 			processed++
 		default:
@@ -139,86 +610,253 @@ outgoingLoop:
 		debugBridge("MIDI queue overflow, processed 32 events")
 	}
 
+	// Scheduled events due in this period merged with generated clock, in
+	// frame order; late events go out at the start of the period.
+	var ticks []clockEvent
+	if b.clock != nil {
+		var transport *transportPosition
+		if position, ok := b.backend.Transport(); ok {
+			transport = &position
+		}
+		ticks = b.clock.advance(nframes, sampleRate, transport)
+	}
+	periodEnd := cycleFrame + nframes
+	for {
+		offset, due := uint32(0), false
+		if frame, ok := b.scheduler.peek(); ok && frameBefore(frame, periodEnd) {
+			due = true
+			if !frameBefore(frame, cycleFrame) {
+				offset = frame - cycleFrame
+			}
+		}
+
+		if due && (len(ticks) == 0 || offset <= ticks[0].offset) {
+			event := b.scheduler.pop()
+			event.midiData.Time = offset
+			b.writeMidi(event.port, event.midiData)
+			b.pendingMidi.Add(-1)
+		} else if len(ticks) > 0 {
+			b.clockOut.Time = ticks[0].offset
+			b.clockOut.Buffer = ticks[0].appendTo(b.clockOut.Buffer[:0])
+			for _, port := range b.outPorts {
+				b.writeMidi(port, b.clockOut)
+			}
+			ticks = ticks[1:]
+		} else {
+			break
+		}
+	}
+
 	// Handle incoming MIDI (MIDI → OSC)
-	incomingEvents := b.midiInPort.GetMidiEvents(nframes)
-	for _, event := range incomingEvents {
-		if oscMsg := b.parseIncomingMIDI(event); oscMsg != nil {
-			select {
-			case b.oscOutQueue <- oscMsg:
-				// Message queued successfully
-			default:
-				// Buffer full - drop message (no blocking in RT callback)
-				debugBridge("OSC output queue full, dropping message")
+	for _, port := range b.inPorts {
+		incomingEvents := port.port.ReadEvents(nframes)
+		for _, event := range incomingEvents {
+			for _, oscMsg := range b.parseIncomingEvent(port, event) {
+				b.queueOSC(port, oscMsg)
 			}
 		}
+		// MSBs still waiting for an LSB go out on their own
+		for _, oscMsg := range b.controllerOSC(port.controllers.flushAll(nil)) {
+			b.queueOSC(port, oscMsg)
+		}
 	}
 
 	return 0
 }
 
+// queueOSC queues a message received on an input port for the OSC sender.
+func (b *Bridge) queueOSC(port *bridgePort, oscMsg *osc.Message) {
+	oscMsg.Address = port.prefix + oscMsg.Address
+	select {
+	case b.oscOutQueue <- oscMsg:
+		// Message queued successfully
+	default:
+		// Buffer full - drop message (no blocking in RT callback)
+		debugBridge("OSC output queue full, dropping message")
+	}
+}
+
+// writeMidi writes one event to an output port at its Time offset; a nil
+// port means the first. An event holding several channel messages, such as
+// an RPN sequence, is written as consecutive events at the same offset.
+func (b *Bridge) writeMidi(port *bridgePort, data *jack.MidiData) {
+	if port == nil {
+		port = b.outPorts[0]
+	}
+	if len(data.Buffer) > 0 && data.Buffer[0] >= 0x80 && data.Buffer[0] < 0xF0 &&
+		len(data.Buffer) > channelMessageLength(data.Buffer[0]&0xF0) {
+		b.splitOut.Time = data.Time
+		for buf := data.Buffer; len(buf) > 0; {
+			n := min(channelMessageLength(buf[0]&0xF0), len(buf))
+			b.splitOut.Buffer = buf[:n]
+			b.writeEvent(port, b.splitOut)
+			buf = buf[n:]
+		}
+		return
+	}
+	b.writeEvent(port, data)
+}
+
+func (b *Bridge) writeEvent(port *bridgePort, data *jack.MidiData) {
+	if err := port.port.WriteEvent(data); err != nil {
+		debugBridge("Port %s: %v", port.name, err)
+		return
+	}
+	port.notes.track(data.Buffer, b.periodTime.UnixNano())
+}
+
 // Start OSC sender goroutine
 func (b *Bridge) startOSCSender() {
+	b.senderDone = make(chan struct{})
 	go func() {
-		client := osc.NewClient(b.oscTargetHost, b.oscTargetPort)
-		for msg := range b.oscOutQueue {
-			if err := client.Send(msg); err != nil {
-				fmt.Printf("WARNING: Failed to send OSC message %s: %v\n", msg.Address, err)
+		defer close(b.senderDone)
+		queues := make(map[oscDestination]*oscTargetQueue)
+		defer func() {
+			// Each target's remaining messages are sent before it is closed
+			for _, q := range queues {
+				close(q.send)
+			}
+			for _, q := range queues {
+				<-q.done
+			}
+		}()
+
+		expiry := time.NewTicker(min(b.subscriptionTTL, subscriptionCheckInterval))
+		defer expiry.Stop()
+		for {
+			select {
+			case msg, ok := <-b.oscOutQueue:
+				if !ok {
+					return
+				}
+				b.sendOSC(msg, queues)
+				b.ws.broadcast(msg)
+			case now := <-expiry.C:
+				b.expireTargets(now, queues)
 			}
 		}
 	}()
 }
 
-// Parse incoming MIDI event to OSC message
-func (b *Bridge) parseIncomingMIDI(event *jack.MidiData) *osc.Message {
-	if len(event.Buffer) < 3 {
-		return nil // Invalid MIDI message
+// channelPath returns the OSC address of a channel message type, e.g.
+// /midi/1/note_on, numbered from the channel base.
+func (b *Bridge) channelPath(channel uint8, name string) string {
+	return fmt.Sprintf("/midi/%d/%s", b.oscChannel(channel), name)
+}
+
+// channelMessageLength returns the total length in bytes of a channel voice
+// message with the given status nibble.
+func channelMessageLength(status uint8) int {
+	switch status {
+	case 0xC0, 0xD0: // Program Change, Channel Pressure
+		return 2
+	default: // Note Off/On, Poly Pressure, Control Change, Pitch Bend
+		return 3
+	}
+}
+
+// Parse incoming MIDI event received on an input port to OSC message
+func (b *Bridge) parseIncomingMIDI(port *bridgePort, event *jack.MidiData) *osc.Message {
+	if len(event.Buffer) == 0 || event.Buffer[0] < 0x80 {
+		return nil // No status byte
+	}
+	if event.Buffer[0] >= 0xF0 {
+		return b.parseSystemMessage(port, event.Buffer)
 	}
 
 	status := event.Buffer[0] & 0xF0
 	channel := event.Buffer[0] & 0x0F
-	note := event.Buffer[1] & 0x7F
-	velocity := event.Buffer[2] & 0x7F
+	if len(event.Buffer) < channelMessageLength(status) {
+		return nil // Invalid MIDI message
+	}
+
+	// Mapped messages replace the default /midi paths
+	if msg := b.mapIncomingEvent(event.Buffer); msg != nil {
+		return msg
+	}
+
+	data1 := event.Buffer[1] & 0x7F
+
+	switch status {
+	case 0xC0: // Program Change
+		return osc.NewMessage(b.channelPath(channel, "program"), int32(data1))
+	case 0xD0: // Channel Pressure
+		return osc.NewMessage(b.channelPath(channel, "channel_pressure"), int32(data1))
+	}
+
+	data2 := event.Buffer[2] & 0x7F
 
 	var path string
 	switch status {
 	case 0x90: // Note On
-		if velocity == 0 {
-			path = fmt.Sprintf("/midi/%d/note_off", channel)
+		if data2 == 0 {
+			path = b.channelPath(channel, "note_off")
 		} else {
-			path = fmt.Sprintf("/midi/%d/note_on", channel)
+			path = b.channelPath(channel, "note_on")
 		}
 	case 0x80: // Note Off
-		path = fmt.Sprintf("/midi/%d/note_off", channel)
-	default:
-		return nil // Only handle note messages
+		path = b.channelPath(channel, "note_off")
+	case 0xA0: // Polyphonic Key Pressure
+		path = b.channelPath(channel, "poly_pressure")
+	case 0xB0: // Control Change
+		path = b.channelPath(channel, "cc")
+	case 0xE0: // Pitch Bend: LSB, MSB
+		path = b.channelPath(channel, "pitch_bend")
+		value := uint16(data2)<<7 | uint16(data1)
+		return osc.NewMessage(path, pitchBendArgument(value, b.pitchBendFormat))
 	}
 
-	return osc.NewMessage(path, int32(note), int32(velocity))
+	return osc.NewMessage(path, int32(data1), int32(data2))
 }
 
-// List available JACK MIDI ports
-func ListJackPorts() error {
-	client, status := jack.ClientOpen("osc-midi-bridge-list", jack.NoStartServer)
-	if status != 0 {
-		return fmt.Errorf("cannot connect to JACK server: %s", jack.StrError(status))
+// mapIncomingEvent returns the mapped OSC message for a complete channel
+// voice message, or nil if no mapping applies.
+func (b *Bridge) mapIncomingEvent(data []byte) *osc.Message {
+	status, channel := data[0]&0xF0, data[0]&0x0F
+	if status == 0x90 && data[2]&0x7F == 0 {
+		status = 0x80 // Note On with velocity 0 is a Note Off
 	}
-	defer client.Close()
-
-	// Get all MIDI ports
-	ports := client.GetPorts("", jack.DEFAULT_MIDI_TYPE, 0)
-
-	fmt.Println("Available JACK MIDI ports:")
-	fmt.Println("==========================")
+	return b.mapIncomingMIDI(status, channel, data[1:])
+}
 
-	if len(ports) == 0 {
-		fmt.Println("No MIDI ports found")
-	} else {
-		for i, port := range ports {
-			// For now, just print the port name
-			// TODO: Add direction detection when available in go-jack
-			fmt.Printf("%d. %s\n", i+1, port)
+// Parse an incoming system message (SysEx, System Common or Real-Time).
+// Clock ticks are counted per input port, so clock sources on different
+// ports are thinned independently.
+func (b *Bridge) parseSystemMessage(port *bridgePort, data []byte) *osc.Message {
+	switch data[0] {
+	case 0xF0: // System Exclusive: forwarded whole as a blob
+		if err := validateSysEx(data); err != nil {
+			debugBridge("Dropping malformed sysex: %v", err)
+			return nil
+		}
+		return osc.NewMessage("/midi/sysex", data)
+	case 0xF2: // Song Position Pointer: LSB, MSB
+		if len(data) < 3 {
+			return nil
 		}
+		beats := uint32(data[2]&0x7F)<<7 | uint32(data[1]&0x7F)
+		port.clockTicks = beats * 6 // Keep clock thinning aligned to the new position
+		return osc.NewMessage("/midi/song_position", int32(beats))
+	case 0xF3: // Song Select
+		if len(data) < 2 {
+			return nil
+		}
+		return osc.NewMessage("/midi/song_select", int32(data[1]&0x7F))
+	case 0xF8: // Timing Clock, thinned to every clockDivider-th tick
+		tick := port.clockTicks
+		port.clockTicks++
+		if b.clockDivider > 1 && tick%b.clockDivider != 0 {
+			return nil
+		}
+		return osc.NewMessage("/midi/clock")
+	case 0xFA: // Start
+		port.clockTicks = 0
+		return osc.NewMessage("/midi/start")
+	case 0xFB: // Continue
+		return osc.NewMessage("/midi/continue")
+	case 0xFC: // Stop
+		return osc.NewMessage("/midi/stop")
+	default:
+		return nil // Other system messages are not bridged
 	}
-
-	return nil
 }
@@ -1,7 +1,12 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
 	"testing"
+	"time"
 
 	"github.com/hypebeast/go-osc/osc"
 	"github.com/xthexder/go-jack"
@@ -9,21 +14,33 @@ import (
 
 func TestExtractChannel(t *testing.T) {
 	tests := []struct {
-		address  string
-		expected uint8
+		address     string
+		channelBase uint8
+		expected    uint8
+		wantErr     bool
 	}{
-		{"/midi/0/note_on", 0},
-		{"/midi/5/note_off", 5},
-		{"/midi/15/cc", 15},
-		{"/midi/16/note_on", 0}, // Should wrap or handle invalid channel
-		{"/invalid/path", 0},    // Should handle gracefully
+		{"/midi/0/note_on", 0, 0, false},
+		{"/midi/5/note_off", 0, 5, false},
+		{"/midi/15/cc", 0, 15, false},
+		{"/midi/16/note_on", 0, 0, true}, // Out of range, not channel 0
+		{"/midi/-1/note_on", 0, 0, true},
+		{"/midi/x/note_on", 0, 0, true},
+		{"/invalid/path", 0, 0, true},
+		{"/midi/1/note_on", 1, 0, false},
+		{"/midi/16/cc", 1, 15, false},
+		{"/midi/0/note_on", 1, 0, true},
+		{"/midi/17/note_on", 1, 0, true},
 	}
 
-	bridge := &Bridge{}
 	for _, tt := range tests {
-		result := bridge.extractChannel(tt.address)
+		bridge := &Bridge{channelBase: tt.channelBase}
+		result, err := bridge.extractChannel(tt.address)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("extractChannel(%s) with base %d: error = %v, wantErr %v", tt.address, tt.channelBase, err, tt.wantErr)
+			continue
+		}
 		if result != tt.expected {
-			t.Errorf("extractChannel(%s) = %d, expected %d", tt.address, result, tt.expected)
+			t.Errorf("extractChannel(%s) with base %d = %d, expected %d", tt.address, tt.channelBase, result, tt.expected)
 		}
 	}
 }
@@ -58,6 +75,7 @@ func TestMidiEvent(t *testing.T) {
 }
 
 func TestParseIncomingMIDI(t *testing.T) {
+	port := &bridgePort{}
 	bridge := &Bridge{}
 
 	tests := []struct {
@@ -98,8 +116,37 @@ func TestParseIncomingMIDI(t *testing.T) {
 			shouldBeNil: true,
 		},
 		{
-			name:        "Unsupported MIDI message - CC",
-			midiData:    []byte{0xB0, 0x07, 0x7F}, // Control Change
+			name:         "Control Change - Channel 0",
+			midiData:     []byte{0xB0, 0x07, 0x7F}, // Control Change, volume, max
+			expectedPath: "/midi/0/cc",
+			expectedNote: 7,
+			expectedVel:  127,
+			shouldBeNil:  false,
+		},
+		{
+			name:         "Control Change - Channel 9",
+			midiData:     []byte{0xB9, 0x0A, 0x40}, // Control Change, pan, center
+			expectedPath: "/midi/9/cc",
+			expectedNote: 10,
+			expectedVel:  64,
+			shouldBeNil:  false,
+		},
+		{
+			name:         "Poly Pressure - Channel 2",
+			midiData:     []byte{0xA2, 0x3C, 0x55}, // Poly Pressure, Middle C, 85
+			expectedPath: "/midi/2/poly_pressure",
+			expectedNote: 60,
+			expectedVel:  85,
+			shouldBeNil:  false,
+		},
+		{
+			name:        "Unsupported MIDI message - MTC Quarter Frame",
+			midiData:    []byte{0xF1, 0x05}, // System Common
+			shouldBeNil: true,
+		},
+		{
+			name:        "Invalid MIDI - running status data byte",
+			midiData:    []byte{0x3C, 0x7F}, // No status byte
 			shouldBeNil: true,
 		},
 		{
@@ -118,7 +165,7 @@ func TestParseIncomingMIDI(t *testing.T) {
 				Buffer: tt.midiData,
 			}
 
-			result := bridge.parseIncomingMIDI(event)
+			result := bridge.parseIncomingMIDI(port, event)
 
 			if tt.shouldBeNil {
 				if result != nil {
@@ -199,3 +246,640 @@ func TestOSCQueueHandling(t *testing.T) {
 		t.Error("Expected to receive from closed channel")
 	}
 }
+
+func TestParseIncomingPitchBend(t *testing.T) {
+	port := &bridgePort{}
+	tests := []struct {
+		name     string
+		format   string
+		midiData []byte
+		expected interface{}
+	}{
+		{"signed center", "", []byte{0xE0, 0x00, 0x40}, int32(0)},
+		{"signed minimum", pitchBendSigned, []byte{0xE0, 0x00, 0x00}, int32(-8192)},
+		{"signed maximum", pitchBendSigned, []byte{0xE0, 0x7F, 0x7F}, int32(8191)},
+		{"unsigned", pitchBendUnsigned, []byte{0xE0, 0x01, 0x40}, int32(8193)},
+		{"float maximum", pitchBendFloat, []byte{0xE0, 0x7F, 0x7F}, float32(1)},
+		{"float minimum", pitchBendFloat, []byte{0xE0, 0x00, 0x00}, float32(-1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bridge := &Bridge{pitchBendFormat: tt.format}
+			result := bridge.parseIncomingMIDI(port, &jack.MidiData{Buffer: tt.midiData})
+			if result == nil {
+				t.Fatal("Expected pitch bend message, got nil")
+			}
+			if result.Address != "/midi/0/pitch_bend" {
+				t.Errorf("Expected path /midi/0/pitch_bend, got %s", result.Address)
+			}
+			if len(result.Arguments) != 1 || result.Arguments[0] != tt.expected {
+				t.Errorf("Expected argument %v (%T), got %v", tt.expected, tt.expected, result.Arguments)
+			}
+		})
+	}
+}
+
+func TestParseIncomingTwoByteMessages(t *testing.T) {
+	port := &bridgePort{}
+	bridge := &Bridge{}
+
+	tests := []struct {
+		name         string
+		midiData     []byte
+		expectedPath string
+		expectedArg  int32
+	}{
+		{"Program Change", []byte{0xC0, 0x05}, "/midi/0/program", 5},
+		{"Program Change - Channel 9", []byte{0xC9, 0x7F}, "/midi/9/program", 127},
+		{"Channel Pressure", []byte{0xD3, 0x40}, "/midi/3/channel_pressure", 64},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := bridge.parseIncomingMIDI(port, &jack.MidiData{Buffer: tt.midiData})
+			if result == nil {
+				t.Fatal("Expected non-nil result")
+			}
+			if result.Address != tt.expectedPath {
+				t.Errorf("Expected path %s, got %s", tt.expectedPath, result.Address)
+			}
+			if len(result.Arguments) != 1 || result.Arguments[0] != tt.expectedArg {
+				t.Errorf("Expected single argument %d, got %v", tt.expectedArg, result.Arguments)
+			}
+		})
+	}
+
+	// A lone status byte is too short for any channel message
+	if result := bridge.parseIncomingMIDI(port, &jack.MidiData{Buffer: []byte{0xC0}}); result != nil {
+		t.Errorf("Expected nil for truncated program change, got %v", result)
+	}
+}
+
+func TestParseIncomingSysEx(t *testing.T) {
+	port := &bridgePort{}
+	bridge := &Bridge{}
+
+	// Arbitrary length dumps are forwarded whole
+	dump := make([]byte, 300)
+	dump[0] = 0xF0
+	for i := 1; i < len(dump)-1; i++ {
+		dump[i] = byte(i & 0x7F)
+	}
+	dump[len(dump)-1] = 0xF7
+
+	result := bridge.parseIncomingMIDI(port, &jack.MidiData{Buffer: dump})
+	if result == nil {
+		t.Fatal("Expected sysex message, got nil")
+	}
+	if result.Address != "/midi/sysex" {
+		t.Errorf("Expected path /midi/sysex, got %s", result.Address)
+	}
+	blob, ok := result.Arguments[0].([]byte)
+	if !ok || !bytes.Equal(blob, dump) {
+		t.Errorf("Expected sysex blob of %d bytes, got %v", len(dump), result.Arguments)
+	}
+
+	// Malformed framing is dropped
+	for _, data := range [][]byte{
+		{0xF0, 0x41, 0x10},
+		{0xF0, 0x41, 0x80, 0xF7},
+	} {
+		if result := bridge.parseIncomingMIDI(port, &jack.MidiData{Buffer: data}); result != nil {
+			t.Errorf("Expected nil for malformed sysex % X, got %v", data, result)
+		}
+	}
+}
+
+func TestParseIncomingSystemMessages(t *testing.T) {
+	port := &bridgePort{}
+	bridge := &Bridge{}
+
+	tests := []struct {
+		name         string
+		midiData     []byte
+		expectedPath string
+		expectedArgs []interface{}
+	}{
+		{"Clock", []byte{0xF8}, "/midi/clock", nil},
+		{"Start", []byte{0xFA}, "/midi/start", nil},
+		{"Continue", []byte{0xFB}, "/midi/continue", nil},
+		{"Stop", []byte{0xFC}, "/midi/stop", nil},
+		{"Song Position", []byte{0xF2, 0x10, 0x02}, "/midi/song_position", []interface{}{int32(272)}},
+		{"Song Select", []byte{0xF3, 0x05}, "/midi/song_select", []interface{}{int32(5)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := bridge.parseIncomingMIDI(port, &jack.MidiData{Buffer: tt.midiData})
+			if result == nil {
+				t.Fatal("Expected non-nil result")
+			}
+			if result.Address != tt.expectedPath {
+				t.Errorf("Expected path %s, got %s", tt.expectedPath, result.Address)
+			}
+			if len(result.Arguments) != len(tt.expectedArgs) {
+				t.Fatalf("Expected %d arguments, got %v", len(tt.expectedArgs), result.Arguments)
+			}
+			for i, arg := range tt.expectedArgs {
+				if result.Arguments[i] != arg {
+					t.Errorf("Expected argument %d to be %v, got %v", i, arg, result.Arguments[i])
+				}
+			}
+		})
+	}
+
+	// Truncated system common messages and unbridged system messages are dropped
+	for _, data := range [][]byte{{0xF2, 0x10}, {0xF3}, {0xFE}, {0xFF}} {
+		if result := bridge.parseIncomingMIDI(port, &jack.MidiData{Buffer: data}); result != nil {
+			t.Errorf("Expected nil for % X, got %v", data, result)
+		}
+	}
+}
+
+func TestClockDivider(t *testing.T) {
+	port := &bridgePort{}
+	bridge := &Bridge{clockDivider: 24}
+	clock := &jack.MidiData{Buffer: []byte{0xF8}}
+
+	countClocks := func(ticks int) int {
+		emitted := 0
+		for i := 0; i < ticks; i++ {
+			if bridge.parseIncomingMIDI(port, clock) != nil {
+				emitted++
+			}
+		}
+		return emitted
+	}
+
+	// Start resets the count so the first tick of every quarter note is emitted
+	bridge.parseIncomingMIDI(port, &jack.MidiData{Buffer: []byte{0xFA}})
+	if emitted := countClocks(96); emitted != 4 {
+		t.Errorf("Expected 4 clocks for 4 quarter notes, got %d", emitted)
+	}
+
+	// Song position re-aligns the count: 2 MIDI beats (12 ticks) into a quarter note
+	bridge.parseIncomingMIDI(port, &jack.MidiData{Buffer: []byte{0xF2, 0x02, 0x00}})
+	if emitted := countClocks(12); emitted != 0 {
+		t.Errorf("Expected no clocks before the next quarter note, got %d", emitted)
+	}
+	if emitted := countClocks(1); emitted != 1 {
+		t.Errorf("Expected a clock on the quarter note boundary, got %d", emitted)
+	}
+
+	// A divider of 0 or 1 emits every tick
+	bridge = &Bridge{}
+	if emitted := countClocks(10); emitted != 10 {
+		t.Errorf("Expected every tick without a divider, got %d", emitted)
+	}
+
+	// Each input port counts its own ticks: a song position on one doesn't
+	// move the other's quarter notes
+	bridge = &Bridge{clockDivider: 24}
+	first, second := &bridgePort{}, &bridgePort{}
+	bridge.parseIncomingMIDI(first, &jack.MidiData{Buffer: []byte{0xFA}})
+	bridge.parseIncomingMIDI(second, &jack.MidiData{Buffer: []byte{0xFA}})
+	bridge.parseIncomingMIDI(first, &jack.MidiData{Buffer: []byte{0xF2, 0x02, 0x00}})
+	if bridge.parseIncomingMIDI(second, clock) == nil {
+		t.Error("Expected the second port's clock on its quarter note")
+	}
+	if bridge.parseIncomingMIDI(first, clock) != nil {
+		t.Error("Expected no clock from the first port between quarter notes")
+	}
+}
+
+// newTestBridge creates a bridge on a fake backend running at 48kHz, with
+// outgoing OSC sent to a local UDP socket.
+func newTestBridge(t *testing.T, cfg Config) (*Bridge, *fakeBackend, *net.UDPConn) {
+	t.Helper()
+
+	conn := listenOSC(t)
+	if cfg.ClientName == "" {
+		cfg.ClientName = "test"
+	}
+	if cfg.PortName == "" {
+		cfg.PortName = "midi_out"
+	}
+	cfg.OSCTargetHost = "127.0.0.1"
+	cfg.OSCTargetPort = conn.LocalAddr().(*net.UDPAddr).Port
+
+	backend := newFakeBackend(48000)
+	bridge, err := newBridge(cfg, backend.opener())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := bridge.Cleanup(); err != nil {
+			t.Errorf("Cleanup failed: %v", err)
+		}
+	})
+	return bridge, backend, conn
+}
+
+// listenOSC opens a local UDP socket to receive the bridge's OSC output.
+func listenOSC(t *testing.T) *net.UDPConn {
+	t.Helper()
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("Cannot listen for OSC: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// receiveOSC reads one OSC message sent by the bridge.
+func receiveOSC(t *testing.T, conn *net.UDPConn) *osc.Message {
+	t.Helper()
+
+	buf := make([]byte, 65536)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("No OSC message received: %v", err)
+	}
+	packet, err := osc.ParsePacket(string(buf[:n]))
+	if err != nil {
+		t.Fatalf("Invalid OSC packet: %v", err)
+	}
+	msg, ok := packet.(*osc.Message)
+	if !ok {
+		t.Fatalf("Expected an OSC message, got %T", packet)
+	}
+	return msg
+}
+
+func TestBridgeOSCToMIDI(t *testing.T) {
+	bridge, backend, _ := newTestBridge(t, Config{PitchBendFormat: pitchBendSigned})
+	out := backend.port("midi_out")
+
+	bridge.dispatcher.Dispatch(osc.NewMessage("/midi/0/note_on", int32(60), int32(100)))
+	bridge.dispatcher.Dispatch(osc.NewMessage("/midi/1/cc", int32(7), int32(90)))
+	backend.cycle(64)
+
+	if len(out.written) != 2 {
+		t.Fatalf("Expected 2 MIDI events, got %v", out.written)
+	}
+	if !bytes.Equal(out.written[0].Buffer, []byte{0x90, 60, 100}) || !bytes.Equal(out.written[1].Buffer, []byte{0xB1, 7, 90}) {
+		t.Errorf("Unexpected MIDI output: % X, % X", out.written[0].Buffer, out.written[1].Buffer)
+	}
+
+	// Nothing is written again in the next period
+	backend.cycle(64)
+	if len(out.written) != 0 {
+		t.Errorf("Expected no MIDI in an idle period, got %v", out.written)
+	}
+}
+
+func TestBridgeMIDIToOSC(t *testing.T) {
+	_, backend, conn := newTestBridge(t, Config{PitchBendFormat: pitchBendSigned})
+
+	backend.port("midi_in").send(10, 0x91, 64, 80)
+	backend.cycle(64)
+
+	msg := receiveOSC(t, conn)
+	if msg.Address != "/midi/1/note_on" {
+		t.Errorf("Expected /midi/1/note_on, got %s", msg.Address)
+	}
+	if len(msg.Arguments) != 2 || msg.Arguments[0] != int32(64) || msg.Arguments[1] != int32(80) {
+		t.Errorf("Expected [64 80], got %v", msg.Arguments)
+	}
+}
+
+func TestBridgeBundleScheduling(t *testing.T) {
+	bridge, backend, _ := newTestBridge(t, Config{PitchBendFormat: pitchBendSigned})
+	out := backend.port("midi_out")
+
+	// 100ms ahead is 4800 frames at 48kHz, i.e. 75 periods of 64 frames
+	bundle := osc.NewBundle(time.Now().Add(100 * time.Millisecond))
+	bundle.Append(osc.NewMessage("/midi/0/note_on", int32(60), int32(100)))
+	bridge.dispatcher.Dispatch(bundle)
+
+	written := 0
+	for cycle := 0; cycle < 100; cycle++ {
+		backend.cycle(64)
+		if len(out.written) == 0 {
+			continue
+		}
+		if cycle < 60 {
+			t.Fatalf("Bundled note played early, in period %d", cycle)
+		}
+		written += len(out.written)
+	}
+	if written != 1 {
+		t.Errorf("Expected the bundled note once, got %d events", written)
+	}
+}
+
+func TestBridgeClockOutput(t *testing.T) {
+	// 120 BPM at 48kHz is one tick every 1000 frames
+	_, backend, _ := newTestBridge(t, Config{PitchBendFormat: pitchBendSigned, ClockBPM: 120})
+	out := backend.port("midi_out")
+
+	backend.cycle(2048)
+	var offsets []uint32
+	for _, event := range out.written {
+		if event.Buffer[0] == 0xF8 {
+			offsets = append(offsets, event.Time)
+		}
+	}
+	if len(offsets) != 3 || offsets[0] != 0 || offsets[1] != 1000 || offsets[2] != 2000 {
+		t.Errorf("Expected ticks at 0, 1000 and 2000, got %v", offsets)
+	}
+}
+
+func TestBridgeClockFollowsTransport(t *testing.T) {
+	_, backend, _ := newTestBridge(t, Config{PitchBendFormat: pitchBendSigned, ClockBPM: 120})
+	out := backend.port("midi_out")
+
+	// A transport starting at beat 3 of bar 1 in 4/4 continues from the
+	// eighth MIDI beat
+	backend.transport = &transportPosition{
+		rolling:      true,
+		bbt:          true,
+		bar:          1,
+		beat:         3,
+		beatsPerBar:  4,
+		beatType:     4,
+		ticksPerBeat: 1920,
+		bpm:          120,
+	}
+	backend.cycle(64)
+	if len(out.written) < 3 || !bytes.Equal(out.written[0].Buffer, []byte{0xF2, 8, 0}) ||
+		!bytes.Equal(out.written[1].Buffer, []byte{0xFB}) || !bytes.Equal(out.written[2].Buffer, []byte{0xF8}) {
+		t.Fatalf("Expected song position 8, continue and a tick, got %v", out.written)
+	}
+
+	backend.transport.rolling = false
+	backend.cycle(64)
+	if len(out.written) != 1 || !bytes.Equal(out.written[0].Buffer, []byte{0xFC}) {
+		t.Errorf("Expected stop, got %v", out.written)
+	}
+}
+
+func TestBridgeClockOff(t *testing.T) {
+	bridge, backend, _ := newTestBridge(t, Config{PitchBendFormat: pitchBendSigned})
+	out := backend.port("midi_out")
+
+	for _, address := range []string{"/clock/start", "/clock/stop"} {
+		bridge.dispatcher.Dispatch(osc.NewMessage(address))
+	}
+	bridge.dispatcher.Dispatch(osc.NewMessage("/clock/bpm", float32(120)))
+	backend.transport = &transportPosition{rolling: true}
+	backend.cycle(48000)
+	if len(out.written) != 0 {
+		t.Errorf("Expected no clock with --clock-bpm unset, got %v", out.written)
+	}
+}
+
+func TestNewBridgeBackend(t *testing.T) {
+	// Invalid settings are rejected before the backend is opened
+	opened := false
+	_, err := newBridge(Config{PitchBendFormat: "hex"}, func(string) (midiBackend, error) {
+		opened = true
+		return newFakeBackend(48000), nil
+	})
+	if err == nil || opened {
+		t.Errorf("Expected an error without opening the backend, got %v (opened: %t)", err, opened)
+	}
+
+	// Unknown backend names are rejected
+	if _, err := NewBridge(Config{Backend: "coremidi", PitchBendFormat: pitchBendSigned}); err == nil {
+		t.Error("Expected error for an unknown backend")
+	}
+
+	// Backend errors are passed through
+	_, err = newBridge(Config{PitchBendFormat: pitchBendSigned}, func(string) (midiBackend, error) {
+		return nil, errors.New("no server")
+	})
+	if err == nil {
+		t.Error("Expected the backend error")
+	}
+
+	// Cleanup closes the backend
+	backend := newFakeBackend(48000)
+	bridge, err := newBridge(Config{PortName: "out", PitchBendFormat: pitchBendSigned}, backend.opener())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	bridge.Cleanup()
+	if !backend.closed {
+		t.Error("Expected Cleanup to close the backend")
+	}
+}
+
+func TestBridgeStartStops(t *testing.T) {
+	for _, transport := range []string{oscTransportUDP, oscTransportTCPSLIP} {
+		t.Run(transport, func(t *testing.T) {
+			bridge, backend, _ := newTestBridge(t, Config{OSCTransport: transport, PitchBendFormat: pitchBendSigned})
+
+			ctx, cancel := context.WithCancel(context.Background())
+			started := make(chan error, 1)
+			go func() { started <- bridge.Start(ctx) }()
+			for !backend.cycleActive(64) {
+				time.Sleep(time.Millisecond)
+			}
+
+			cancel()
+			select {
+			case err := <-started:
+				if err != nil {
+					t.Errorf("Expected Start to return nil when cancelled, got %v", err)
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatal("Start did not return when cancelled")
+			}
+		})
+	}
+}
+
+func TestBridgeCleanupDrainsQueue(t *testing.T) {
+	bridge, backend, _ := newTestBridge(t, Config{PitchBendFormat: pitchBendSigned})
+	out := backend.port("midi_out")
+	if err := bridge.activate(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	bridge.dispatcher.Dispatch(osc.NewMessage("/midi/0/note_on", int32(60), int32(100)))
+	bridge.dispatcher.Dispatch(osc.NewMessage("/midi/0/cc", int32(7), int32(90)))
+
+	// Run periods as the backend would until it is deactivated
+	var written [][]byte
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for backend.cycleActive(64) {
+			for _, event := range out.written {
+				written = append(written, event.Buffer)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	if err := bridge.Cleanup(); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	<-stopped
+
+	// Queued events go out, then the sounding note is released
+	want := [][]byte{{0x90, 60, 100}, {0xB0, 7, 90}, {0x80, 60, 0}}
+	if len(written) != len(want) {
+		t.Fatalf("Expected %d MIDI events, got % X", len(want), written)
+	}
+	for i := range want {
+		if !bytes.Equal(written[i], want[i]) {
+			t.Errorf("Event %d: expected % X, got % X", i, want[i], written[i])
+		}
+	}
+	if !backend.closed {
+		t.Error("Expected Cleanup to close the backend")
+	}
+	if _, ok := <-bridge.oscOutQueue; ok {
+		t.Error("Expected the OSC output queue to be closed")
+	}
+
+	// Input after Cleanup is dropped
+	bridge.dispatcher.Dispatch(osc.NewMessage("/midi/0/note_on", int32(64), int32(100)))
+	if len(bridge.eventQueue) != 0 {
+		t.Error("Expected no MIDI events after Cleanup")
+	}
+}
+
+func TestBridgeNamedPorts(t *testing.T) {
+	bridge, backend, conn := newTestBridge(t, Config{
+		PitchBendFormat: pitchBendSigned,
+		ClockBPM:        120,
+		Ports: []PortConfig{
+			{"drums", portOutput},
+			{"synth", portOutput},
+			{"keys", portInput},
+		},
+	})
+	drums, synth := backend.port("drums"), backend.port("synth")
+	if backend.port("midi_out") != nil || backend.port("midi_in") != nil {
+		t.Error("Expected no default ports when named ports are declared")
+	}
+
+	bridge.dispatcher.Dispatch(osc.NewMessage("/port/drums/midi/9/note_on", int32(36), int32(100)))
+	bridge.dispatcher.Dispatch(osc.NewMessage("/port/synth/midi/0/cc", int32(7), int32(90)))
+	bridge.dispatcher.Dispatch(osc.NewMessage("/midi/1/program", int32(5))) // First output port
+	bridge.dispatcher.Dispatch(osc.NewMessage("/port/*/midi/0/cc", int32(123), int32(0)))
+	backend.cycle(64)
+
+	// Every output port also carries the internal clock
+	withoutClock := func(events []jack.MidiData) [][]byte {
+		var data [][]byte
+		for _, event := range events {
+			if event.Buffer[0] != 0xF8 {
+				data = append(data, event.Buffer)
+			}
+		}
+		return data
+	}
+	tests := []struct {
+		port *fakePort
+		want [][]byte
+	}{
+		{drums, [][]byte{{0x99, 36, 100}, {0xC1, 5}, {0xB0, 123, 0}}},
+		{synth, [][]byte{{0xB0, 7, 90}, {0xB0, 123, 0}}},
+	}
+	for _, tt := range tests {
+		got := withoutClock(tt.port.written)
+		if len(got) != len(tt.want) {
+			t.Errorf("Port %s: expected % X, got % X", tt.port.name, tt.want, got)
+			continue
+		}
+		for i := range got {
+			if !bytes.Equal(got[i], tt.want[i]) {
+				t.Errorf("Port %s: expected % X, got % X", tt.port.name, tt.want, got)
+			}
+		}
+		if len(tt.port.written) == len(got) {
+			t.Errorf("Port %s: expected clock ticks", tt.port.name)
+		}
+	}
+
+	// Unknown ports are not handled
+	bridge.dispatcher.Dispatch(osc.NewMessage("/port/bass/midi/0/cc", int32(7), int32(90)))
+	backend.cycle(64)
+	if got := withoutClock(drums.written); len(got) != 0 {
+		t.Errorf("Expected nothing written for an unknown port, got % X", got)
+	}
+
+	// Input from a named port carries its prefix
+	backend.port("keys").send(0, 0x90, 60, 100)
+	backend.cycle(64)
+	if msg := receiveOSC(t, conn); msg.Address != "/port/keys/midi/0/note_on" {
+		t.Errorf("Expected /port/keys/midi/0/note_on, got %s", msg.Address)
+	}
+}
+
+func TestBridgeDuplicatePorts(t *testing.T) {
+	_, err := newBridge(Config{
+		PitchBendFormat: pitchBendSigned,
+		Ports:           []PortConfig{{"a", portOutput}, {"a", portInput}},
+	}, newFakeBackend(48000).opener())
+	if err == nil {
+		t.Error("Expected error for a port declared twice")
+	}
+}
+
+func TestBridgeAutoConnect(t *testing.T) {
+	backend := newFakeBackend(48000)
+	backend.addExternalPort("synth:in", portInput)
+	backend.addExternalPort("keys:out", portOutput)
+	backend.addExternalPort("other:in", portInput)
+
+	bridge, err := newBridge(Config{
+		ClientName:      "bridge",
+		PortName:        "midi_out",
+		InPortName:      "from_keys",
+		PitchBendFormat: pitchBendSigned,
+		ConnectOut:      "^synth:",
+		ConnectIn:       "^keys:",
+	}, backend.opener())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	t.Cleanup(func() { bridge.Cleanup() })
+	if backend.port("from_keys") == nil {
+		t.Fatal("Expected input port from_keys")
+	}
+	if err := bridge.activate(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		source, destination string
+		want                bool
+	}{
+		{"bridge:midi_out", "synth:in", true},
+		{"keys:out", "bridge:from_keys", true},
+		{"bridge:midi_out", "other:in", false},
+	}
+	for _, tt := range tests {
+		if got := backend.connected(tt.source, tt.destination); got != tt.want {
+			t.Errorf("Connected %s -> %s: expected %t, got %t", tt.source, tt.destination, tt.want, got)
+		}
+	}
+
+	// A port appearing later is connected by the watcher
+	backend.addExternalPort("synth:in2", portInput)
+	deadline := time.Now().Add(time.Second)
+	for !backend.connected("bridge:midi_out", "synth:in2") {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected bridge:midi_out -> synth:in2 after the port appeared")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestBridgeInvalidConnectPattern(t *testing.T) {
+	_, err := newBridge(Config{
+		PitchBendFormat: pitchBendSigned,
+		ConnectOut:      "(",
+	}, newFakeBackend(48000).opener())
+	if err == nil {
+		t.Error("Expected error for an invalid connect-out pattern")
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"math"
+	"sync/atomic"
+)
+
+const (
+	clockPPQN    = 24   // MIDI clock ticks per quarter note
+	maxClockBPM  = 1000 // Upper bound accepted for the internal clock
+	clockMaxOuts = 256  // Capacity of the per-period output buffer
+)
+
+// Pending transport commands, set from the OSC side and consumed in advance
+const (
+	clockNoCommand uint32 = iota
+	clockStartCommand
+	clockStopCommand
+)
+
+// clockEvent is a System Real-Time byte, or a Song Position Pointer,
+// placed at a frame offset within the current period.
+type clockEvent struct {
+	offset   uint32
+	status   byte
+	position uint16 // Song position in MIDI beats, for 0xF2
+}
+
+// appendTo appends the event's MIDI bytes to buf.
+func (e clockEvent) appendTo(buf []byte) []byte {
+	if e.status == 0xF2 {
+		return append(buf, 0xF2, byte(e.position&0x7F), byte(e.position>>7))
+	}
+	return append(buf, e.status)
+}
+
+// clockGenerator produces sample-accurate MIDI clock (0xF8) ticks from the
+// frame counter. Tempo and transport are changed with atomics from any
+// goroutine, or follow the backend's transport when it has one; advance is
+// only called from the real-time process thread and never allocates.
+type clockGenerator struct {
+	bpm     atomic.Uint64 // math.Float64bits of the tempo; 0 disables ticks
+	command atomic.Uint32 // Pending clock*Command
+
+	// Real-time thread state
+	framesPerTick float64      // Tick spacing at the tempo last used
+	nextTick      float64      // Frames from the start of the next period to the next tick
+	rolling       bool         // Backend transport state in the previous period
+	events        []clockEvent // Reused output buffer
+}
+
+func newClockGenerator(bpm float64) *clockGenerator {
+	c := &clockGenerator{
+		events: make([]clockEvent, 0, clockMaxOuts),
+	}
+	c.bpm.Store(math.Float64bits(bpm))
+	return c
+}
+
+// SetBPM changes the tempo; it takes effect at the next period without
+// moving the phase of the tick in progress.
+func (c *clockGenerator) SetBPM(bpm float64) {
+	c.bpm.Store(math.Float64bits(bpm))
+}
+
+func (c *clockGenerator) BPM() float64 {
+	return math.Float64frombits(c.bpm.Load())
+}
+
+// Start queues a MIDI Start (0xFA) and restarts the tick phase so the next
+// tick lands on the downbeat.
+func (c *clockGenerator) Start() {
+	c.command.Store(clockStartCommand)
+}
+
+// Stop queues a MIDI Stop (0xFC). Ticks keep running so followers stay
+// locked to the tempo, as hardware clock masters do.
+func (c *clockGenerator) Stop() {
+	c.command.Store(clockStopCommand)
+}
+
+// advance returns the clock events falling within a period of nframes at
+// the given sample rate, in ascending offset order. A non-nil transport is
+// the backend's, which the clock then follows. The returned slice is only
+// valid until the next call.
+func (c *clockGenerator) advance(nframes, sampleRate uint32, transport *transportPosition) []clockEvent {
+	c.events = c.events[:0]
+
+	switch c.command.Swap(clockNoCommand) {
+	case clockStartCommand:
+		c.events = append(c.events, clockEvent{status: 0xFA})
+		c.nextTick = 0
+	case clockStopCommand:
+		c.events = append(c.events, clockEvent{status: 0xFC})
+	}
+
+	bpm := c.BPM()
+	if transport != nil && transport.bbt && transport.bpm > 0 && transport.beatType > 0 {
+		bpm = transport.bpm * 4 / transport.beatType // Ticks count quarter notes
+	}
+	framesPerTick := 0.0
+	if bpm > 0 && sampleRate > 0 {
+		framesPerTick = float64(sampleRate) * 60 / (bpm * clockPPQN)
+		if c.framesPerTick > 0 && framesPerTick != c.framesPerTick {
+			// Keep the fraction of the current tick interval that has
+			// elapsed, so a tempo change never produces a doubled or
+			// skipped tick.
+			c.nextTick *= framesPerTick / c.framesPerTick
+		}
+	}
+	c.framesPerTick = framesPerTick
+
+	if transport != nil {
+		c.follow(transport, bpm, sampleRate)
+	}
+	if framesPerTick == 0 {
+		return c.events
+	}
+
+	for c.nextTick < float64(nframes) && len(c.events) < cap(c.events) {
+		c.events = append(c.events, clockEvent{offset: uint32(c.nextTick), status: 0xF8})
+		c.nextTick += framesPerTick
+	}
+	c.nextTick -= float64(nframes)
+	if c.nextTick < 0 {
+		c.nextTick = 0 // Output buffer was full; resume at the next period
+	}
+
+	return c.events
+}
+
+// follow sends Start or Stop when the transport starts or stops rolling.
+// A transport that starts past its beginning gets a Song Position Pointer
+// and Continue instead, with the first tick placed where the song reaches
+// that position.
+func (c *clockGenerator) follow(transport *transportPosition, bpm float64, sampleRate uint32) {
+	if transport.rolling == c.rolling {
+		return
+	}
+	c.rolling = transport.rolling
+	if !transport.rolling {
+		c.events = append(c.events, clockEvent{status: 0xFC})
+		return
+	}
+
+	// Song position counts MIDI beats, sixteenth notes of six ticks each
+	sixteenths := transportQuarterNotes(transport, bpm, sampleRate) * 4
+	if sixteenths <= 0 {
+		c.events = append(c.events, clockEvent{status: 0xFA})
+		c.nextTick = 0
+		return
+	}
+	position := min(math.Ceil(sixteenths), 0x3FFF)
+	c.events = append(c.events, clockEvent{status: 0xF2, position: uint16(position)}, clockEvent{status: 0xFB})
+	c.nextTick = max(position-sixteenths, 0) * 6 * c.framesPerTick
+}
+
+// transportQuarterNotes returns the transport position in quarter notes,
+// from its BBT position if it has one and otherwise from its frame at the
+// given tempo.
+func transportQuarterNotes(transport *transportPosition, bpm float64, sampleRate uint32) float64 {
+	if transport.bbt && transport.beatType > 0 && transport.ticksPerBeat > 0 {
+		beats := float64(transport.bar-1)*transport.beatsPerBar + float64(transport.beat-1) +
+			float64(transport.tick)/transport.ticksPerBeat
+		return beats * 4 / transport.beatType
+	}
+	if sampleRate == 0 {
+		return 0
+	}
+	return float64(transport.frame) / float64(sampleRate) * bpm / 60
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+// runClock drives the generator over totalFrames in periods of nframes,
+// following transport if it is non-nil, and returns the absolute frame of
+// every event with the given status.
+func runClock(c *clockGenerator, transport *transportPosition, frame *uint32, totalFrames, nframes, sampleRate uint32, status byte) []uint32 {
+	var frames []uint32
+	for end := *frame + totalFrames; *frame < end; *frame += nframes {
+		for _, ev := range c.advance(nframes, sampleRate, transport) {
+			if ev.offset >= nframes {
+				panic("clock event outside period")
+			}
+			if ev.status == status {
+				frames = append(frames, *frame+ev.offset)
+			}
+		}
+	}
+	return frames
+}
+
+func TestClockGeneratorTickSpacing(t *testing.T) {
+	tests := []struct {
+		name       string
+		bpm        float64
+		sampleRate uint32
+		nframes    uint32
+		spacing    uint32
+	}{
+		{"120 BPM at 48kHz, 64-frame periods", 120, 48000, 64, 1000},
+		{"125 BPM at 48kHz, 1024-frame periods", 125, 48000, 1024, 960},
+		{"150 BPM at 44.1kHz, 256-frame periods", 150, 44100, 256, 735},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newClockGenerator(tt.bpm)
+			var frame uint32
+			ticks := runClock(c, nil, &frame, tt.sampleRate, tt.nframes, tt.sampleRate, 0xF8)
+
+			expected := int(tt.bpm * clockPPQN / 60)
+			if len(ticks) < expected || len(ticks) > expected+1 {
+				t.Fatalf("Expected %d ticks in one second, got %d", expected, len(ticks))
+			}
+			for i, tick := range ticks {
+				if tick != uint32(i)*tt.spacing {
+					t.Fatalf("Tick %d at frame %d, expected %d", i, tick, uint32(i)*tt.spacing)
+				}
+			}
+		})
+	}
+}
+
+func TestClockGeneratorTempoChange(t *testing.T) {
+	c := newClockGenerator(120) // 1000 frames per tick at 48kHz
+	var frame uint32
+
+	before := runClock(c, nil, &frame, 2500, 100, 48000, 0xF8)
+	if len(before) != 3 || before[2] != 2000 {
+		t.Fatalf("Expected ticks at 0, 1000, 2000, got %v", before)
+	}
+
+	// Half way to the next tick when the tempo doubles: the next tick comes
+	// half of the new interval later, not a full old or new interval.
+	c.SetBPM(240) // 500 frames per tick
+	after := runClock(c, nil, &frame, 1500, 100, 48000, 0xF8)
+	expected := []uint32{2750, 3250, 3750}
+	if len(after) != len(expected) {
+		t.Fatalf("Expected ticks %v after tempo change, got %v", expected, after)
+	}
+	for i := range expected {
+		if after[i] != expected[i] {
+			t.Errorf("Expected ticks %v after tempo change, got %v", expected, after)
+			break
+		}
+	}
+}
+
+func TestClockGeneratorTransport(t *testing.T) {
+	c := newClockGenerator(120)
+	var frame uint32
+	runClock(c, nil, &frame, 1500, 100, 48000, 0xF8)
+
+	// Start is sent at the beginning of the next period, followed by a tick
+	c.Start()
+	events := c.advance(100, 48000, nil)
+	if len(events) != 2 || events[0] != (clockEvent{offset: 0, status: 0xFA}) || events[1] != (clockEvent{offset: 0, status: 0xF8}) {
+		t.Fatalf("Expected start then tick at offset 0, got %v", events)
+	}
+
+	// Stop is sent once; ticks continue so followers hold tempo
+	c.Stop()
+	events = c.advance(1000, 48000, nil)
+	if len(events) != 2 || events[0] != (clockEvent{offset: 0, status: 0xFC}) || events[1] != (clockEvent{offset: 900, status: 0xF8}) {
+		t.Fatalf("Expected stop at 0 and tick at 900, got %v", events)
+	}
+	if events := c.advance(1000, 48000, nil); len(events) != 1 || events[0] != (clockEvent{offset: 900, status: 0xF8}) {
+		t.Errorf("Expected only a tick after stop, got %v", events)
+	}
+}
+
+func TestClockGeneratorDisabled(t *testing.T) {
+	c := newClockGenerator(0)
+	if events := c.advance(48000, 48000, nil); len(events) != 0 {
+		t.Errorf("Expected no ticks with clock disabled, got %d", len(events))
+	}
+
+	// Transport still works without a tempo
+	c.Start()
+	if events := c.advance(64, 48000, nil); len(events) != 1 || events[0].status != 0xFA {
+		t.Errorf("Expected only start with clock disabled, got %v", events)
+	}
+
+	// No sample rate yet (e.g. before activation)
+	c = newClockGenerator(120)
+	if events := c.advance(64, 0, nil); len(events) != 0 {
+		t.Errorf("Expected no ticks without a sample rate, got %v", events)
+	}
+}
+
+func TestClockGeneratorFollowTransport(t *testing.T) {
+	c := newClockGenerator(120) // 1000 frames per tick at 48kHz
+	transport := &transportPosition{}
+	if events := c.advance(100, 48000, transport); len(events) != 1 || events[0].status != 0xF8 {
+		t.Fatalf("Expected only a tick while the transport is stopped, got %v", events)
+	}
+
+	// Rolling from the beginning sends Start and restarts the tick phase
+	transport.rolling = true
+	events := c.advance(100, 48000, transport)
+	if len(events) != 2 || events[0] != (clockEvent{offset: 0, status: 0xFA}) || events[1] != (clockEvent{offset: 0, status: 0xF8}) {
+		t.Fatalf("Expected start then tick at offset 0, got %v", events)
+	}
+	if events := c.advance(100, 48000, transport); len(events) != 0 {
+		t.Fatalf("Expected start once, got %v", events)
+	}
+
+	transport.rolling = false
+	if events := c.advance(100, 48000, transport); len(events) != 1 || events[0].status != 0xFC {
+		t.Fatalf("Expected stop, got %v", events)
+	}
+
+	// Bar 2, beat 2 and a bit in 4/4 is 20.2 sixteenths in: the song
+	// continues from the 21st, whose first tick is 0.8 sixteenths away
+	*transport = transportPosition{
+		rolling:      true,
+		bbt:          true,
+		bar:          2,
+		beat:         2,
+		tick:         100,
+		beatsPerBar:  4,
+		beatType:     4,
+		ticksPerBeat: 1920,
+		bpm:          120,
+	}
+	events = c.advance(5000, 48000, transport)
+	if len(events) != 3 || events[0] != (clockEvent{offset: 0, status: 0xF2, position: 21}) ||
+		events[1] != (clockEvent{offset: 0, status: 0xFB}) || events[2] != (clockEvent{offset: 4750, status: 0xF8}) {
+		t.Fatalf("Expected song position 21, continue and a tick at 4750, got %v", events)
+	}
+	if buf := events[0].appendTo(nil); !bytes.Equal(buf, []byte{0xF2, 21, 0}) {
+		t.Errorf("Expected song position F2 15 00, got % X", buf)
+	}
+
+	// The transport tempo overrides the clock's, in quarter notes
+	transport.bpm = 480
+	transport.beatType = 8 // 240 quarter notes per minute, 500 frames per tick
+	var frame uint32
+	ticks := runClock(c, transport, &frame, 4000, 100, 48000, 0xF8)
+	if len(ticks) != 8 || ticks[1]-ticks[0] != 500 {
+		t.Errorf("Expected a tick every 500 frames, got %v", ticks)
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"github.com/hypebeast/go-osc/osc"
+	"github.com/xthexder/go-jack"
+)
+
+// Controllers with a special meaning for 14-bit values and parameters
+const (
+	ccDataEntryMSB = 6
+	ccDataEntryLSB = 38
+	ccNRPNLSB      = 98
+	ccNRPNMSB      = 99
+	ccRPNLSB       = 100
+	ccRPNMSB       = 101
+	ccRPNNull      = 127 // RPN 127/127 deselects the parameter
+)
+
+// controllerMessage is a controller value reassembled from Control Change
+// messages, sent as /midi/{channel}/{kind} [number, value].
+type controllerMessage struct {
+	kind    string // cc, cc14, rpn or nrpn
+	channel uint8
+	number  uint16 // Controller or parameter number
+	value   uint16 // 0-127 for cc, 0-16383 otherwise
+}
+
+// ccAssembler reassembles the Control Change messages received on one input
+// port: MSB/LSB pairs of controllers 0-31 and 32-63 become cc14, and a
+// parameter selected with CC 101/100 (RPN) or 99/98 (NRPN) followed by data
+// entry on CC 6/38 becomes rpn or nrpn.
+//
+// An MSB is held back in case its LSB follows. It is sent on its own (as a
+// 7-bit cc, or a parameter value with an LSB of 0) when anything else
+// arrives on the channel or at the end of the period. Only an LSB that
+// immediately follows its held MSB makes a cc14; on its own, CC 32-63 is a
+// plain cc, as many controllers use them as separate knobs.
+//
+// RT thread only.
+type ccAssembler struct {
+	channels [16]ccChannel
+}
+
+type ccChannel struct {
+	msb     [32]uint8 // Last MSB of controllers 0-31
+	known   uint32    // Bit n is set once controller n's MSB has arrived
+	bankLSB uint8     // Last CC 32, for MIDI 2.0 Program Change
+
+	kind      string // Selected parameter type, rpn or nrpn; empty for none
+	paramMSB  uint8
+	paramLSB  uint8
+	dataMSB   uint8
+	dataKnown bool // dataMSB was received for the selected parameter
+
+	holding  bool  // An MSB is held back
+	held     uint8 // Controller of the held MSB
+	heldData bool  // The held MSB is data entry for the selected parameter
+}
+
+// control handles a Control Change message and appends the resulting
+// messages to out.
+func (a *ccAssembler) control(channel, controller, value uint8, out []controllerMessage) []controllerMessage {
+	c := &a.channels[channel&0x0F]
+
+	switch {
+	case c.kind != "" && controller == ccDataEntryMSB:
+		out = c.flush(channel, out)
+		c.dataMSB, c.dataKnown = value, true
+		c.holding, c.held, c.heldData = true, controller, true
+
+	case c.kind != "" && controller == ccDataEntryLSB:
+		if !(c.holding && c.heldData) {
+			out = c.flush(channel, out)
+		}
+		c.holding = false
+		msb := uint8(0)
+		if c.dataKnown {
+			msb = c.dataMSB
+		}
+		out = append(out, controllerMessage{c.kind, channel, c.param(), uint16(msb)<<7 | uint16(value)})
+
+	case controller >= ccNRPNLSB && controller <= ccRPNMSB:
+		out = c.flush(channel, out)
+		c.selectParam(controller, value)
+
+	case controller < 32:
+		out = c.flush(channel, out)
+		c.msb[controller] = value
+		c.known |= 1 << controller
+		c.holding, c.held, c.heldData = true, controller, false
+
+	case controller < 64:
+		msbController := controller - 32
+		if msbController == 0 {
+			c.bankLSB = value
+		}
+		if c.holding && !c.heldData && c.held == msbController {
+			c.holding = false
+			out = append(out, controllerMessage{"cc14", channel, uint16(msbController), uint16(c.msb[msbController])<<7 | uint16(value)})
+		} else {
+			out = c.flush(channel, out)
+			out = append(out, controllerMessage{"cc", channel, uint16(controller), uint16(value)})
+		}
+
+	default:
+		out = c.flush(channel, out)
+		out = append(out, controllerMessage{"cc", channel, uint16(controller), uint16(value)})
+	}
+	return out
+}
+
+// flushChannel sends a held MSB before another message on the channel.
+func (a *ccAssembler) flushChannel(channel uint8, out []controllerMessage) []controllerMessage {
+	return a.channels[channel&0x0F].flush(channel, out)
+}
+
+// flushAll sends every held MSB, at the end of a period.
+func (a *ccAssembler) flushAll(out []controllerMessage) []controllerMessage {
+	for i := range a.channels {
+		out = a.channels[i].flush(uint8(i), out)
+	}
+	return out
+}
+
+func (c *ccChannel) flush(channel uint8, out []controllerMessage) []controllerMessage {
+	if !c.holding {
+		return out
+	}
+	c.holding = false
+	if c.heldData {
+		return append(out, controllerMessage{c.kind, channel, c.param(), uint16(c.dataMSB) << 7})
+	}
+	return append(out, controllerMessage{"cc", channel, uint16(c.held), uint16(c.msb[c.held])})
+}
+
+// selectParam handles a parameter number controller, CC 98-101.
+func (c *ccChannel) selectParam(controller, value uint8) {
+	switch controller {
+	case ccRPNMSB:
+		c.kind, c.paramMSB = "rpn", value
+	case ccRPNLSB:
+		c.kind, c.paramLSB = "rpn", value
+	case ccNRPNMSB:
+		c.kind, c.paramMSB = "nrpn", value
+	case ccNRPNLSB:
+		c.kind, c.paramLSB = "nrpn", value
+	}
+	c.dataKnown = false
+	if c.kind == "rpn" && c.paramMSB == ccRPNNull && c.paramLSB == ccRPNNull {
+		c.kind = ""
+	}
+}
+
+func (c *ccChannel) param() uint16 {
+	return uint16(c.paramMSB)<<7 | uint16(c.paramLSB)
+}
+
+// parseIncomingEvent converts an event received on an input port to OSC,
+// decoding MPE and reassembling controller values; it may return no
+// messages (for a held MSB) or several (a held MSB followed by the event).
+func (b *Bridge) parseIncomingEvent(port *bridgePort, event *jack.MidiData) []*osc.Message {
+	data := event.Buffer
+	if len(data) == 0 || data[0] < 0x80 || data[0] >= 0xF0 {
+		if msg := b.parseIncomingMIDI(port, event); msg != nil {
+			return []*osc.Message{msg}
+		}
+		return nil
+	}
+
+	status, channel := data[0]&0xF0, data[0]&0x0F
+	if zone := b.mpeMembers[channel]; zone != nil {
+		if msgs := b.parseMPE(port, zone, data); msgs != nil {
+			return append(b.controllerOSC(port.controllers.flushChannel(channel, nil)), msgs...)
+		}
+	}
+
+	var reassembled []controllerMessage
+	var msg *osc.Message
+	if status == 0xB0 && len(data) >= 3 {
+		// Mapped controllers are sent as mapped, unassembled
+		if msg = b.mapIncomingMIDI(status, channel, data[1:]); msg == nil {
+			reassembled = port.controllers.control(channel, data[1]&0x7F, data[2]&0x7F, nil)
+		} else {
+			reassembled = port.controllers.flushChannel(channel, nil)
+		}
+	} else {
+		reassembled = port.controllers.flushChannel(channel, nil)
+		if b.midi2 && len(data) >= channelMessageLength(status) {
+			// With --midi2, unmapped messages go out as MIDI 2.0 UMPs
+			if msg = b.mapIncomingEvent(data); msg == nil {
+				msg = umpMessage(midi1ToUMP(data, &port.controllers.channels[channel]))
+			}
+		} else {
+			msg = b.parseIncomingMIDI(port, event)
+		}
+	}
+
+	msgs := b.controllerOSC(reassembled)
+	if msg != nil {
+		msgs = append(msgs, msg)
+	}
+	return msgs
+}
+
+// controllerOSC converts reassembled controller values to OSC messages, or
+// to /ump messages with --midi2.
+func (b *Bridge) controllerOSC(values []controllerMessage) []*osc.Message {
+	if len(values) == 0 {
+		return nil
+	}
+	msgs := make([]*osc.Message, 0, len(values))
+	for _, v := range values {
+		if !b.midi2 {
+			msgs = append(msgs, osc.NewMessage(b.channelPath(v.channel, v.kind), int32(v.number), int32(v.value)))
+		} else if words := controllerUMP(v); words != nil {
+			msgs = append(msgs, umpMessage(words))
+		}
+	}
+	return msgs
+}
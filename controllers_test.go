@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/hypebeast/go-osc/osc"
+)
+
+func TestCCAssembler(t *testing.T) {
+	tests := []struct {
+		name  string
+		input [][3]uint8 // channel, controller, value; a zero row ends the period
+		want  []controllerMessage
+	}{
+		{
+			name:  "14-bit pair",
+			input: [][3]uint8{{0, 1, 64}, {0, 33, 5}},
+			want:  []controllerMessage{{"cc14", 0, 1, 64<<7 | 5}},
+		},
+		{
+			name:  "MSB alone is flushed at the end of the period",
+			input: [][3]uint8{{2, 7, 100}, {}},
+			want:  []controllerMessage{{"cc", 2, 7, 100}},
+		},
+		{
+			name:  "MSB, flush, then a lone LSB stays 7-bit",
+			input: [][3]uint8{{0, 1, 64}, {}, {0, 33, 9}},
+			want:  []controllerMessage{{"cc", 0, 1, 64}, {"cc", 0, 33, 9}},
+		},
+		{
+			name:  "LSB after another controller stays 7-bit",
+			input: [][3]uint8{{0, 1, 64}, {0, 7, 100}, {0, 33, 9}},
+			want:  []controllerMessage{{"cc", 0, 1, 64}, {"cc", 0, 7, 100}, {"cc", 0, 33, 9}},
+		},
+		{
+			name:  "LSB without an MSB stays 7-bit",
+			input: [][3]uint8{{0, 33, 9}},
+			want:  []controllerMessage{{"cc", 0, 33, 9}},
+		},
+		{
+			name:  "other controller flushes the MSB",
+			input: [][3]uint8{{0, 7, 100}, {0, 64, 127}},
+			want:  []controllerMessage{{"cc", 0, 7, 100}, {"cc", 0, 64, 127}},
+		},
+		{
+			name:  "other channels don't flush",
+			input: [][3]uint8{{0, 7, 100}, {1, 64, 127}, {0, 39, 3}},
+			want:  []controllerMessage{{"cc", 1, 64, 127}, {"cc14", 0, 7, 100<<7 | 3}},
+		},
+		{
+			name:  "RPN",
+			input: [][3]uint8{{0, 101, 0}, {0, 100, 0}, {0, 6, 12}, {0, 38, 0}, {0, 101, 127}, {0, 100, 127}},
+			want:  []controllerMessage{{"rpn", 0, 0, 12 << 7}},
+		},
+		{
+			name:  "NRPN with data MSB only",
+			input: [][3]uint8{{3, 99, 1}, {3, 98, 8}, {3, 6, 100}, {}},
+			want:  []controllerMessage{{"nrpn", 3, 1<<7 | 8, 100 << 7}},
+		},
+		{
+			name:  "data entry LSB alone keeps the MSB",
+			input: [][3]uint8{{0, 99, 0}, {0, 98, 5}, {0, 6, 2}, {0, 38, 1}, {0, 38, 2}},
+			want:  []controllerMessage{{"nrpn", 0, 5, 2<<7 | 1}, {"nrpn", 0, 5, 2<<7 | 2}},
+		},
+		{
+			name:  "data entry after the RPN null is a controller",
+			input: [][3]uint8{{0, 101, 127}, {0, 100, 127}, {0, 6, 1}, {0, 38, 2}},
+			want:  []controllerMessage{{"cc14", 0, 6, 1<<7 | 2}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var a ccAssembler
+			var got []controllerMessage
+			for _, in := range tt.input {
+				if in == ([3]uint8{}) {
+					got = a.flushAll(got)
+				} else {
+					got = a.control(in[0], in[1], in[2], got)
+				}
+			}
+			got = a.flushAll(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestBridgeControllerSequences(t *testing.T) {
+	bridge, backend, _ := newTestBridge(t, Config{PitchBendFormat: pitchBendSigned})
+	out := backend.port("midi_out")
+
+	bridge.dispatcher.Dispatch(osc.NewMessage("/midi/0/cc14", int32(1), int32(8193)))
+	bridge.dispatcher.Dispatch(osc.NewMessage("/midi/1/rpn", int32(0), int32(12<<7)))
+	bridge.dispatcher.Dispatch(osc.NewMessage("/midi/2/nrpn", int32(1<<7|8), int32(100)))
+	backend.cycle(64)
+
+	want := [][]byte{
+		{0xB0, 1, 64}, {0xB0, 33, 1},
+		{0xB1, 101, 0}, {0xB1, 100, 0}, {0xB1, 6, 12}, {0xB1, 38, 0}, {0xB1, 101, 127}, {0xB1, 100, 127},
+		{0xB2, 99, 1}, {0xB2, 98, 8}, {0xB2, 6, 0}, {0xB2, 38, 100}, {0xB2, 101, 127}, {0xB2, 100, 127},
+	}
+	if len(out.written) != len(want) {
+		t.Fatalf("Expected %d MIDI events, got %v", len(want), out.written)
+	}
+	for i, event := range out.written {
+		if !bytes.Equal(event.Buffer, want[i]) {
+			t.Errorf("Event %d: expected % X, got % X", i, want[i], event.Buffer)
+		}
+	}
+
+	// Out of range values are rejected
+	for _, tt := range []struct {
+		handler func(*osc.Message) error
+		msg     *osc.Message
+	}{
+		{bridge.handleCC14, osc.NewMessage("/midi/0/cc14", int32(32), int32(0))},
+		{bridge.handleCC14, osc.NewMessage("/midi/0/cc14", int32(1), int32(16384))},
+		{bridge.handleRPN, osc.NewMessage("/midi/0/rpn", int32(-1), int32(0))},
+		{bridge.handleNRPN, osc.NewMessage("/midi/0/nrpn", int32(0))},
+	} {
+		if err := tt.handler(tt.msg); err == nil {
+			t.Errorf("Expected an error for %v", tt.msg)
+		}
+	}
+}
+
+func TestBridgeControllerReassembly(t *testing.T) {
+	_, backend, conn := newTestBridge(t, Config{PitchBendFormat: pitchBendSigned})
+	in := backend.port("midi_in")
+
+	in.send(0, 0xB0, 101, 0)
+	in.send(1, 0xB0, 100, 0)
+	in.send(2, 0xB0, 6, 2)
+	in.send(3, 0xB0, 38, 0)
+	in.send(4, 0xB1, 7, 100)
+	in.send(5, 0xB1, 39, 1)
+	in.send(6, 0xB2, 7, 90) // No LSB in this period
+	backend.cycle(64)
+
+	want := []struct {
+		address string
+		args    []interface{}
+	}{
+		{"/midi/0/rpn", []interface{}{int32(0), int32(2 << 7)}},
+		{"/midi/1/cc14", []interface{}{int32(7), int32(100<<7 | 1)}},
+		{"/midi/2/cc", []interface{}{int32(7), int32(90)}},
+	}
+	for _, w := range want {
+		msg := receiveOSC(t, conn)
+		if msg.Address != w.address || !reflect.DeepEqual(msg.Arguments, w.args) {
+			t.Errorf("Expected %s %v, got %s %v", w.address, w.args, msg.Address, msg.Arguments)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/GeoffreyPlitt/debuggo"
+	"github.com/hypebeast/go-osc/osc"
+)
+
+var debugDispatcher = debuggo.Debug("dispatcher")
+
+// oscDispatcher routes OSC packets to the handlers registered for their
+// addresses. Unlike osc.StandardDispatcher, which sleeps until a bundle's
+// timetag before handling it, messages in bundles are handled immediately
+// and the timetag is recorded so the MIDI they produce can be scheduled
+// sample-accurately by the process callback.
+//
+// Incoming addresses may be OSC address patterns (see matchOSCAddress); a
+// pattern is delivered once to every registered address it matches, with
+// the message's Address set to that address.
+//
+// Handlers run one at a time, in packet order.
+type oscDispatcher struct {
+	mu        sync.Mutex
+	handlers  map[string]osc.HandlerFunc
+	addresses []string        // Registered addresses in registration order
+	at        time.Time       // Timetag of the bundle being dispatched; zero for immediate
+	unhandled osc.HandlerFunc // Called for messages matching no address; optional
+	closed    bool            // Set by close; packets dispatched later are dropped
+}
+
+func newOSCDispatcher() *oscDispatcher {
+	return &oscDispatcher{handlers: make(map[string]osc.HandlerFunc)}
+}
+
+// AddMsgHandler registers a handler for an exact OSC address.
+func (d *oscDispatcher) AddMsgHandler(addr string, handler osc.HandlerFunc) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, exists := d.handlers[addr]; exists {
+		return fmt.Errorf("OSC address %s exists already", addr)
+	}
+	if isOSCPattern(addr) {
+		return fmt.Errorf("OSC address %s may not contain any of %s", addr, oscPatternChars)
+	}
+	d.handlers[addr] = handler
+	d.addresses = append(d.addresses, addr)
+	return nil
+}
+
+// Dispatch implements osc.Dispatcher.
+func (d *oscDispatcher) Dispatch(packet osc.Packet) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return
+	}
+	d.dispatch(packet, time.Time{})
+	d.at = time.Time{}
+}
+
+// close drops the packets dispatched from now on. It returns once the
+// packet being handled, if any, is done.
+func (d *oscDispatcher) close() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.closed = true
+}
+
+func (d *oscDispatcher) dispatch(packet osc.Packet, at time.Time) {
+	switch p := packet.(type) {
+	case *osc.Message:
+		d.at = at
+		if !isOSCPattern(p.Address) {
+			handler, ok := d.handlers[p.Address]
+			if !ok {
+				d.handleUnmatched(p)
+				return
+			}
+			handler(p)
+			return
+		}
+
+		matched := 0
+		for _, addr := range d.addresses {
+			if matchOSCAddress(p.Address, addr) {
+				d.handlers[addr](&osc.Message{Address: addr, Arguments: p.Arguments})
+				matched++
+			}
+		}
+		debugDispatcher("Pattern %s matched %d addresses", p.Address, matched)
+		if matched == 0 {
+			d.handleUnmatched(p)
+		}
+
+	case *osc.Bundle:
+		// Nested bundles carry their own timetag; "immediately" inherits
+		// the enclosing one.
+		if t := bundleTime(p.Timetag); !t.IsZero() {
+			at = t
+		}
+		for _, msg := range p.Messages {
+			d.dispatch(msg, at)
+		}
+		for _, bundle := range p.Bundles {
+			d.dispatch(bundle, at)
+		}
+	}
+}
+
+func (d *oscDispatcher) handleUnmatched(msg *osc.Message) {
+	if d.unhandled != nil {
+		d.unhandled(msg)
+		return
+	}
+	debugDispatcher("No handler for %s", msg.Address)
+}
+
+// bundleTime returns the time a handler is being dispatched for: the
+// timetag of the enclosing bundle, or zero for an immediate message. Only
+// meaningful when called from a handler.
+func (d *oscDispatcher) bundleTime() time.Time {
+	return d.at
+}
+
+// bundleTime converts an OSC timetag to wall-clock time. The special value 1
+// ("immediately") and the unset value 0 map to the zero time.
+func bundleTime(tt osc.Timetag) time.Time {
+	if tt.TimeTag() <= 1 {
+		return time.Time{}
+	}
+	return tt.Time()
+}
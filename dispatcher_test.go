@@ -0,0 +1,159 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hypebeast/go-osc/osc"
+)
+
+func TestOSCDispatcherMessages(t *testing.T) {
+	d := newOSCDispatcher()
+
+	var received []string
+	if err := d.AddMsgHandler("/midi/0/note_on", func(msg *osc.Message) {
+		received = append(received, msg.Address)
+	}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := d.AddMsgHandler("/midi/0/note_on", func(msg *osc.Message) {}); err == nil {
+		t.Error("Expected error registering a duplicate address")
+	}
+
+	d.Dispatch(osc.NewMessage("/midi/0/note_on", int32(60), int32(100)))
+	d.Dispatch(osc.NewMessage("/midi/0/note_o"))   // Prefixes must not match
+	d.Dispatch(osc.NewMessage("/midi/0/note_on2")) // Nor longer addresses
+	d.Dispatch(osc.NewMessage("/unknown"))
+
+	if len(received) != 1 {
+		t.Errorf("Expected exactly one handled message, got %v", received)
+	}
+}
+
+func TestOSCDispatcherPatterns(t *testing.T) {
+	d := newOSCDispatcher()
+
+	var received []string
+	for _, addr := range []string{"/midi/0/cc", "/midi/1/cc", "/midi/2/cc", "/midi/0/note_on"} {
+		d.AddMsgHandler(addr, func(msg *osc.Message) {
+			if len(msg.Arguments) != 2 {
+				t.Errorf("Expected arguments to be passed through, got %v", msg.Arguments)
+			}
+			received = append(received, msg.Address)
+		})
+	}
+	if err := d.AddMsgHandler("/midi/*/cc", func(msg *osc.Message) {}); err == nil {
+		t.Error("Expected error registering a pattern address")
+	}
+
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{"/midi/*/cc", []string{"/midi/0/cc", "/midi/1/cc", "/midi/2/cc"}},
+		{"/midi/{0,2}/cc", []string{"/midi/0/cc", "/midi/2/cc"}},
+		{"/midi/0/*", []string{"/midi/0/cc", "/midi/0/note_on"}},
+		{"/midi/[!0]/cc", []string{"/midi/1/cc", "/midi/2/cc"}},
+		{"/midi/?/note_off", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			received = nil
+			d.Dispatch(osc.NewMessage(tt.pattern, int32(123), int32(0)))
+			if len(received) != len(tt.want) {
+				t.Fatalf("Expected %v, got %v", tt.want, received)
+			}
+			for i := range tt.want {
+				if received[i] != tt.want[i] {
+					t.Errorf("Expected %v, got %v", tt.want, received)
+				}
+			}
+		})
+	}
+}
+
+func TestOSCDispatcherUnhandled(t *testing.T) {
+	d := newOSCDispatcher()
+	d.AddMsgHandler("/midi/0/cc", func(msg *osc.Message) {})
+
+	var unhandled []string
+	d.unhandled = func(msg *osc.Message) {
+		unhandled = append(unhandled, msg.Address)
+	}
+
+	d.Dispatch(osc.NewMessage("/midi/0/cc"))
+	d.Dispatch(osc.NewMessage("/midi/16/cc"))
+	d.Dispatch(osc.NewMessage("/midi/*/note_on"))
+
+	if len(unhandled) != 2 || unhandled[0] != "/midi/16/cc" || unhandled[1] != "/midi/*/note_on" {
+		t.Errorf("Expected unmatched addresses to be reported, got %v", unhandled)
+	}
+}
+
+func TestOSCDispatcherBundleTime(t *testing.T) {
+	d := newOSCDispatcher()
+
+	var times []time.Time
+	d.AddMsgHandler("/a", func(msg *osc.Message) {
+		times = append(times, d.bundleTime())
+	})
+
+	// Plain messages are immediate
+	d.Dispatch(osc.NewMessage("/a"))
+	if len(times) != 1 || !times[0].IsZero() {
+		t.Fatalf("Expected zero time for a plain message, got %v", times)
+	}
+
+	// Bundled messages are handled now, stamped with the bundle's timetag
+	at := time.Now().Add(2 * time.Second)
+	bundle := osc.NewBundle(at)
+	bundle.Append(osc.NewMessage("/a"))
+	bundle.Append(osc.NewMessage("/a"))
+
+	nestedAt := at.Add(500 * time.Millisecond)
+	nested := osc.NewBundle(nestedAt)
+	nested.Append(osc.NewMessage("/a"))
+	bundle.Append(nested)
+
+	d.Dispatch(bundle)
+	if len(times) != 4 {
+		t.Fatalf("Expected bundle messages to be handled immediately, got %d", len(times))
+	}
+	for i, expected := range []time.Time{at, at, nestedAt} {
+		if diff := times[i+1].Sub(expected); diff > time.Microsecond || diff < -time.Microsecond {
+			t.Errorf("Message %d stamped %v, expected %v", i, times[i+1], expected)
+		}
+	}
+
+	// The timetag does not leak into later plain messages
+	d.Dispatch(osc.NewMessage("/a"))
+	if !times[4].IsZero() {
+		t.Errorf("Expected zero time after a bundle, got %v", times[4])
+	}
+}
+
+func TestBundleTimeImmediately(t *testing.T) {
+	if !bundleTime(*osc.NewTimetagFromTimetag(1)).IsZero() {
+		t.Error("Expected timetag 1 (immediately) to map to the zero time")
+	}
+	if !bundleTime(osc.Timetag{}).IsZero() {
+		t.Error("Expected an unset timetag to map to the zero time")
+	}
+
+	// An immediate bundle inside a timed one inherits the outer time
+	d := newOSCDispatcher()
+	var got time.Time
+	d.AddMsgHandler("/a", func(msg *osc.Message) { got = d.bundleTime() })
+
+	at := time.Now().Add(time.Second)
+	outer := osc.NewBundle(at)
+	inner := &osc.Bundle{Timetag: *osc.NewTimetagFromTimetag(1)}
+	inner.Append(osc.NewMessage("/a"))
+	outer.Append(inner)
+	d.Dispatch(outer)
+
+	if diff := got.Sub(at); diff > time.Microsecond || diff < -time.Microsecond {
+		t.Errorf("Expected inherited time %v, got %v", at, got)
+	}
+}
@@ -4,6 +4,12 @@ go 1.22
 
 require (
 	github.com/GeoffreyPlitt/debuggo v0.1.0
+	github.com/gorilla/websocket v1.5.3
 	github.com/hypebeast/go-osc v0.0.0-20220308234300-cec5a8a1e5f5
 	github.com/xthexder/go-jack v0.0.0-20220805234212-bc8604043aba
+	golang.org/x/net v0.35.0
 )
+
+require gopkg.in/yaml.v3 v3.0.1
+
+require golang.org/x/sys v0.30.0 // indirect
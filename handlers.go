@@ -3,8 +3,10 @@ package main
 import (
 	"errors"
 	"fmt"
+	"math"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/GeoffreyPlitt/debuggo"
 	"github.com/hypebeast/go-osc/osc"
@@ -13,11 +15,14 @@ import (
 
 var debugHandlers = debuggo.Debug("handlers")
 
-func (b *Bridge) createMidiEvent(statusByte, channel, note, velocity uint8) *MidiEvent {
-	midiBytes := []byte{
-		byte(statusByte | (channel & 0x0F)),
-		byte(note & 0x7F),
-		byte(velocity & 0x7F),
+// createMidiEvent builds a channel voice message from a status nibble, a
+// channel and its data bytes; the number of data bytes varies by message
+// type (e.g. 2 for note on, 1 for program change).
+func (b *Bridge) createMidiEvent(statusByte, channel uint8, data ...uint8) *MidiEvent {
+	midiBytes := make([]byte, 1+len(data))
+	midiBytes[0] = byte(statusByte | (channel & 0x0F))
+	for i, d := range data {
+		midiBytes[i+1] = byte(d & 0x7F)
 	}
 	return &MidiEvent{
 		midiData: &jack.MidiData{
@@ -27,24 +32,61 @@ func (b *Bridge) createMidiEvent(statusByte, channel, note, velocity uint8) *Mid
 	}
 }
 
+// createSystemEvent wraps a complete system message (SysEx, System Common
+// or System Real-Time), which carries no channel.
+func (b *Bridge) createSystemEvent(data ...byte) *MidiEvent {
+	return &MidiEvent{
+		midiData: &jack.MidiData{
+			Time:   0,
+			Buffer: data,
+		},
+	}
+}
+
+// queueMidiEvent hands an event to the process callback. Events produced
+// while dispatching an OSC bundle carry its timetag and are written at the
+// matching frame instead of at the start of the next period, and events
+// produced for a /port/<name> address go to that port.
+func (b *Bridge) queueMidiEvent(event *MidiEvent) error {
+	if event.port == nil {
+		event.port = b.routePort
+	}
+	if b.dispatcher != nil {
+		event.at = b.dispatcher.bundleTime()
+		if !event.at.IsZero() && time.Until(event.at) > maxScheduleAhead {
+			return fmt.Errorf("bundle timetag %s is more than %s ahead", event.at.Format(time.RFC3339Nano), maxScheduleAhead)
+		}
+	}
+
+	b.pendingMidi.Add(1)
+	select {
+	case b.eventQueue <- event:
+		return nil
+	default:
+		b.pendingMidi.Add(-1)
+		return errors.New("MIDI queue full")
+	}
+}
+
 func (b *Bridge) handleNoteOn(msg *osc.Message) error {
 	if len(msg.Arguments) < 2 {
 		return errors.New("note_on requires at least 2 arguments: note and velocity")
 	}
 
-	channel := b.extractChannel(msg.Address)
+	channel, err := b.extractChannel(msg.Address)
+	if err != nil {
+		return err
+	}
 	note := toUint8(msg.Arguments[0])
 	velocity := toUint8(msg.Arguments[1])
 
 	// Create MIDI note on message: 0x90 | channel, note, velocity
 	event := b.createMidiEvent(0x90, channel, note, velocity)
 
-	select {
-	case b.eventQueue <- event:
-		fmt.Printf("NOTE-ON ch:%d note:%d vel:%d\n", channel, note, velocity)
-	default:
-		return errors.New("MIDI queue full")
+	if err := b.queueMidiEvent(event); err != nil {
+		return err
 	}
+	fmt.Printf("NOTE-ON ch:%d note:%d vel:%d\n", b.oscChannel(channel), note, velocity)
 
 	return nil
 }
@@ -54,68 +96,556 @@ func (b *Bridge) handleNoteOff(msg *osc.Message) error {
 		return errors.New("note_off requires at least 2 arguments: note and velocity")
 	}
 
-	channel := b.extractChannel(msg.Address)
+	channel, err := b.extractChannel(msg.Address)
+	if err != nil {
+		return err
+	}
 	note := toUint8(msg.Arguments[0])
 	velocity := toUint8(msg.Arguments[1])
 
 	// Create MIDI note off message: 0x80 | channel, note, velocity
 	event := b.createMidiEvent(0x80, channel, note, velocity)
 
-	select {
-	case b.eventQueue <- event:
-		fmt.Printf("NOTE-OFF ch:%d note:%d vel:%d\n", channel, note, velocity)
+	if err := b.queueMidiEvent(event); err != nil {
+		return err
+	}
+	fmt.Printf("NOTE-OFF ch:%d note:%d vel:%d\n", b.oscChannel(channel), note, velocity)
+
+	return nil
+}
+
+func (b *Bridge) handleControlChange(msg *osc.Message) error {
+	if len(msg.Arguments) < 2 {
+		return errors.New("cc requires at least 2 arguments: controller and value")
+	}
+
+	channel, err := b.extractChannel(msg.Address)
+	if err != nil {
+		return err
+	}
+	controller := toUint8(msg.Arguments[0])
+	value := toUint8(msg.Arguments[1])
+
+	// Create MIDI control change message: 0xB0 | channel, controller, value
+	event := b.createMidiEvent(0xB0, channel, controller, value)
+
+	if err := b.queueMidiEvent(event); err != nil {
+		return err
+	}
+	fmt.Printf("CC ch:%d cc:%d val:%d\n", b.oscChannel(channel), controller, value)
+
+	return nil
+}
+
+// createControlSequence builds one event holding consecutive Control Change
+// messages from controller/value pairs. writeMidi splits it at the same
+// offset, so the sequence is never interleaved with other events.
+func (b *Bridge) createControlSequence(channel uint8, pairs ...uint8) *MidiEvent {
+	midiBytes := make([]byte, 0, len(pairs)/2*3)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		midiBytes = append(midiBytes, 0xB0|(channel&0x0F), pairs[i]&0x7F, pairs[i+1]&0x7F)
+	}
+	return &MidiEvent{
+		midiData: &jack.MidiData{
+			Time:   0,
+			Buffer: midiBytes,
+		},
+	}
+}
+
+// toValue14 converts an OSC argument to a 14-bit value, 0-16383.
+func toValue14(v interface{}, name string) (uint16, error) {
+	value, ok := toInt(v)
+	if !ok || value < 0 || value > 0x3FFF {
+		return 0, fmt.Errorf("%s value must be 0-16383, got %v", name, v)
+	}
+	return uint16(value), nil
+}
+
+// handleCC14 sends a 14-bit controller value as the MSB on controller n
+// (0-31) followed by the LSB on controller n+32.
+func (b *Bridge) handleCC14(msg *osc.Message) error {
+	if len(msg.Arguments) < 2 {
+		return errors.New("cc14 requires 2 arguments: controller (0-31) and value (0-16383)")
+	}
+
+	channel, err := b.extractChannel(msg.Address)
+	if err != nil {
+		return err
+	}
+	controller, ok := toInt(msg.Arguments[0])
+	if !ok || controller < 0 || controller > 31 {
+		return fmt.Errorf("cc14 controller must be 0-31, got %v", msg.Arguments[0])
+	}
+	value, err := toValue14(msg.Arguments[1], "cc14")
+	if err != nil {
+		return err
+	}
+
+	cc := uint8(controller)
+	event := b.createControlSequence(channel, cc, uint8(value>>7), cc+32, uint8(value))
+	if err := b.queueMidiEvent(event); err != nil {
+		return err
+	}
+	fmt.Printf("CC14 ch:%d cc:%d val:%d\n", b.oscChannel(channel), controller, value)
+
+	return nil
+}
+
+// handleRPN sets a Registered Parameter, e.g. 0 for pitch bend range.
+func (b *Bridge) handleRPN(msg *osc.Message) error {
+	return b.handleParameter(msg, "rpn", ccRPNMSB, ccRPNLSB)
+}
+
+// handleNRPN sets a Non-Registered Parameter.
+func (b *Bridge) handleNRPN(msg *osc.Message) error {
+	return b.handleParameter(msg, "nrpn", ccNRPNMSB, ccNRPNLSB)
+}
+
+// handleParameter selects a parameter with its MSB and LSB controllers,
+// sends the value with data entry (CC 6 and 38), then deselects it with
+// the RPN null so later data entry can't change it by accident.
+func (b *Bridge) handleParameter(msg *osc.Message, name string, msbCC, lsbCC uint8) error {
+	if len(msg.Arguments) < 2 {
+		return fmt.Errorf("%s requires 2 arguments: parameter (0-16383) and value (0-16383)", name)
+	}
+
+	channel, err := b.extractChannel(msg.Address)
+	if err != nil {
+		return err
+	}
+	param, ok := toInt(msg.Arguments[0])
+	if !ok || param < 0 || param > 0x3FFF {
+		return fmt.Errorf("%s parameter must be 0-16383, got %v", name, msg.Arguments[0])
+	}
+	value, err := toValue14(msg.Arguments[1], name)
+	if err != nil {
+		return err
+	}
+
+	event := b.createControlSequence(channel,
+		msbCC, uint8(param>>7),
+		lsbCC, uint8(param),
+		ccDataEntryMSB, uint8(value>>7),
+		ccDataEntryLSB, uint8(value),
+		ccRPNMSB, ccRPNNull,
+		ccRPNLSB, ccRPNNull,
+	)
+	if err := b.queueMidiEvent(event); err != nil {
+		return err
+	}
+	fmt.Printf("%s ch:%d param:%d val:%d\n", strings.ToUpper(name), b.oscChannel(channel), param, value)
+
+	return nil
+}
+
+func (b *Bridge) handlePitchBend(msg *osc.Message) error {
+	if len(msg.Arguments) < 1 {
+		return errors.New("pitch_bend requires 1 argument: value")
+	}
+
+	channel, err := b.extractChannel(msg.Address)
+	if err != nil {
+		return err
+	}
+	value, err := pitchBendValue(msg.Arguments[0], b.pitchBendFormat)
+	if err != nil {
+		return err
+	}
+
+	// Create MIDI pitch bend message: 0xE0 | channel, LSB, MSB
+	event := b.createMidiEvent(0xE0, channel, uint8(value&0x7F), uint8(value>>7))
+
+	if err := b.queueMidiEvent(event); err != nil {
+		return err
+	}
+	fmt.Printf("PITCH-BEND ch:%d val:%d\n", b.oscChannel(channel), value)
+
+	return nil
+}
+
+func (b *Bridge) handleProgramChange(msg *osc.Message) error {
+	if len(msg.Arguments) < 1 {
+		return errors.New("program requires 1 argument: program")
+	}
+
+	channel, err := b.extractChannel(msg.Address)
+	if err != nil {
+		return err
+	}
+	program := toUint8(msg.Arguments[0])
+
+	// Create MIDI program change message: 0xC0 | channel, program
+	event := b.createMidiEvent(0xC0, channel, program)
+
+	if err := b.queueMidiEvent(event); err != nil {
+		return err
+	}
+	fmt.Printf("PROGRAM ch:%d prog:%d\n", b.oscChannel(channel), program)
+
+	return nil
+}
+
+func (b *Bridge) handleChannelPressure(msg *osc.Message) error {
+	if len(msg.Arguments) < 1 {
+		return errors.New("channel_pressure requires 1 argument: pressure")
+	}
+
+	channel, err := b.extractChannel(msg.Address)
+	if err != nil {
+		return err
+	}
+	pressure := toUint8(msg.Arguments[0])
+
+	// Create MIDI channel pressure message: 0xD0 | channel, pressure
+	event := b.createMidiEvent(0xD0, channel, pressure)
+
+	if err := b.queueMidiEvent(event); err != nil {
+		return err
+	}
+	fmt.Printf("CHANNEL-PRESSURE ch:%d val:%d\n", b.oscChannel(channel), pressure)
+
+	return nil
+}
+
+func (b *Bridge) handlePolyPressure(msg *osc.Message) error {
+	if len(msg.Arguments) < 2 {
+		return errors.New("poly_pressure requires at least 2 arguments: note and pressure")
+	}
+
+	channel, err := b.extractChannel(msg.Address)
+	if err != nil {
+		return err
+	}
+	note := toUint8(msg.Arguments[0])
+	pressure := toUint8(msg.Arguments[1])
+
+	// Create MIDI polyphonic key pressure message: 0xA0 | channel, note, pressure
+	event := b.createMidiEvent(0xA0, channel, note, pressure)
+
+	if err := b.queueMidiEvent(event); err != nil {
+		return err
+	}
+	fmt.Printf("POLY-PRESSURE ch:%d note:%d val:%d\n", b.oscChannel(channel), note, pressure)
+
+	return nil
+}
+
+func (b *Bridge) handleSysEx(msg *osc.Message) error {
+	if len(msg.Arguments) < 1 {
+		return errors.New("sysex requires a blob or a list of byte arguments")
+	}
+
+	var data []byte
+	if blob, ok := msg.Arguments[0].([]byte); ok {
+		data = append([]byte(nil), blob...)
+	} else {
+		data = make([]byte, len(msg.Arguments))
+		for i, arg := range msg.Arguments {
+			v, ok := toInt(arg)
+			if !ok || v < 0 || v > 0xFF {
+				return fmt.Errorf("sysex argument %d is not a byte: %v", i, arg)
+			}
+			data[i] = byte(v)
+		}
+	}
+
+	if err := validateSysEx(data); err != nil {
+		return err
+	}
+
+	event := b.createSystemEvent(data...)
+
+	if err := b.queueMidiEvent(event); err != nil {
+		return err
+	}
+	fmt.Printf("SYSEX len:%d\n", len(data))
+
+	return nil
+}
+
+// System Real-Time status bytes for the transport addresses
+var transportStatus = map[string]uint8{
+	"/midi/clock":    0xF8,
+	"/midi/start":    0xFA,
+	"/midi/continue": 0xFB,
+	"/midi/stop":     0xFC,
+}
+
+func (b *Bridge) handleTransport(msg *osc.Message) error {
+	status, ok := transportStatus[msg.Address]
+	if !ok {
+		return fmt.Errorf("unknown transport address %s", msg.Address)
+	}
+
+	event := b.createSystemEvent(status)
+
+	if err := b.queueMidiEvent(event); err != nil {
+		return err
+	}
+	if status != 0xF8 { // Clock ticks are too frequent to log
+		fmt.Printf("TRANSPORT %s\n", strings.TrimPrefix(msg.Address, "/midi/"))
+	}
+
+	return nil
+}
+
+func (b *Bridge) handleSongPosition(msg *osc.Message) error {
+	if len(msg.Arguments) < 1 {
+		return errors.New("song_position requires 1 argument: beats")
+	}
+
+	beats, ok := toInt(msg.Arguments[0])
+	if !ok || beats < 0 || beats > 16383 {
+		return fmt.Errorf("song position %v out of range 0..16383", msg.Arguments[0])
+	}
+
+	// Create MIDI song position pointer: 0xF2, LSB, MSB (in MIDI beats, 6 clocks each)
+	event := b.createSystemEvent(0xF2, byte(beats&0x7F), byte(beats>>7))
+
+	if err := b.queueMidiEvent(event); err != nil {
+		return err
+	}
+	fmt.Printf("SONG-POSITION beats:%d\n", beats)
+
+	return nil
+}
+
+func (b *Bridge) handleSongSelect(msg *osc.Message) error {
+	if len(msg.Arguments) < 1 {
+		return errors.New("song_select requires 1 argument: song")
+	}
+
+	song, ok := toInt(msg.Arguments[0])
+	if !ok || song < 0 || song > 127 {
+		return fmt.Errorf("song %v out of range 0..127", msg.Arguments[0])
+	}
+
+	// Create MIDI song select message: 0xF3, song
+	event := b.createSystemEvent(0xF3, byte(song))
+
+	if err := b.queueMidiEvent(event); err != nil {
+		return err
+	}
+	fmt.Printf("SONG-SELECT song:%d\n", song)
+
+	return nil
+}
+
+func (b *Bridge) handleClockBPM(msg *osc.Message) error {
+	if b.clock == nil {
+		return errors.New("internal clock is off (enable it with --clock-bpm)")
+	}
+	if len(msg.Arguments) < 1 {
+		return errors.New("clock bpm requires 1 argument: bpm")
+	}
+
+	var bpm float64
+	switch val := msg.Arguments[0].(type) {
+	case float32:
+		bpm = float64(val)
+	case float64:
+		bpm = val
 	default:
-		return errors.New("MIDI queue full")
+		i, ok := toInt(val)
+		if !ok {
+			return fmt.Errorf("unsupported bpm argument type %T", val)
+		}
+		bpm = float64(i)
+	}
+	if bpm < 0 || bpm > maxClockBPM || math.IsNaN(bpm) {
+		return fmt.Errorf("clock tempo %g out of range 0..%d", bpm, maxClockBPM)
+	}
+
+	b.clock.SetBPM(bpm)
+	fmt.Printf("CLOCK bpm:%g\n", bpm)
+	return nil
+}
+
+func (b *Bridge) handleClockTransport(msg *osc.Message) error {
+	if b.clock == nil {
+		return errors.New("internal clock is off (enable it with --clock-bpm)")
 	}
 
+	switch msg.Address {
+	case "/clock/start":
+		b.clock.Start()
+	case "/clock/stop":
+		b.clock.Stop()
+	default:
+		return fmt.Errorf("unknown clock address %s", msg.Address)
+	}
+
+	fmt.Printf("CLOCK %s\n", strings.TrimPrefix(msg.Address, "/clock/"))
 	return nil
 }
 
-func (b *Bridge) extractChannel(address string) uint8 {
+// extractChannel returns the MIDI channel (0-15) addressed by a
+// /midi/{channel}/... path, whose channel is numbered from the configured
+// channel base. Out-of-range channels are an error rather than a fallback,
+// so a message never reaches the wrong instrument.
+func (b *Bridge) extractChannel(address string) (uint8, error) {
+	parts := strings.Split(address, "/")
+	if len(parts) < 3 || parts[1] != "midi" {
+		return 0, fmt.Errorf("%s is not a /midi/{channel} address", address)
+	}
+	ch, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return 0, fmt.Errorf("invalid channel %q in %s", parts[2], address)
+	}
+	base := int(b.channelBase)
+	if ch < base || ch > base+15 {
+		return 0, fmt.Errorf("channel %d out of range %d-%d in %s", ch, base, base+15, address)
+	}
+	return uint8(ch - base), nil
+}
+
+// oscChannel returns the OSC-facing number of a MIDI channel (0-15)
+func (b *Bridge) oscChannel(channel uint8) int {
+	return int(channel) + int(b.channelBase)
+}
+
+// handleUnmatched reports /midi/{channel}/... messages that matched no
+// handler because their channel is invalid; anything else is only logged.
+func (b *Bridge) handleUnmatched(msg *osc.Message) {
+	address := msg.Address
+	if parts := strings.SplitN(address, "/", 4); len(parts) == 4 && parts[1] == "port" {
+		address = "/" + parts[3] // Strip /port/<name>
+	}
 	parts := strings.Split(address, "/")
-	if len(parts) >= 3 && parts[1] == "midi" {
-		ch, err := strconv.Atoi(parts[2])
-		if err == nil && ch >= 0 && ch <= 15 {
-			return uint8(ch)
+	if len(parts) == 4 && parts[1] == "midi" && !isOSCPattern(parts[2]) {
+		if _, err := b.extractChannel(address); err != nil {
+			fmt.Printf("WARNING: Rejected %s: %v\n", msg.Address, err)
+			return
 		}
 	}
-	return 0
+	debugHandlers("No handler for %s", msg.Address)
 }
 
-func (b *Bridge) setupOSCHandlers() {
-	// Check if oscServer exists
-	if b.oscServer == nil || b.oscServer.Dispatcher == nil {
-		debugHandlers("OSC server not initialized")
-		return
+// addMsgHandler registers a handler for an address and, for each named
+// output port, for the address under the port's /port/<name> prefix. The
+// handler sees the unprefixed address; the MIDI it queues goes to the port.
+func (b *Bridge) addMsgHandler(path string, handle func(*osc.Message) error) error {
+	if err := b.dispatcher.AddMsgHandler(path, func(msg *osc.Message) {
+		if err := handle(msg); err != nil {
+			debugHandlers("Error handling %s: %v", msg.Address, err)
+		}
+	}); err != nil {
+		return err
 	}
 
-	// Get the dispatcher from the server
-	dispatcher, ok := b.oscServer.Dispatcher.(*osc.StandardDispatcher)
-	if !ok {
-		debugHandlers("Failed to get standard dispatcher")
-		return
+	for _, port := range b.outPorts {
+		if port.prefix == "" {
+			continue
+		}
+		if err := b.dispatcher.AddMsgHandler(port.prefix+path, func(msg *osc.Message) {
+			b.routePort = port
+			defer func() { b.routePort = nil }()
+			if err := handle(&osc.Message{Address: path, Arguments: msg.Arguments}); err != nil {
+				debugHandlers("Error handling %s: %v", msg.Address, err)
+			}
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setupOSCHandlers registers the built-in OSC addresses with the
+// dispatcher. It fails if an address cannot be handled, e.g. because a
+// named port's prefix makes an invalid address.
+func (b *Bridge) setupOSCHandlers() error {
+	// Check if the dispatcher exists
+	dispatcher := b.dispatcher
+	if dispatcher == nil {
+		debugHandlers("OSC dispatcher not initialized")
+		return nil
+	}
+
+	dispatcher.unhandled = b.handleUnmatched
+
+	// Handle channel messages: /midi/{channel}/{type} for 16 channels
+	// numbered from the channel base
+	handlers := []struct {
+		name   string
+		handle func(*osc.Message) error
+	}{
+		{"note_on", b.handleNoteOn},
+		{"note_off", b.handleNoteOff},
+		{"cc", b.handleControlChange},
+		{"cc14", b.handleCC14},
+		{"rpn", b.handleRPN},
+		{"nrpn", b.handleNRPN},
+		{"pitch_bend", b.handlePitchBend},
+		{"program", b.handleProgramChange},
+		{"channel_pressure", b.handleChannelPressure},
+		{"poly_pressure", b.handlePolyPressure},
+	}
+
+	for _, h := range handlers {
+		for i := uint8(0); i < 16; i++ {
+			if err := b.addMsgHandler(b.channelPath(i, h.name), h.handle); err != nil {
+				return err
+			}
+		}
 	}
 
-	// Handle note on messages: /midi/{channel}/note_on
-	// Using wildcard pattern for channels 0-15
-	for i := 0; i < 16; i++ {
-		path := fmt.Sprintf("/midi/%d/note_on", i)
-		dispatcher.AddMsgHandler(path, func(msg *osc.Message) {
-			if err := b.handleNoteOn(msg); err != nil {
-				debugHandlers("Error handling note_on: %v", err)
+	// Handle system exclusive messages: /midi/sysex
+	if err := b.addMsgHandler("/midi/sysex", b.handleSysEx); err != nil {
+		return err
+	}
+
+	// Handle MIDI 2.0 channel voice messages as Universal MIDI Packets
+	if err := b.addMsgHandler("/ump", b.handleUMP); err != nil {
+		return err
+	}
+
+	// Handle system common and real-time messages
+	systemHandlers := map[string]func(*osc.Message) error{
+		"/midi/song_position": b.handleSongPosition,
+		"/midi/song_select":   b.handleSongSelect,
+	}
+	for path := range transportStatus {
+		systemHandlers[path] = b.handleTransport
+	}
+	for path, handle := range systemHandlers {
+		if err := b.addMsgHandler(path, handle); err != nil {
+			return err
+		}
+	}
+
+	// The internal clock drives every output port, so it has no port prefix
+	clockHandlers := map[string]func(*osc.Message) error{
+		"/clock/bpm":   b.handleClockBPM,
+		"/clock/start": b.handleClockTransport,
+		"/clock/stop":  b.handleClockTransport,
+	}
+	for path, handle := range clockHandlers {
+		if err := dispatcher.AddMsgHandler(path, func(msg *osc.Message) {
+			if err := handle(msg); err != nil {
+				debugHandlers("Error handling %s: %v", path, err)
 			}
-		})
+		}); err != nil {
+			return err
+		}
 	}
 
-	// Handle note off messages: /midi/{channel}/note_off
-	for i := 0; i < 16; i++ {
-		path := fmt.Sprintf("/midi/%d/note_off", i)
-		dispatcher.AddMsgHandler(path, func(msg *osc.Message) {
-			if err := b.handleNoteOff(msg); err != nil {
-				debugHandlers("Error handling note_off: %v", err)
+	// Output subscriptions and the note table concern the bridge, not a port
+	bridgeHandlers := map[string]func(*osc.Message) error{
+		"/bridge/subscribe":   b.handleSubscribe,
+		"/bridge/unsubscribe": b.handleUnsubscribe,
+		"/bridge/notes":       b.handleNotes,
+	}
+	for path, handle := range bridgeHandlers {
+		if err := dispatcher.AddMsgHandler(path, func(msg *osc.Message) {
+			if err := handle(msg); err != nil {
+				fmt.Printf("WARNING: Rejected message: %v\n", err)
 			}
-		})
+		}); err != nil {
+			return err
+		}
 	}
 
-	debugHandlers("OSC handlers configured for /midi/{0-15}/note_on and /midi/{0-15}/note_off")
+	debugHandlers("OSC handlers configured for /midi/{%d-%d}/{note_on,note_off,cc,cc14,rpn,nrpn,pitch_bend,program,channel_pressure,poly_pressure}, /midi/sysex, /ump, transport, /clock and /bridge/{subscribe,unsubscribe,notes}", b.oscChannel(0), b.oscChannel(15))
+	return nil
 }
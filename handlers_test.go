@@ -1,9 +1,13 @@
 package main
 
 import (
+	"bytes"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/hypebeast/go-osc/osc"
+	"github.com/xthexder/go-jack"
 )
 
 func TestHandleNoteOn(t *testing.T) {
@@ -161,7 +165,16 @@ func TestSetupOSCHandlers(t *testing.T) {
 	}
 
 	// Should handle gracefully
-	bridge.setupOSCHandlers()
+	if err := bridge.setupOSCHandlers(); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	// Addresses that cannot be registered are reported
+	bridge = &Bridge{dispatcher: newOSCDispatcher()}
+	bridge.dispatcher.AddMsgHandler("/ump", func(*osc.Message) {})
+	if err := bridge.setupOSCHandlers(); err == nil || !strings.Contains(err.Error(), "/ump") {
+		t.Errorf("Expected error for /ump, got %v", err)
+	}
 }
 
 func TestQueueOverflow(t *testing.T) {
@@ -231,3 +244,465 @@ func TestMidiMessageFormat(t *testing.T) {
 		t.Errorf("Expected velocity 50, got %d", event.midiData.Buffer[2])
 	}
 }
+
+func TestHandleControlChange(t *testing.T) {
+	bridge := &Bridge{
+		eventQueue: make(chan *MidiEvent, 10),
+	}
+
+	tests := []struct {
+		name           string
+		message        *osc.Message
+		shouldError    bool
+		expectedStatus byte
+		expectedCC     byte
+		expectedValue  byte
+	}{
+		{
+			name: "volume on channel 0",
+			message: &osc.Message{
+				Address:   "/midi/0/cc",
+				Arguments: []interface{}{int32(7), int32(100)},
+			},
+			expectedStatus: 0xB0,
+			expectedCC:     7,
+			expectedValue:  100,
+		},
+		{
+			name: "mod wheel on channel 12",
+			message: &osc.Message{
+				Address:   "/midi/12/cc",
+				Arguments: []interface{}{1, float32(64.9)},
+			},
+			expectedStatus: 0xBC,
+			expectedCC:     1,
+			expectedValue:  64,
+		},
+		{
+			name: "value clamped to 7 bits",
+			message: &osc.Message{
+				Address:   "/midi/1/cc",
+				Arguments: []interface{}{int32(74), int32(200)},
+			},
+			expectedStatus: 0xB1,
+			expectedCC:     74,
+			expectedValue:  200 & 0x7F,
+		},
+		{
+			name: "missing value",
+			message: &osc.Message{
+				Address:   "/midi/0/cc",
+				Arguments: []interface{}{int32(7)},
+			},
+			shouldError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for len(bridge.eventQueue) > 0 {
+				<-bridge.eventQueue
+			}
+
+			err := bridge.handleControlChange(tt.message)
+			if (err != nil) != tt.shouldError {
+				t.Errorf("handleControlChange() error = %v, shouldError %v", err, tt.shouldError)
+			}
+			if err != nil {
+				return
+			}
+
+			select {
+			case event := <-bridge.eventQueue:
+				buf := event.midiData.Buffer
+				if len(buf) != 3 {
+					t.Fatalf("Expected 3-byte MIDI message, got %d bytes", len(buf))
+				}
+				if buf[0] != tt.expectedStatus {
+					t.Errorf("Expected status 0x%02X, got 0x%02X", tt.expectedStatus, buf[0])
+				}
+				if buf[1] != tt.expectedCC {
+					t.Errorf("Expected controller %d, got %d", tt.expectedCC, buf[1])
+				}
+				if buf[2] != tt.expectedValue {
+					t.Errorf("Expected value %d, got %d", tt.expectedValue, buf[2])
+				}
+			default:
+				t.Error("Expected event in queue but found none")
+			}
+		})
+	}
+}
+
+func TestSetupOSCHandlersRoutesCC(t *testing.T) {
+	bridge := &Bridge{
+		dispatcher: newOSCDispatcher(),
+		eventQueue: make(chan *MidiEvent, 10),
+	}
+	bridge.setupOSCHandlers()
+
+	bridge.dispatcher.Dispatch(osc.NewMessage("/midi/3/cc", int32(7), int32(90)))
+
+	select {
+	case event := <-bridge.eventQueue:
+		buf := event.midiData.Buffer
+		if buf[0] != 0xB3 || buf[1] != 7 || buf[2] != 90 {
+			t.Errorf("Expected CC message [B3 07 5A], got % X", buf)
+		}
+	default:
+		t.Error("Expected /midi/3/cc to be dispatched to the CC handler")
+	}
+}
+
+func TestChannelBase(t *testing.T) {
+	port := &bridgePort{}
+	bridge := &Bridge{
+		dispatcher:  newOSCDispatcher(),
+		eventQueue:  make(chan *MidiEvent, 10),
+		channelBase: 1,
+	}
+	bridge.setupOSCHandlers()
+
+	tests := []struct {
+		address string
+		status  byte // 0 means the message must be rejected
+	}{
+		{"/midi/1/note_on", 0x90},
+		{"/midi/16/note_on", 0x9F},
+		{"/midi/0/note_on", 0},
+		{"/midi/17/note_on", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			bridge.dispatcher.Dispatch(osc.NewMessage(tt.address, int32(60), int32(100)))
+			select {
+			case event := <-bridge.eventQueue:
+				if tt.status == 0 {
+					t.Errorf("Expected %s to be rejected, got % X", tt.address, event.midiData.Buffer)
+				} else if event.midiData.Buffer[0] != tt.status {
+					t.Errorf("Expected status %02X, got %02X", tt.status, event.midiData.Buffer[0])
+				}
+			default:
+				if tt.status != 0 {
+					t.Errorf("Expected %s to be handled", tt.address)
+				}
+			}
+		})
+	}
+
+	// Handlers reject out-of-range channels instead of using channel 0
+	if err := bridge.handleNoteOn(osc.NewMessage("/midi/0/note_on", int32(60), int32(100))); err == nil {
+		t.Error("Expected error for channel 0 with channel base 1")
+	}
+
+	// Outgoing paths use the same numbering
+	msg := bridge.parseIncomingMIDI(port, &jack.MidiData{Buffer: []byte{0x90, 60, 100}})
+	if msg == nil || msg.Address != "/midi/1/note_on" {
+		t.Errorf("Expected /midi/1/note_on for MIDI channel 1, got %v", msg)
+	}
+}
+
+func TestHandlePitchBend(t *testing.T) {
+	tests := []struct {
+		name        string
+		format      string
+		message     *osc.Message
+		shouldError bool
+		expected    []byte
+	}{
+		{
+			name:     "signed center",
+			message:  osc.NewMessage("/midi/0/pitch_bend", int32(0)),
+			expected: []byte{0xE0, 0x00, 0x40},
+		},
+		{
+			name:     "signed minimum",
+			message:  osc.NewMessage("/midi/2/pitch_bend", int32(-8192)),
+			expected: []byte{0xE2, 0x00, 0x00},
+		},
+		{
+			name:     "unsigned maximum",
+			format:   pitchBendUnsigned,
+			message:  osc.NewMessage("/midi/15/pitch_bend", int32(16383)),
+			expected: []byte{0xEF, 0x7F, 0x7F},
+		},
+		{
+			name:     "normalized float",
+			message:  osc.NewMessage("/midi/1/pitch_bend", float32(-0.5)),
+			expected: []byte{0xE1, 0x00, 0x20},
+		},
+		{
+			name:        "out of range",
+			message:     osc.NewMessage("/midi/0/pitch_bend", int32(9000)),
+			shouldError: true,
+		},
+		{
+			name:        "no arguments",
+			message:     osc.NewMessage("/midi/0/pitch_bend"),
+			shouldError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bridge := &Bridge{
+				eventQueue:      make(chan *MidiEvent, 1),
+				pitchBendFormat: tt.format,
+			}
+
+			err := bridge.handlePitchBend(tt.message)
+			if (err != nil) != tt.shouldError {
+				t.Fatalf("handlePitchBend() error = %v, shouldError %v", err, tt.shouldError)
+			}
+			if err != nil {
+				if len(bridge.eventQueue) != 0 {
+					t.Error("Expected no event to be queued on error")
+				}
+				return
+			}
+
+			event := <-bridge.eventQueue
+			if !bytes.Equal(event.midiData.Buffer, tt.expected) {
+				t.Errorf("Expected MIDI % X, got % X", tt.expected, event.midiData.Buffer)
+			}
+		})
+	}
+}
+
+func TestVariableLengthMessages(t *testing.T) {
+	bridge := &Bridge{
+		eventQueue: make(chan *MidiEvent, 1),
+	}
+
+	tests := []struct {
+		name     string
+		handle   func(*osc.Message) error
+		message  *osc.Message
+		expected []byte
+	}{
+		{
+			name:     "program change",
+			handle:   bridge.handleProgramChange,
+			message:  osc.NewMessage("/midi/4/program", int32(12)),
+			expected: []byte{0xC4, 12},
+		},
+		{
+			name:     "channel pressure",
+			handle:   bridge.handleChannelPressure,
+			message:  osc.NewMessage("/midi/0/channel_pressure", int32(100)),
+			expected: []byte{0xD0, 100},
+		},
+		{
+			name:     "poly pressure",
+			handle:   bridge.handlePolyPressure,
+			message:  osc.NewMessage("/midi/9/poly_pressure", int32(38), float32(70)),
+			expected: []byte{0xA9, 38, 70},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.handle(tt.message); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			event := <-bridge.eventQueue
+			if !bytes.Equal(event.midiData.Buffer, tt.expected) {
+				t.Errorf("Expected MIDI % X, got % X", tt.expected, event.midiData.Buffer)
+			}
+		})
+	}
+
+	// Missing arguments are rejected
+	if err := bridge.handleProgramChange(osc.NewMessage("/midi/0/program")); err == nil {
+		t.Error("Expected error for program change without arguments")
+	}
+	if err := bridge.handleChannelPressure(osc.NewMessage("/midi/0/channel_pressure")); err == nil {
+		t.Error("Expected error for channel pressure without arguments")
+	}
+	if err := bridge.handlePolyPressure(osc.NewMessage("/midi/0/poly_pressure", int32(60))); err == nil {
+		t.Error("Expected error for poly pressure without pressure")
+	}
+}
+
+func TestHandleSysEx(t *testing.T) {
+	dump := []byte{0xF0, 0x41, 0x10, 0x42, 0x12, 0x40, 0x00, 0x7F, 0x00, 0x41, 0xF7}
+
+	tests := []struct {
+		name        string
+		message     *osc.Message
+		expected    []byte
+		shouldError bool
+	}{
+		{
+			name:     "blob",
+			message:  osc.NewMessage("/midi/sysex", dump),
+			expected: dump,
+		},
+		{
+			name:     "int arguments",
+			message:  osc.NewMessage("/midi/sysex", int32(0xF0), int32(0x7E), int32(0x7F), int32(0x06), int32(0x01), int32(0xF7)),
+			expected: []byte{0xF0, 0x7E, 0x7F, 0x06, 0x01, 0xF7},
+		},
+		{
+			name:        "unterminated blob",
+			message:     osc.NewMessage("/midi/sysex", []byte{0xF0, 0x41, 0x10}),
+			shouldError: true,
+		},
+		{
+			name:        "int out of byte range",
+			message:     osc.NewMessage("/midi/sysex", int32(0xF0), int32(300), int32(0xF7)),
+			shouldError: true,
+		},
+		{
+			name:        "non-numeric argument",
+			message:     osc.NewMessage("/midi/sysex", int32(0xF0), "x", int32(0xF7)),
+			shouldError: true,
+		},
+		{
+			name:        "no arguments",
+			message:     osc.NewMessage("/midi/sysex"),
+			shouldError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bridge := &Bridge{
+				eventQueue: make(chan *MidiEvent, 1),
+			}
+
+			err := bridge.handleSysEx(tt.message)
+			if (err != nil) != tt.shouldError {
+				t.Fatalf("handleSysEx() error = %v, shouldError %v", err, tt.shouldError)
+			}
+			if err != nil {
+				return
+			}
+
+			event := <-bridge.eventQueue
+			if !bytes.Equal(event.midiData.Buffer, tt.expected) {
+				t.Errorf("Expected MIDI % X, got % X", tt.expected, event.midiData.Buffer)
+			}
+		})
+	}
+}
+
+func TestHandleSystemMessages(t *testing.T) {
+	bridge := &Bridge{
+		eventQueue: make(chan *MidiEvent, 1),
+	}
+
+	tests := []struct {
+		name        string
+		handle      func(*osc.Message) error
+		message     *osc.Message
+		expected    []byte
+		shouldError bool
+	}{
+		{"clock", bridge.handleTransport, osc.NewMessage("/midi/clock"), []byte{0xF8}, false},
+		{"start", bridge.handleTransport, osc.NewMessage("/midi/start"), []byte{0xFA}, false},
+		{"continue", bridge.handleTransport, osc.NewMessage("/midi/continue"), []byte{0xFB}, false},
+		{"stop", bridge.handleTransport, osc.NewMessage("/midi/stop"), []byte{0xFC}, false},
+		{"unknown transport", bridge.handleTransport, osc.NewMessage("/midi/rewind"), nil, true},
+		{"song position", bridge.handleSongPosition, osc.NewMessage("/midi/song_position", int32(300)), []byte{0xF2, 0x2C, 0x02}, false},
+		{"song position out of range", bridge.handleSongPosition, osc.NewMessage("/midi/song_position", int32(16384)), nil, true},
+		{"song position missing", bridge.handleSongPosition, osc.NewMessage("/midi/song_position"), nil, true},
+		{"song select", bridge.handleSongSelect, osc.NewMessage("/midi/song_select", int32(3)), []byte{0xF3, 0x03}, false},
+		{"song select out of range", bridge.handleSongSelect, osc.NewMessage("/midi/song_select", int32(128)), nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.handle(tt.message)
+			if (err != nil) != tt.shouldError {
+				t.Fatalf("error = %v, shouldError %v", err, tt.shouldError)
+			}
+			if err != nil {
+				return
+			}
+			event := <-bridge.eventQueue
+			if !bytes.Equal(event.midiData.Buffer, tt.expected) {
+				t.Errorf("Expected MIDI % X, got % X", tt.expected, event.midiData.Buffer)
+			}
+		})
+	}
+}
+
+func TestHandleClock(t *testing.T) {
+	bridge := &Bridge{clock: newClockGenerator(0)}
+
+	if err := bridge.handleClockBPM(osc.NewMessage("/clock/bpm", float32(128))); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if bpm := bridge.clock.BPM(); bpm != 128 {
+		t.Errorf("Expected tempo 128, got %g", bpm)
+	}
+	if err := bridge.handleClockBPM(osc.NewMessage("/clock/bpm", int32(90))); err != nil || bridge.clock.BPM() != 90 {
+		t.Errorf("Expected integer tempo 90, got %g (err %v)", bridge.clock.BPM(), err)
+	}
+	if err := bridge.handleClockBPM(osc.NewMessage("/clock/bpm", float32(-1))); err == nil {
+		t.Error("Expected error for negative tempo")
+	}
+	if err := bridge.handleClockBPM(osc.NewMessage("/clock/bpm")); err == nil {
+		t.Error("Expected error for missing tempo")
+	}
+
+	if err := bridge.handleClockTransport(osc.NewMessage("/clock/start")); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if events := bridge.clock.advance(64, 48000, nil); len(events) == 0 || events[0].status != 0xFA {
+		t.Errorf("Expected start to be generated, got %v", events)
+	}
+	if err := bridge.handleClockTransport(osc.NewMessage("/clock/stop")); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if events := bridge.clock.advance(64, 48000, nil); len(events) == 0 || events[0].status != 0xFC {
+		t.Errorf("Expected stop to be generated, got %v", events)
+	}
+
+	// Without --clock-bpm the clock is off, and neither plays nor turns on
+	bridge = &Bridge{}
+	if err := bridge.handleClockTransport(osc.NewMessage("/clock/start")); err == nil {
+		t.Error("Expected error with the clock off")
+	}
+	if err := bridge.handleClockBPM(osc.NewMessage("/clock/bpm", float32(120))); err == nil {
+		t.Error("Expected error with the clock off")
+	}
+}
+
+func TestQueueMidiEventBundleTime(t *testing.T) {
+	bridge := &Bridge{
+		dispatcher: newOSCDispatcher(),
+		eventQueue: make(chan *MidiEvent, 10),
+	}
+	bridge.setupOSCHandlers()
+
+	at := time.Now().Add(250 * time.Millisecond)
+	bundle := osc.NewBundle(at)
+	bundle.Append(osc.NewMessage("/midi/0/note_on", int32(60), int32(100)))
+	bundle.Append(osc.NewMessage("/midi/0/note_off", int32(60), int32(0)))
+	bridge.dispatcher.Dispatch(bundle)
+	bridge.dispatcher.Dispatch(osc.NewMessage("/midi/0/cc", int32(1), int32(2)))
+
+	if len(bridge.eventQueue) != 3 {
+		t.Fatalf("Expected 3 queued events, got %d", len(bridge.eventQueue))
+	}
+	for i := 0; i < 2; i++ {
+		event := <-bridge.eventQueue
+		if diff := event.at.Sub(at); diff > time.Microsecond || diff < -time.Microsecond {
+			t.Errorf("Expected event %d stamped %v, got %v", i, at, event.at)
+		}
+	}
+	if event := <-bridge.eventQueue; !event.at.IsZero() {
+		t.Errorf("Expected immediate event after the bundle, got %v", event.at)
+	}
+
+	// Timetags beyond the scheduling horizon are rejected
+	bundle = osc.NewBundle(time.Now().Add(2 * maxScheduleAhead))
+	bundle.Append(osc.NewMessage("/midi/0/note_on", int32(60), int32(100)))
+	bridge.dispatcher.Dispatch(bundle)
+	if len(bridge.eventQueue) != 0 {
+		t.Error("Expected far-future bundle to be rejected")
+	}
+}
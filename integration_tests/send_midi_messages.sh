@@ -10,15 +10,8 @@ set -x
 # Build our custom MIDI sender
 go build -o midi_sender midi_sender.go
 
-# Run our deterministic MIDI sender in background
-./midi_sender &
-midi_pid=$!
-
-# Wait for it to activate and create ports, then connect
-sleep 0.1
-jack_connect midi_sender:out osc-midi-bridge:midi_in
-
-# Wait for sequence to complete
-wait $midi_pid
+# Run our deterministic MIDI sender; the bridge connects to its port
+# itself (--connect-in) as soon as it appears
+./midi_sender
 
 echo "MIDI_TEST_COMPLETE"
\ No newline at end of file
@@ -5,4 +5,4 @@ echo "Waiting for jackd to be ready..."
 sleep 3
 
 echo "Starting bidirectional OSC-MIDI bridge..."
-DEBUG=* ../osc-midi-bridge --osc-target-port 8000
\ No newline at end of file
+DEBUG=* ../osc-midi-bridge --osc-target-port 8000 --connect-in '^midi_sender:out$'
\ No newline at end of file
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
@@ -16,52 +17,142 @@ var debugMain = debuggo.Debug("main")
 func main() {
 	// Command-line flags
 	var (
-		oscPort       = flag.Int("osc-port", 9000, "UDP port for OSC messages")
-		clientName    = flag.String("client-name", "osc-midi-bridge", "JACK client name")
-		portName      = flag.String("port-name", "midi_out", "JACK MIDI output port name")
-		listPorts     = flag.Bool("list-ports", false, "List available MIDI ports and exit")
-		oscTargetHost = flag.String("osc-target-host", "localhost", "Target host for outgoing OSC messages")
-		oscTargetPort = flag.Int("osc-target-port", 8000, "Target port for outgoing OSC messages")
+		oscPort         = flag.Int("osc-port", 9000, "Port for incoming OSC messages")
+		oscTransport    = flag.String("osc-transport", "udp", "OSC transport for input and output: udp, tcp-slip (OSC 1.1) or tcp-len (OSC 1.0 size-prefixed)")
+		backend         = flag.String("backend", "jack", "MIDI backend: jack or alsa (ALSA sequencer, Linux only)")
+		clientName      = flag.String("client-name", "osc-midi-bridge", "JACK or ALSA client name")
+		portName        = flag.String("port-name", "midi_out", "MIDI output port name")
+		inPortName      = flag.String("in-port-name", "midi_in", "MIDI input port name")
+		connectOut      = flag.String("connect-out", "", "Regexp of MIDI ports to connect the output port(s) to, re-applied as ports appear")
+		connectIn       = flag.String("connect-in", "", "Regexp of MIDI ports to connect to the input port(s), re-applied as ports appear")
+		listPorts       = flag.Bool("list-ports", false, "List available MIDI ports and exit")
+		listFormat      = flag.String("format", "text", "Output format of --list-ports: text or json")
+		wsPort          = flag.Int("ws-port", 0, "Port of a WebSocket endpoint for binary or JSON OSC (0 = off)")
+		wsOrigin        = flag.String("ws-origin", "", "Comma-separated origins of web pages allowed to use --ws-port besides the bridge's own, e.g. http://localhost:3000; * allows any")
+		oscTargetHost   = flag.String("osc-target-host", "localhost", "Target host for outgoing OSC messages")
+		oscTargetPort   = flag.Int("osc-target-port", 8000, "Target port for outgoing OSC messages")
+		clockDivider    = flag.Int("clock-divider", 1, "Emit one /midi/clock per N incoming MIDI clock ticks on each input port (24 = once per quarter note)")
+		clockBPM        = flag.Float64("clock-bpm", 0, "Generate MIDI clock at this tempo, following the JACK transport (0 = off)")
+		mappingFile     = flag.String("mapping", "", "YAML or JSON file mapping custom OSC addresses to MIDI messages")
+		channelBase     = flag.Int("channel-base", 0, "Number of MIDI channel 1 in OSC paths: 0 (/midi/0-15) or 1 (/midi/1-16)")
+		pitchBend       = flag.String("pitch-bend-format", "signed", "OSC pitch bend format: signed (-8192..8191), unsigned (0..16383) or float (-1.0..1.0)")
+		replyTo         = flag.String("reply-to", "off", "Also send MIDI→OSC output to OSC senders: off, last (most recent sender) or all (UDP only)")
+		replyFromServer = flag.Bool("reply-from-server", false, "Send --reply-to output from the --osc-port socket, for NAT and firewalls")
+		multicastGroup  = flag.String("multicast-group", "", "Also receive OSC sent to this IPv4 multicast group on --osc-port")
+		multicastTTL    = flag.Int("multicast-ttl", 1, "TTL of OSC sent to multicast targets (0 = this host only)")
+		multicastIface  = flag.String("multicast-iface", "", "Network interface for multicast input and output, e.g. eth0 (default: system choice)")
+		maxNoteDuration = flag.Duration("max-note-duration", 0, "Send a note-off for notes held longer than this, e.g. 30s (0 = never)")
+		allNotesOff     = flag.Bool("all-notes-off", false, "Follow note-offs for hanging notes with CC 123 (All Notes Off) on their channels")
+		midi2           = flag.Bool("midi2", false, "Send channel voice messages from MIDI input as MIDI 2.0 Universal MIDI Packets (/ump)")
+		mpeLower        = flag.Int("mpe-lower", 0, "MPE lower zone: number of member channels after manager channel 1 (0 = off)")
+		mpeUpper        = flag.Int("mpe-upper", 0, "MPE upper zone: number of member channels before manager channel 16 (0 = off)")
+		subscriptionTTL = flag.Duration("subscription-ttl", defaultSubscriptionTTL, "Lifetime of /bridge/subscribe targets unless renewed")
 	)
+	var ports portFlag
+	var targets oscTargetFlag
+	flag.Var(&targets, "osc-target", "OSC target as host:port or host:port/pattern, receiving only matching addresses; repeatable, replaces --osc-target-host/port")
+	flag.Var(&ports, "port", "Named MIDI port as name:in or name:out, addressed as /port/<name>/midi/...; repeatable")
 
 	flag.Parse()
 
 	// Handle list-ports flag
 	if *listPorts {
-		if err := ListJackPorts(); err != nil {
+		if err := ListPorts(*backend, *listFormat); err != nil {
 			log.Fatal(err)
 		}
 		os.Exit(0)
 	}
 
 	// Create bridge instance
-	bridge, err := NewBridge(*oscPort, *clientName, *portName, *oscTargetHost, *oscTargetPort)
+	bridge, err := NewBridge(Config{
+		OSCPort:         *oscPort,
+		OSCTransport:    *oscTransport,
+		WSPort:          *wsPort,
+		WSOrigin:        *wsOrigin,
+		ClientName:      *clientName,
+		PortName:        *portName,
+		OSCTargetHost:   *oscTargetHost,
+		OSCTargetPort:   *oscTargetPort,
+		OSCTargets:      targets,
+		SubscriptionTTL: *subscriptionTTL,
+		ReplyTo:         *replyTo,
+		ReplyFromServer: *replyFromServer,
+		MulticastGroup:  *multicastGroup,
+		MulticastTTL:    *multicastTTL,
+		MulticastIface:  *multicastIface,
+		PitchBendFormat: *pitchBend,
+		ClockDivider:    *clockDivider,
+		ClockBPM:        *clockBPM,
+		MappingFile:     *mappingFile,
+		ChannelBase:     *channelBase,
+		Backend:         *backend,
+		Ports:           ports,
+		InPortName:      *inPortName,
+		ConnectOut:      *connectOut,
+		ConnectIn:       *connectIn,
+		MPELowerZone:    *mpeLower,
+		MPEUpperZone:    *mpeUpper,
+		MIDI2:           *midi2,
+		MaxNoteDuration: *maxNoteDuration,
+		AllNotesOff:     *allNotesOff,
+	})
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	// Setup signal handling
-	setupSignalHandler()
+	// SIGINT and SIGTERM stop the bridge; once it is stopping, the default
+	// handling returns, so a second signal exits at once
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 
 	// Start the bridge
 	debugMain("Starting OSC-MIDI bridge on port %d", *oscPort)
 	fmt.Printf("OSC-MIDI Bridge started\n")
-	fmt.Printf("  OSC Port: %d\n", *oscPort)
-	fmt.Printf("  JACK Client: %s\n", *clientName)
-	fmt.Printf("  MIDI Port: %s\n", *portName)
-
-	if err := bridge.Start(); err != nil {
-		log.Fatal(err)
+	fmt.Printf("  OSC Port: %d (%s)\n", *oscPort, *oscTransport)
+	if len(targets) > 0 {
+		fmt.Printf("  OSC Targets: %s\n", targets.String())
+	} else {
+		fmt.Printf("  OSC Target: %s:%d\n", *oscTargetHost, *oscTargetPort)
+	}
+	if *multicastGroup != "" {
+		fmt.Printf("  Multicast Group: %s\n", *multicastGroup)
+	}
+	if *replyTo != replyOff {
+		fmt.Printf("  Reply To: %s sender\n", *replyTo)
+	}
+	if *wsPort > 0 {
+		fmt.Printf("  WebSocket Port: %d\n", *wsPort)
+		if *wsOrigin != "" {
+			fmt.Printf("  WebSocket Origins: %s\n", *wsOrigin)
+		}
+	}
+	fmt.Printf("  MIDI Backend: %s\n", *backend)
+	fmt.Printf("  Client: %s\n", *clientName)
+	if len(ports) > 0 {
+		fmt.Printf("  MIDI Ports: %s\n", ports.String())
+	} else {
+		fmt.Printf("  MIDI Ports: %s (out), %s (in)\n", *portName, *inPortName)
+	}
+	if *mpeLower > 0 || *mpeUpper > 0 {
+		fmt.Printf("  MPE Zones: %d lower, %d upper member channels\n", *mpeLower, *mpeUpper)
+	}
+	if *midi2 {
+		fmt.Printf("  MIDI Output to OSC: MIDI 2.0 (/ump)\n")
+	}
+	if *clockBPM > 0 {
+		fmt.Printf("  MIDI Clock: %g BPM\n", *clockBPM)
 	}
-}
-
-func setupSignalHandler() {
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 
-	go func() {
-		<-sigChan
-		fmt.Println("Received SIGTERM, exiting.")
-		os.Exit(0)
-	}()
+	// Exit status 1 if the bridge failed or dropped events while stopping
+	status := 0
+	if err := bridge.Start(ctx); err != nil {
+		log.Print(err)
+		status = 1
+	}
+	stop()
+	fmt.Println("Shutting down...")
+	if err := bridge.Cleanup(); err != nil {
+		log.Print(err)
+		status = 1
+	}
+	os.Exit(status)
 }
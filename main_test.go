@@ -4,6 +4,7 @@ import (
 	"flag"
 	"os"
 	"testing"
+	"time"
 )
 
 func TestMainFunction(t *testing.T) {
@@ -32,12 +33,32 @@ func TestCLIFlags(t *testing.T) {
 			args: []string{"osc-midi-bridge"},
 			test: func(t *testing.T) {
 				var (
-					oscPort       = flag.Int("osc-port", 9000, "UDP port for OSC messages")
-					clientName    = flag.String("client-name", "osc-midi-bridge", "JACK client name")
-					portName      = flag.String("port-name", "midi_out", "JACK MIDI output port name")
+					oscPort       = flag.Int("osc-port", 9000, "Port for incoming OSC messages")
+					oscTransport  = flag.String("osc-transport", "udp", "OSC transport for input and output: udp, tcp-slip (OSC 1.1) or tcp-len (OSC 1.0 size-prefixed)")
+					ttl           = flag.Duration("subscription-ttl", defaultSubscriptionTTL, "Lifetime of /bridge/subscribe targets unless renewed")
+					multicastTTL  = flag.Int("multicast-ttl", 1, "TTL of OSC sent to multicast targets (0 = this host only)")
+					replyTo       = flag.String("reply-to", "off", "Also send MIDI→OSC output to OSC senders: off, last (most recent sender) or all (UDP only)")
+					replyFrom     = flag.Bool("reply-from-server", false, "Send --reply-to output from the --osc-port socket, for NAT and firewalls")
+					wsPort        = flag.Int("ws-port", 0, "Port of a WebSocket endpoint for binary or JSON OSC (0 = off)")
+					wsOrigin      = flag.String("ws-origin", "", "Comma-separated origins of web pages allowed to use --ws-port besides the bridge's own, e.g. http://localhost:3000; * allows any")
+					clientName    = flag.String("client-name", "osc-midi-bridge", "JACK or ALSA client name")
+					portName      = flag.String("port-name", "midi_out", "MIDI output port name")
+					inPortName    = flag.String("in-port-name", "midi_in", "MIDI input port name")
+					connectOut    = flag.String("connect-out", "", "Regexp of MIDI ports to connect the output port(s) to, re-applied as ports appear")
+					connectIn     = flag.String("connect-in", "", "Regexp of MIDI ports to connect to the input port(s), re-applied as ports appear")
 					listPorts     = flag.Bool("list-ports", false, "List available MIDI ports and exit")
+					listFormat    = flag.String("format", "text", "Output format of --list-ports: text or json")
 					oscTargetHost = flag.String("osc-target-host", "localhost", "Target host for outgoing OSC messages")
 					oscTargetPort = flag.Int("osc-target-port", 8000, "Target port for outgoing OSC messages")
+					clockDivider  = flag.Int("clock-divider", 1, "Emit one /midi/clock per N incoming MIDI clock ticks on each input port (24 = once per quarter note)")
+					backend       = flag.String("backend", "jack", "MIDI backend: jack or alsa (ALSA sequencer, Linux only)")
+					maxNoteDur    = flag.Duration("max-note-duration", 0, "Send a note-off for notes held longer than this, e.g. 30s (0 = never)")
+					allNotesOff   = flag.Bool("all-notes-off", false, "Follow note-offs for hanging notes with CC 123 (All Notes Off) on their channels")
+					midi2         = flag.Bool("midi2", false, "Send channel voice messages from MIDI input as MIDI 2.0 Universal MIDI Packets (/ump)")
+					mpeLower      = flag.Int("mpe-lower", 0, "MPE lower zone: number of member channels after manager channel 1 (0 = off)")
+					mpeUpper      = flag.Int("mpe-upper", 0, "MPE upper zone: number of member channels before manager channel 16 (0 = off)")
+					channelBase   = flag.Int("channel-base", 0, "Number of MIDI channel 1 in OSC paths: 0 (/midi/0-15) or 1 (/midi/1-16)")
+					pitchBend     = flag.String("pitch-bend-format", "signed", "OSC pitch bend format: signed (-8192..8191), unsigned (0..16383) or float (-1.0..1.0)")
 				)
 
 				flag.Parse()
@@ -45,21 +66,72 @@ func TestCLIFlags(t *testing.T) {
 				if *oscPort != 9000 {
 					t.Errorf("Expected default osc-port 9000, got %d", *oscPort)
 				}
+				if *oscTransport != "udp" {
+					t.Errorf("Expected default osc-transport 'udp', got '%s'", *oscTransport)
+				}
+				if *ttl != time.Minute {
+					t.Errorf("Expected default subscription-ttl 1m, got %s", *ttl)
+				}
+				if *multicastTTL != 1 {
+					t.Errorf("Expected default multicast-ttl 1, got %d", *multicastTTL)
+				}
+				if *replyTo != replyOff {
+					t.Errorf("Expected default reply-to 'off', got '%s'", *replyTo)
+				}
+				if *replyFrom != false {
+					t.Errorf("Expected default reply-from-server false, got %t", *replyFrom)
+				}
+				if *wsPort != 0 {
+					t.Errorf("Expected default ws-port 0, got %d", *wsPort)
+				}
+				if *wsOrigin != "" {
+					t.Errorf("Expected no default ws-origin, got '%s'", *wsOrigin)
+				}
 				if *clientName != "osc-midi-bridge" {
 					t.Errorf("Expected default client-name 'osc-midi-bridge', got '%s'", *clientName)
 				}
 				if *portName != "midi_out" {
 					t.Errorf("Expected default port-name 'midi_out', got '%s'", *portName)
 				}
+				if *inPortName != "midi_in" {
+					t.Errorf("Expected default in-port-name 'midi_in', got '%s'", *inPortName)
+				}
+				if *connectOut != "" || *connectIn != "" {
+					t.Errorf("Expected no default connect-out/connect-in, got '%s'/'%s'", *connectOut, *connectIn)
+				}
 				if *listPorts != false {
 					t.Errorf("Expected default list-ports false, got %t", *listPorts)
 				}
+				if *listFormat != "text" {
+					t.Errorf("Expected default format 'text', got '%s'", *listFormat)
+				}
 				if *oscTargetHost != "localhost" {
 					t.Errorf("Expected default osc-target-host 'localhost', got '%s'", *oscTargetHost)
 				}
 				if *oscTargetPort != 8000 {
 					t.Errorf("Expected default osc-target-port 8000, got %d", *oscTargetPort)
 				}
+				if *clockDivider != 1 {
+					t.Errorf("Expected default clock-divider 1, got %d", *clockDivider)
+				}
+				if *backend != "jack" {
+					t.Errorf("Expected default backend 'jack', got '%s'", *backend)
+				}
+				if *maxNoteDur != 0 || *allNotesOff {
+					t.Errorf("Expected no max-note-duration or all-notes-off by default, got %s, %t", *maxNoteDur, *allNotesOff)
+				}
+				if *midi2 {
+					t.Errorf("Expected default midi2 false, got %t", *midi2)
+				}
+				if *mpeLower != 0 || *mpeUpper != 0 {
+					t.Errorf("Expected MPE off by default, got mpe-lower %d, mpe-upper %d", *mpeLower, *mpeUpper)
+				}
+				if *channelBase != 0 {
+					t.Errorf("Expected default channel-base 0, got %d", *channelBase)
+				}
+				if *pitchBend != "signed" {
+					t.Errorf("Expected default pitch-bend-format 'signed', got '%s'", *pitchBend)
+				}
 			},
 		},
 		{
@@ -67,7 +139,7 @@ func TestCLIFlags(t *testing.T) {
 			args: []string{"osc-midi-bridge", "--osc-port=7000", "--osc-target-host=192.168.1.100", "--osc-target-port=9000"},
 			test: func(t *testing.T) {
 				var (
-					oscPort       = flag.Int("osc-port", 9000, "UDP port for OSC messages")
+					oscPort       = flag.Int("osc-port", 9000, "Port for incoming OSC messages")
 					oscTargetHost = flag.String("osc-target-host", "localhost", "Target host for outgoing OSC messages")
 					oscTargetPort = flag.Int("osc-target-port", 8000, "Target port for outgoing OSC messages")
 				)
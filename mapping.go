@@ -0,0 +1,389 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hypebeast/go-osc/osc"
+	"gopkg.in/yaml.v3"
+)
+
+// mappingFile is the on-disk format of a --mapping file (YAML or JSON):
+//
+//	mappings:
+//	  - osc: /mixer/fader/3   # OSC address
+//	    args: f               # OSC type tags, checked on input and used for output (optional)
+//	    midi: cc              # MIDI message type
+//	    channel: 2            # MIDI channel, numbered like /midi/{channel} paths
+//	    number: 7             # controller or note number...
+//	    number_arg: 1         # ...or the OSC argument that carries it
+//	    value_arg: 0          # OSC argument carrying the value (default 0)
+//	    range: [0, 1]         # OSC value range scaled onto the MIDI range
+//	    direction: both       # in (OSC→MIDI), out (MIDI→OSC) or both (default)
+//	ports:                    # named MIDI ports, like --port (optional)
+//	  - name: drums
+//	    direction: out
+type mappingFile struct {
+	Mappings []mappingRule `yaml:"mappings" json:"mappings"`
+	Ports    []mappingPort `yaml:"ports" json:"ports"`
+}
+
+type mappingPort struct {
+	Name      string `yaml:"name" json:"name"`
+	Direction string `yaml:"direction" json:"direction"`
+}
+
+type mappingRule struct {
+	OSC       string    `yaml:"osc" json:"osc"`
+	Args      string    `yaml:"args" json:"args"`
+	MIDI      string    `yaml:"midi" json:"midi"`
+	Channel   int       `yaml:"channel" json:"channel"`
+	Number    *int      `yaml:"number" json:"number"`
+	NumberArg *int      `yaml:"number_arg" json:"number_arg"`
+	ValueArg  int       `yaml:"value_arg" json:"value_arg"`
+	Range     []float64 `yaml:"range" json:"range"`
+	Direction string    `yaml:"direction" json:"direction"`
+
+	// Derived by validate
+	status   uint8   // MIDI status nibble
+	maxValue float64 // Largest MIDI value for the message type
+	oscMin   float64 // OSC value mapped to MIDI 0
+	oscMax   float64 // OSC value mapped to maxValue
+	in, out  bool    // Enabled directions
+	outTypes []byte  // OSC type tag per outgoing argument
+	channel  uint8   // MIDI channel (0-15)
+}
+
+// mappingMessageTypes lists the MIDI messages a rule can map to, with their
+// status nibble and whether they take a number (note or controller).
+var mappingMessageTypes = map[string]struct {
+	status    uint8
+	hasNumber bool
+	maxValue  float64
+}{
+	"note_on":          {0x90, true, 127},
+	"note_off":         {0x80, true, 127},
+	"poly_pressure":    {0xA0, true, 127},
+	"cc":               {0xB0, true, 127},
+	"program":          {0xC0, false, 127},
+	"channel_pressure": {0xD0, false, 127},
+	"pitch_bend":       {0xE0, false, 16383},
+}
+
+// mappingTable holds the validated rules of a mapping file, indexed by
+// direction.
+type mappingTable struct {
+	in    map[string][]*mappingRule // OSC address → rules producing MIDI
+	out   []*mappingRule            // Rules producing OSC from MIDI, in file order
+	ports []PortConfig              // Named ports declared by the file
+}
+
+// loadMappings reads and validates a mapping file. JSON is used for .json
+// files, YAML otherwise. All invalid rules are reported together.
+func loadMappings(path string, channelBase int) (*mappingTable, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read mapping file: %w", err)
+	}
+
+	var file mappingFile
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(&file)
+	} else {
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		err = decoder.Decode(&file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse mapping file %s: %w", path, err)
+	}
+
+	table, err := newMappingTable(file.Mappings, channelBase)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mapping file %s:\n%w", path, err)
+	}
+
+	var errs []error
+	for i, p := range file.Ports {
+		dir, err := parsePortDirection(p.Direction)
+		if err == nil {
+			err = validatePortName(p.Name)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("  port %d (%s): %w", i+1, p.Name, err))
+			continue
+		}
+		table.ports = append(table.ports, PortConfig{Name: p.Name, Direction: dir})
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("invalid mapping file %s:\n%w", path, errors.Join(errs...))
+	}
+	return table, nil
+}
+
+func newMappingTable(rules []mappingRule, channelBase int) (*mappingTable, error) {
+	table := &mappingTable{in: make(map[string][]*mappingRule)}
+
+	var errs []error
+	for i := range rules {
+		rule := &rules[i]
+		if err := rule.validate(channelBase); err != nil {
+			errs = append(errs, fmt.Errorf("  rule %d (%s): %w", i+1, rule.OSC, err))
+			continue
+		}
+		if rule.in {
+			table.in[rule.OSC] = append(table.in[rule.OSC], rule)
+		}
+		if rule.out {
+			table.out = append(table.out, rule)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return table, nil
+}
+
+// validate checks a rule and fills in its derived fields. Channels are
+// numbered from channelBase, like /midi/{channel} paths.
+func (r *mappingRule) validate(channelBase int) error {
+	if !strings.HasPrefix(r.OSC, "/") {
+		return errors.New("osc address must start with /")
+	}
+	if strings.ContainsAny(r.OSC, "*?,[]{}# ") {
+		return errors.New("osc address may not contain any of *?,[]{}# or spaces")
+	}
+
+	msgType, ok := mappingMessageTypes[r.MIDI]
+	if !ok {
+		return fmt.Errorf("unknown midi type %q", r.MIDI)
+	}
+	r.status = msgType.status
+	r.maxValue = msgType.maxValue
+
+	if r.Channel < channelBase || r.Channel > channelBase+15 {
+		return fmt.Errorf("channel %d out of range %d-%d", r.Channel, channelBase, channelBase+15)
+	}
+	r.channel = uint8(r.Channel - channelBase)
+
+	switch {
+	case !msgType.hasNumber && (r.Number != nil || r.NumberArg != nil):
+		return fmt.Errorf("%s does not take a number", r.MIDI)
+	case msgType.hasNumber && (r.Number == nil) == (r.NumberArg == nil):
+		return fmt.Errorf("%s needs exactly one of number or number_arg", r.MIDI)
+	case r.Number != nil && (*r.Number < 0 || *r.Number > 127):
+		return fmt.Errorf("number %d out of range 0-127", *r.Number)
+	case r.NumberArg != nil && *r.NumberArg < 0:
+		return fmt.Errorf("number_arg %d must not be negative", *r.NumberArg)
+	case r.NumberArg != nil && *r.NumberArg == r.ValueArg:
+		return errors.New("number_arg and value_arg must differ")
+	case r.ValueArg < 0:
+		return fmt.Errorf("value_arg %d must not be negative", r.ValueArg)
+	}
+
+	switch len(r.Range) {
+	case 0:
+		r.oscMin, r.oscMax = 0, r.maxValue
+	case 2:
+		r.oscMin, r.oscMax = r.Range[0], r.Range[1]
+		if r.oscMin == r.oscMax {
+			return errors.New("range must not be empty")
+		}
+	default:
+		return fmt.Errorf("range needs 2 values, got %d", len(r.Range))
+	}
+
+	switch r.Direction {
+	case "", "both":
+		r.in, r.out = true, true
+	case "in":
+		r.in = true
+	case "out":
+		r.out = true
+	default:
+		return fmt.Errorf("unknown direction %q (expected in, out or both)", r.Direction)
+	}
+
+	argCount := r.ValueArg + 1
+	if r.NumberArg != nil && *r.NumberArg+1 > argCount {
+		argCount = *r.NumberArg + 1
+	}
+	if r.Args != "" {
+		if len(r.Args) < argCount {
+			return fmt.Errorf("args %q has no type for argument %d", r.Args, argCount-1)
+		}
+		for _, tag := range r.Args {
+			if !strings.ContainsRune("ifdh", tag) {
+				return fmt.Errorf("unsupported type tag %q in args (expected i, f, d or h)", tag)
+			}
+		}
+	}
+
+	if r.out {
+		// Outgoing messages carry exactly the value and number arguments
+		if r.NumberArg == nil && argCount != 1 || r.NumberArg != nil && argCount != 2 {
+			return errors.New("outgoing mappings need value_arg and number_arg to cover arguments from 0 without gaps")
+		}
+		r.outTypes = make([]byte, argCount)
+		for i := range r.outTypes {
+			switch {
+			case r.Args != "":
+				r.outTypes[i] = r.Args[i]
+			case i == r.ValueArg && len(r.Range) > 0:
+				r.outTypes[i] = 'f' // Scaled values are fractional
+			default:
+				r.outTypes[i] = 'i'
+			}
+		}
+	}
+
+	return nil
+}
+
+// midiValue scales an OSC value onto the rule's MIDI range, clamping
+// values outside the OSC range.
+func (r *mappingRule) midiValue(v float64) uint16 {
+	scaled := math.Round((v - r.oscMin) / (r.oscMax - r.oscMin) * r.maxValue)
+	return uint16(math.Max(0, math.Min(r.maxValue, scaled)))
+}
+
+// oscValue scales a MIDI value back onto the rule's OSC range.
+func (r *mappingRule) oscValue(v uint16) float64 {
+	return r.oscMin + float64(v)/r.maxValue*(r.oscMax-r.oscMin)
+}
+
+// mappedMidiEvent builds the MIDI message a rule produces for an incoming
+// OSC message.
+func (b *Bridge) mappedMidiEvent(r *mappingRule, msg *osc.Message) (*MidiEvent, error) {
+	if r.Args != "" {
+		tags, err := msg.TypeTags()
+		if err != nil {
+			return nil, err
+		}
+		if !strings.HasPrefix(tags[1:], r.Args) {
+			return nil, fmt.Errorf("expected type tags %s, got %s", r.Args, tags[1:])
+		}
+	}
+
+	if r.ValueArg >= len(msg.Arguments) {
+		return nil, fmt.Errorf("missing value argument %d", r.ValueArg)
+	}
+	v, ok := toFloat64(msg.Arguments[r.ValueArg])
+	if !ok {
+		return nil, fmt.Errorf("value argument %d is not a number: %v", r.ValueArg, msg.Arguments[r.ValueArg])
+	}
+	value := r.midiValue(v)
+
+	switch {
+	case r.status == 0xE0:
+		return b.createMidiEvent(r.status, r.channel, uint8(value&0x7F), uint8(value>>7)), nil
+	case r.Number == nil && r.NumberArg == nil:
+		return b.createMidiEvent(r.status, r.channel, uint8(value)), nil
+	}
+
+	var number uint8
+	if r.Number != nil {
+		number = uint8(*r.Number)
+	} else {
+		if *r.NumberArg >= len(msg.Arguments) {
+			return nil, fmt.Errorf("missing number argument %d", *r.NumberArg)
+		}
+		n, ok := toInt(msg.Arguments[*r.NumberArg])
+		if !ok || n < 0 || n > 127 {
+			return nil, fmt.Errorf("number argument %d out of range 0-127: %v", *r.NumberArg, msg.Arguments[*r.NumberArg])
+		}
+		number = uint8(n)
+	}
+	return b.createMidiEvent(r.status, r.channel, number, uint8(value)), nil
+}
+
+// handleMapped applies every rule registered for the message's address.
+func (b *Bridge) handleMapped(rules []*mappingRule, msg *osc.Message) error {
+	var errs []error
+	for _, r := range rules {
+		event, err := b.mappedMidiEvent(r, msg)
+		if err == nil {
+			err = b.queueMidiEvent(event)
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		fmt.Printf("MAPPED %s -> % X\n", msg.Address, event.midiData.Buffer)
+	}
+	return errors.Join(errs...)
+}
+
+// setupMappingHandlers registers the OSC→MIDI rules with the dispatcher,
+// including under each named output port's prefix. It fails if a mapped
+// address is already handled, e.g. by a /midi path.
+func (b *Bridge) setupMappingHandlers() error {
+	if b.mappings == nil || b.dispatcher == nil {
+		return nil
+	}
+
+	for addr, rules := range b.mappings.in {
+		if err := b.addMsgHandler(addr, func(msg *osc.Message) error {
+			return b.handleMapped(rules, msg)
+		}); err != nil {
+			return fmt.Errorf("mapping for %s: %w", addr, err)
+		}
+	}
+	return nil
+}
+
+// mapIncomingMIDI returns the OSC message of the first outgoing rule
+// matching a channel voice message, or nil if none applies.
+func (b *Bridge) mapIncomingMIDI(status, channel uint8, data []byte) *osc.Message {
+	if b.mappings == nil {
+		return nil
+	}
+
+	for _, r := range b.mappings.out {
+		if r.status != status || r.channel != channel {
+			continue
+		}
+
+		var number uint8
+		var value uint16
+		switch {
+		case status == 0xE0:
+			value = uint16(data[1]&0x7F)<<7 | uint16(data[0]&0x7F)
+		case r.Number == nil && r.NumberArg == nil:
+			value = uint16(data[0] & 0x7F)
+		default:
+			number, value = data[0]&0x7F, uint16(data[1]&0x7F)
+			if r.Number != nil && uint8(*r.Number) != number {
+				continue
+			}
+		}
+
+		args := make([]interface{}, len(r.outTypes))
+		for i, tag := range r.outTypes {
+			v := float64(number)
+			if i == r.ValueArg {
+				v = r.oscValue(value)
+			}
+			switch tag {
+			case 'f':
+				args[i] = float32(v)
+			case 'd':
+				args[i] = v
+			case 'h':
+				args[i] = int64(math.Round(v))
+			default:
+				args[i] = int32(math.Round(v))
+			}
+		}
+		return osc.NewMessage(r.OSC, args...)
+	}
+	return nil
+}
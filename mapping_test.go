@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hypebeast/go-osc/osc"
+	"github.com/xthexder/go-jack"
+)
+
+const testMappingYAML = `
+mappings:
+  - osc: /mixer/fader/3
+    args: f
+    midi: cc
+    channel: 2
+    number: 7
+    range: [0, 1]
+  - osc: /keys/play
+    midi: note_on
+    channel: 0
+    number_arg: 0
+    value_arg: 1
+    direction: in
+  - osc: /bend
+    midi: pitch_bend
+    channel: 1
+    range: [-1, 1]
+  - osc: /pressure
+    midi: channel_pressure
+    channel: 3
+    direction: out
+`
+
+func writeMappingFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func newMappedBridge(t *testing.T, content string) *Bridge {
+	t.Helper()
+	mappings, err := loadMappings(writeMappingFile(t, "mapping.yaml", content), 0)
+	if err != nil {
+		t.Fatalf("Unexpected error loading mappings: %v", err)
+	}
+	bridge := &Bridge{
+		dispatcher: newOSCDispatcher(),
+		eventQueue: make(chan *MidiEvent, 10),
+		mappings:   mappings,
+	}
+	bridge.setupOSCHandlers()
+	if err := bridge.setupMappingHandlers(); err != nil {
+		t.Fatalf("Unexpected error registering mappings: %v", err)
+	}
+	return bridge
+}
+
+func TestLoadMappingsFormats(t *testing.T) {
+	yamlTable, err := loadMappings(writeMappingFile(t, "mapping.yaml", testMappingYAML), 0)
+	if err != nil {
+		t.Fatalf("YAML: unexpected error: %v", err)
+	}
+	if len(yamlTable.in) != 3 || len(yamlTable.out) != 3 {
+		t.Errorf("YAML: expected 3 input and 3 output rules, got %d and %d", len(yamlTable.in), len(yamlTable.out))
+	}
+
+	json := `{"mappings": [{"osc": "/mixer/fader/3", "midi": "cc", "channel": 2, "number": 7, "range": [0, 1]}]}`
+	jsonTable, err := loadMappings(writeMappingFile(t, "mapping.json", json), 0)
+	if err != nil {
+		t.Fatalf("JSON: unexpected error: %v", err)
+	}
+	if rules := jsonTable.in["/mixer/fader/3"]; len(rules) != 1 || rules[0].status != 0xB0 {
+		t.Errorf("JSON: expected CC rule for /mixer/fader/3, got %v", rules)
+	}
+
+	// Unknown fields are reported rather than silently ignored
+	if _, err := loadMappings(writeMappingFile(t, "typo.json", `{"mappings": [{"osc": "/a", "midi": "cc", "controler": 7}]}`), 0); err == nil {
+		t.Error("JSON: expected error for unknown field")
+	}
+	if _, err := loadMappings(writeMappingFile(t, "typo.yaml", "mappings:\n  - osc: /a\n    midi: cc\n    controler: 7\n"), 0); err == nil {
+		t.Error("YAML: expected error for unknown field")
+	}
+	if _, err := loadMappings(filepath.Join(t.TempDir(), "missing.yaml"), 0); err == nil {
+		t.Error("Expected error for missing file")
+	}
+}
+
+func TestLoadMappingsValidation(t *testing.T) {
+	content := `
+mappings:
+  - osc: /ok
+    midi: program
+    channel: 0
+  - osc: no/slash
+    midi: cc
+    number: 1
+  - osc: /bad/type
+    midi: aftertouch
+  - osc: /bad/channel
+    midi: cc
+    channel: 16
+    number: 1
+  - osc: /missing/number
+    midi: note_on
+  - osc: /program/number
+    midi: program
+    number: 3
+  - osc: /empty/range
+    midi: cc
+    number: 1
+    range: [1, 1]
+  - osc: /gap
+    midi: cc
+    number: 1
+    value_arg: 2
+  - osc: /bad/direction
+    midi: cc
+    number: 1
+    direction: sideways
+`
+	_, err := loadMappings(writeMappingFile(t, "mapping.yaml", content), 0)
+	if err == nil {
+		t.Fatal("Expected validation error")
+	}
+
+	msg := err.Error()
+	for _, expected := range []string{
+		"rule 2 (no/slash)",
+		"rule 3 (/bad/type): unknown midi type",
+		"rule 4 (/bad/channel): channel 16",
+		"rule 5 (/missing/number)",
+		"rule 6 (/program/number)",
+		"rule 7 (/empty/range)",
+		"rule 8 (/gap)",
+		"rule 9 (/bad/direction)",
+	} {
+		if !strings.Contains(msg, expected) {
+			t.Errorf("Expected error to mention %q, got:\n%s", expected, msg)
+		}
+	}
+	if strings.Contains(msg, "rule 1 ") {
+		t.Errorf("Valid rule 1 should not be reported:\n%s", msg)
+	}
+}
+
+func TestLoadMappingsPorts(t *testing.T) {
+	content := `
+ports:
+  - name: drums
+    direction: out
+  - name: keys
+    direction: in
+`
+	table, err := loadMappings(writeMappingFile(t, "ports.yaml", content), 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := []PortConfig{{"drums", portOutput}, {"keys", portInput}}
+	if len(table.ports) != len(want) || table.ports[0] != want[0] || table.ports[1] != want[1] {
+		t.Errorf("Expected %v, got %v", want, table.ports)
+	}
+
+	content = `
+ports:
+  - name: drums
+    direction: sideways
+  - name: a/b
+    direction: out
+`
+	_, err = loadMappings(writeMappingFile(t, "ports.yaml", content), 0)
+	if err == nil || !strings.Contains(err.Error(), "port 1 (drums)") || !strings.Contains(err.Error(), "port 2 (a/b)") {
+		t.Errorf("Expected both invalid ports to be reported, got %v", err)
+	}
+}
+
+func TestMappingChannelBase(t *testing.T) {
+	rules := func(channel int) []mappingRule {
+		return []mappingRule{{OSC: "/a", MIDI: "program", Channel: channel}}
+	}
+
+	table, err := newMappingTable(rules(16), 1)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if ch := table.in["/a"][0].channel; ch != 15 {
+		t.Errorf("Expected channel 16 with base 1 to be MIDI channel 15, got %d", ch)
+	}
+	if _, err := newMappingTable(rules(0), 1); err == nil {
+		t.Error("Expected channel 0 to be rejected with base 1")
+	}
+}
+
+func TestMappedOSCToMIDI(t *testing.T) {
+	bridge := newMappedBridge(t, testMappingYAML)
+
+	tests := []struct {
+		message  *osc.Message
+		expected []byte
+	}{
+		{osc.NewMessage("/mixer/fader/3", float32(0.5)), []byte{0xB2, 7, 64}},
+		{osc.NewMessage("/mixer/fader/3", float32(1)), []byte{0xB2, 7, 127}},
+		{osc.NewMessage("/mixer/fader/3", float32(1.7)), []byte{0xB2, 7, 127}}, // Clamped
+		{osc.NewMessage("/keys/play", int32(60), int32(100)), []byte{0x90, 60, 100}},
+		{osc.NewMessage("/bend", float32(0)), []byte{0xE1, 0x00, 0x40}},
+		{osc.NewMessage("/bend", float32(-1)), []byte{0xE1, 0x00, 0x00}},
+	}
+
+	for _, tt := range tests {
+		bridge.dispatcher.Dispatch(tt.message)
+		select {
+		case event := <-bridge.eventQueue:
+			if !bytes.Equal(event.midiData.Buffer, tt.expected) {
+				t.Errorf("%s %v: expected MIDI % X, got % X", tt.message.Address, tt.message.Arguments, tt.expected, event.midiData.Buffer)
+			}
+		default:
+			t.Errorf("%s %v: expected a MIDI event", tt.message.Address, tt.message.Arguments)
+		}
+	}
+
+	// Type tags declared by the rule are enforced, and out-only rules are not handled
+	for _, msg := range []*osc.Message{
+		osc.NewMessage("/mixer/fader/3", int32(1)),
+		osc.NewMessage("/keys/play", int32(60)),
+		osc.NewMessage("/pressure", int32(10)),
+	} {
+		bridge.dispatcher.Dispatch(msg)
+	}
+	if len(bridge.eventQueue) != 0 {
+		t.Errorf("Expected invalid messages to be rejected, got %d events", len(bridge.eventQueue))
+	}
+
+	// Built-in addresses still work alongside mappings
+	bridge.dispatcher.Dispatch(osc.NewMessage("/midi/0/cc", int32(1), int32(2)))
+	if len(bridge.eventQueue) != 1 {
+		t.Error("Expected /midi/0/cc to be handled")
+	}
+}
+
+func TestMappedMIDIToOSC(t *testing.T) {
+	port := &bridgePort{}
+	bridge := newMappedBridge(t, testMappingYAML)
+
+	tests := []struct {
+		name         string
+		midiData     []byte
+		expectedPath string
+		expectedArgs []interface{}
+	}{
+		{"mapped CC", []byte{0xB2, 7, 127}, "/mixer/fader/3", []interface{}{float32(1)}},
+		{"mapped pitch bend", []byte{0xE1, 0x00, 0x00}, "/bend", []interface{}{float32(-1)}},
+		{"out-only pressure", []byte{0xD3, 42}, "/pressure", []interface{}{int32(42)}},
+		{"other controller falls through", []byte{0xB2, 8, 1}, "/midi/2/cc", []interface{}{int32(8), int32(1)}},
+		{"other channel falls through", []byte{0xB3, 7, 1}, "/midi/3/cc", []interface{}{int32(7), int32(1)}},
+		{"in-only note falls through", []byte{0x90, 60, 100}, "/midi/0/note_on", []interface{}{int32(60), int32(100)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := bridge.parseIncomingMIDI(port, &jack.MidiData{Buffer: tt.midiData})
+			if result == nil {
+				t.Fatal("Expected non-nil result")
+			}
+			if result.Address != tt.expectedPath {
+				t.Errorf("Expected path %s, got %s", tt.expectedPath, result.Address)
+			}
+			if len(result.Arguments) != len(tt.expectedArgs) {
+				t.Fatalf("Expected arguments %v, got %v", tt.expectedArgs, result.Arguments)
+			}
+			for i := range tt.expectedArgs {
+				if result.Arguments[i] != tt.expectedArgs[i] {
+					t.Errorf("Expected arguments %v, got %v", tt.expectedArgs, result.Arguments)
+				}
+			}
+		})
+	}
+}
+
+func TestMappingConflictsWithBuiltinAddress(t *testing.T) {
+	mappings, err := newMappingTable([]mappingRule{{OSC: "/midi/0/cc", MIDI: "program"}}, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	bridge := &Bridge{dispatcher: newOSCDispatcher(), mappings: mappings}
+	bridge.setupOSCHandlers()
+	if err := bridge.setupMappingHandlers(); err == nil || !strings.Contains(err.Error(), "/midi/0/cc") {
+		t.Errorf("Expected conflict error naming /midi/0/cc, got %v", err)
+	}
+}
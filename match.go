@@ -0,0 +1,115 @@
+package main
+
+import (
+	"strings"
+)
+
+// oscPatternChars are the characters that make an OSC address a pattern
+const oscPatternChars = "*?[]{}"
+
+func isOSCPattern(address string) bool {
+	return strings.ContainsAny(address, oscPatternChars)
+}
+
+// matchOSCAddress reports whether an OSC 1.0 address pattern matches a
+// literal address. Patterns are matched part by part, so wildcards never
+// cross a '/'. Within a part, '*' matches any run of characters, '?' any
+// single character, "[abc]" any listed character (with ranges like "[0-9]"
+// and negation like "[!0-9]"), and "{a,b}" any of the listed strings.
+func matchOSCAddress(pattern, address string) bool {
+	patternParts := strings.Split(pattern, "/")
+	addressParts := strings.Split(address, "/")
+	if len(patternParts) != len(addressParts) {
+		return false
+	}
+	for i := range patternParts {
+		if !matchOSCPart(patternParts[i], addressParts[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchOSCPart matches a single pattern part against a single address part
+func matchOSCPart(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			// Collapse runs of '*' and try every possible split
+			for len(pattern) > 0 && pattern[0] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if matchOSCPart(pattern, s[i:]) {
+					return true
+				}
+			}
+			return false
+
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+			pattern, s = pattern[1:], s[1:]
+
+		case '[':
+			end := strings.IndexByte(pattern, ']')
+			if end < 0 || len(s) == 0 {
+				return false // Unterminated list never matches
+			}
+			if !matchOSCCharList(pattern[1:end], s[0]) {
+				return false
+			}
+			pattern, s = pattern[end+1:], s[1:]
+
+		case '{':
+			end := strings.IndexByte(pattern, '}')
+			if end < 0 {
+				return false // Unterminated alternatives never match
+			}
+			rest := pattern[end+1:]
+			for _, alt := range strings.Split(pattern[1:end], ",") {
+				if strings.HasPrefix(s, alt) && matchOSCPart(rest, s[len(alt):]) {
+					return true
+				}
+			}
+			return false
+
+		default:
+			if len(s) == 0 || pattern[0] != s[0] {
+				return false
+			}
+			pattern, s = pattern[1:], s[1:]
+		}
+	}
+	return len(s) == 0
+}
+
+// matchOSCCharList matches one character against the contents of a [...]
+// list, e.g. "abc", "0-9" or "!a-z".
+func matchOSCCharList(list string, c byte) bool {
+	negate := false
+	if len(list) > 0 && list[0] == '!' {
+		negate, list = true, list[1:]
+	}
+
+	matched := false
+	for i := 0; i < len(list); i++ {
+		if i+2 < len(list) && list[i+1] == '-' {
+			lo, hi := list[i], list[i+2]
+			if lo > hi {
+				lo, hi = hi, lo
+			}
+			if c >= lo && c <= hi {
+				matched = true
+			}
+			i += 2
+		} else if list[i] == c {
+			matched = true
+		}
+	}
+	return matched != negate
+}
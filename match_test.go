@@ -0,0 +1,47 @@
+package main
+
+import "testing"
+
+func TestMatchOSCAddress(t *testing.T) {
+	tests := []struct {
+		pattern string
+		address string
+		want    bool
+	}{
+		{"/midi/0/note_on", "/midi/0/note_on", true},
+		{"/midi/0/note_on", "/midi/1/note_on", false},
+		{"/midi/*/note_on", "/midi/15/note_on", true},
+		{"/midi/*/note_on", "/midi/15/note_off", false},
+		{"/midi/*", "/midi/0/note_on", false}, // '*' never crosses '/'
+		{"/midi/*/*", "/midi/0/note_on", true},
+		{"/midi/0/note_*", "/midi/0/note_off", true},
+		{"/midi/0/*on", "/midi/0/note_on", true},
+		{"/midi/0/*_*_*", "/midi/0/channel_pressure", false},
+		{"/midi/0/*_*", "/midi/0/poly_pressure", true},
+		{"/midi/?/cc", "/midi/7/cc", true},
+		{"/midi/?/cc", "/midi/12/cc", false},
+		{"/midi/??/cc", "/midi/12/cc", true},
+		{"/midi/[0-3]/cc", "/midi/2/cc", true},
+		{"/midi/[0-3]/cc", "/midi/4/cc", false},
+		{"/midi/[!0-3]/cc", "/midi/4/cc", true},
+		{"/midi/[!0-3]/cc", "/midi/1/cc", false},
+		{"/midi/[159]/cc", "/midi/5/cc", true},
+		{"/midi/1[0-5]/cc", "/midi/15/cc", true},
+		{"/midi/[0-3/cc", "/midi/2/cc", false}, // Unterminated list
+		{"/midi/{0,1,2}/cc", "/midi/1/cc", true},
+		{"/midi/{0,1,2}/cc", "/midi/3/cc", false},
+		{"/midi/{1,10}/cc", "/midi/10/cc", true},
+		{"/midi/0/{note_on,note_off}", "/midi/0/note_off", true},
+		{"/midi/0/note_{on,off}", "/midi/0/note_on", true},
+		{"/midi/0/{cc", "/midi/0/cc", false}, // Unterminated alternatives
+		{"/midi/*/{cc,program}", "/midi/3/program", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.address, func(t *testing.T) {
+			if got := matchOSCAddress(tt.pattern, tt.address); got != tt.want {
+				t.Errorf("matchOSCAddress(%q, %q) = %v, want %v", tt.pattern, tt.address, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/hypebeast/go-osc/osc"
+	"github.com/xthexder/go-jack"
+)
+
+// MPE (MIDI Polyphonic Expression) zones. The lower zone is managed on MIDI
+// channel 1 with member channels counting up from 2; the upper zone is
+// managed on channel 16 with member channels counting down from 15. Each
+// note gets a member channel of its own, so pitch bend, channel pressure and
+// CC74 (timbre) on that channel apply to the one note.
+const (
+	mpeLowerManager = 0
+	mpeUpperManager = 15
+	mpeMaxMembers   = 15
+	mpeConfigRPN    = 6 // MPE Configuration Message: data entry MSB is the member count
+	ccTimbre        = 74
+)
+
+// mpeZone is a configured zone and the notes played in it over OSC.
+type mpeZone struct {
+	name    string  // lower or upper
+	path    string  // OSC address prefix: /mpe, or /mpe/upper if both zones are in use
+	manager uint8   // Manager channel
+	members []uint8 // Member channels in allocation order
+
+	// OSC → MIDI voice allocation; dispatcher only
+	notes map[int32]mpeNote // Sounding notes by id
+	count [16]int           // Sounding notes per channel
+	used  [16]uint64        // Allocation order of each channel; lower was used longer ago
+	tick  uint64
+	bent  [16]bool // Pitch bend on the channel is off center
+}
+
+type mpeNote struct {
+	channel uint8
+	note    uint8
+}
+
+// newMPEZones builds the zones with the given member channel counts; 0
+// disables a zone.
+func newMPEZones(lower, upper int) ([]*mpeZone, error) {
+	if lower < 0 || lower > mpeMaxMembers || upper < 0 || upper > mpeMaxMembers {
+		return nil, fmt.Errorf("invalid MPE zone sizes %d and %d (expected 0-%d member channels)", lower, upper, mpeMaxMembers)
+	}
+	if lower > 0 && upper > 0 && lower+upper > 14 {
+		return nil, fmt.Errorf("MPE zones of %d and %d member channels overlap (at most 14 together)", lower, upper)
+	}
+
+	var zones []*mpeZone
+	if lower > 0 {
+		zone := &mpeZone{name: "lower", path: "/mpe", manager: mpeLowerManager, notes: make(map[int32]mpeNote)}
+		for i := 1; i <= lower; i++ {
+			zone.members = append(zone.members, uint8(mpeLowerManager+i))
+		}
+		zones = append(zones, zone)
+	}
+	if upper > 0 {
+		zone := &mpeZone{name: "upper", path: "/mpe", manager: mpeUpperManager, notes: make(map[int32]mpeNote)}
+		if lower > 0 {
+			zone.path = "/mpe/upper"
+		}
+		for i := 1; i <= upper; i++ {
+			zone.members = append(zone.members, uint8(mpeUpperManager-i))
+		}
+		zones = append(zones, zone)
+	}
+	return zones, nil
+}
+
+// allocate picks the member channel for a new note: the one with the fewest
+// sounding notes, and of those the one used longest ago, so a released
+// note's tail isn't disturbed while channels are free.
+func (z *mpeZone) allocate() uint8 {
+	best := z.members[0]
+	for _, ch := range z.members[1:] {
+		if z.count[ch] < z.count[best] || (z.count[ch] == z.count[best] && z.used[ch] < z.used[best]) {
+			best = ch
+		}
+	}
+	z.tick++
+	z.used[best] = z.tick
+	return best
+}
+
+// sendMPEConfiguration announces each zone with the MPE Configuration
+// Message (RPN 6 on the manager channel), queued for the first period.
+func (b *Bridge) sendMPEConfiguration() error {
+	for _, zone := range b.mpeZones {
+		event := b.createControlSequence(zone.manager,
+			ccRPNMSB, 0,
+			ccRPNLSB, mpeConfigRPN,
+			ccDataEntryMSB, uint8(len(zone.members)),
+			ccRPNMSB, ccRPNNull,
+			ccRPNLSB, ccRPNNull,
+		)
+		if err := b.queueMidiEvent(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setupMPEHandlers registers /mpe/{note_on,note_off,bend,pressure,timbre}
+// for each zone. MPE plays on the first output port, as voice allocation
+// spans the whole instrument. It fails if an address is already handled.
+func (b *Bridge) setupMPEHandlers() error {
+	for _, zone := range b.mpeZones {
+		handlers := map[string]func(*mpeZone, *osc.Message) error{
+			"note_on":  b.handleMPENoteOn,
+			"note_off": b.handleMPENoteOff,
+			"bend":     b.handleMPEBend,
+			"pressure": b.handleMPEPressure,
+			"timbre":   b.handleMPETimbre,
+		}
+		for name, handle := range handlers {
+			if err := b.dispatcher.AddMsgHandler(zone.path+"/"+name, func(msg *osc.Message) {
+				if err := handle(zone, msg); err != nil {
+					debugHandlers("Error handling %s: %v", msg.Address, err)
+				}
+			}); err != nil {
+				return fmt.Errorf("MPE %s zone: %w", zone.name, err)
+			}
+		}
+		debugHandlers("MPE %s zone on %s: manager channel %d, %d member channels", zone.name, zone.path, b.oscChannel(zone.manager), len(zone.members))
+	}
+	return nil
+}
+
+// mpeNoteID reads the note id, the first argument of every /mpe message.
+func mpeNoteID(msg *osc.Message) (int32, error) {
+	if len(msg.Arguments) == 0 {
+		return 0, fmt.Errorf("%s requires a note id", msg.Address)
+	}
+	id, ok := toInt(msg.Arguments[0])
+	if !ok {
+		return 0, fmt.Errorf("%s note id must be a number, got %v", msg.Address, msg.Arguments[0])
+	}
+	return int32(id), nil
+}
+
+// soundingNote looks up the note an /mpe message refers to.
+func (z *mpeZone) soundingNote(msg *osc.Message) (mpeNote, error) {
+	id, err := mpeNoteID(msg)
+	if err != nil {
+		return mpeNote{}, err
+	}
+	note, ok := z.notes[id]
+	if !ok {
+		return mpeNote{}, fmt.Errorf("%s: no sounding note with id %d", msg.Address, id)
+	}
+	return note, nil
+}
+
+// handleMPENoteOn starts a note on a member channel of its own: args id,
+// note, velocity. Reusing the id of a sounding note releases that first.
+func (b *Bridge) handleMPENoteOn(zone *mpeZone, msg *osc.Message) error {
+	if len(msg.Arguments) < 3 {
+		return errors.New("mpe note_on requires 3 arguments: id, note and velocity")
+	}
+	id, err := mpeNoteID(msg)
+	if err != nil {
+		return err
+	}
+	note := toUint8(msg.Arguments[1])
+	velocity := toUint8(msg.Arguments[2])
+
+	if old, ok := zone.notes[id]; ok {
+		if err := b.queueMidiEvent(b.createMidiEvent(0x80, old.channel, old.note, 0)); err != nil {
+			return err
+		}
+		zone.release(id, old)
+	}
+
+	channel := zone.allocate()
+	var data []byte
+	if zone.bent[channel] {
+		// A previous note left the channel bent; recenter before the new note
+		data = append(data, 0xE0|channel, 0x00, 0x40)
+	}
+	data = append(data, 0x90|channel, note&0x7F, velocity&0x7F)
+	if err := b.queueMidiEvent(&MidiEvent{midiData: &jack.MidiData{Buffer: data}}); err != nil {
+		return err
+	}
+	zone.bent[channel] = false
+	zone.notes[id] = mpeNote{channel, note}
+	zone.count[channel]++
+	fmt.Printf("MPE-NOTE-ON id:%d ch:%d note:%d vel:%d\n", id, b.oscChannel(channel), note, velocity)
+
+	return nil
+}
+
+// handleMPENoteOff releases a note: args id and an optional velocity.
+func (b *Bridge) handleMPENoteOff(zone *mpeZone, msg *osc.Message) error {
+	id, err := mpeNoteID(msg)
+	if err != nil {
+		return err
+	}
+	note, err := zone.soundingNote(msg)
+	if err != nil {
+		return err
+	}
+	velocity := uint8(0)
+	if len(msg.Arguments) > 1 {
+		velocity = toUint8(msg.Arguments[1])
+	}
+
+	if err := b.queueMidiEvent(b.createMidiEvent(0x80, note.channel, note.note, velocity)); err != nil {
+		return err
+	}
+	zone.release(id, note)
+	fmt.Printf("MPE-NOTE-OFF id:%d ch:%d note:%d vel:%d\n", id, b.oscChannel(note.channel), note.note, velocity)
+
+	return nil
+}
+
+func (z *mpeZone) release(id int32, note mpeNote) {
+	delete(z.notes, id)
+	z.count[note.channel]--
+	z.tick++
+	z.used[note.channel] = z.tick
+}
+
+// handleMPEBend bends one note: args id and a value in the
+// --pitch-bend-format.
+func (b *Bridge) handleMPEBend(zone *mpeZone, msg *osc.Message) error {
+	if len(msg.Arguments) < 2 {
+		return errors.New("mpe bend requires 2 arguments: id and value")
+	}
+	note, err := zone.soundingNote(msg)
+	if err != nil {
+		return err
+	}
+	value, err := pitchBendValue(msg.Arguments[1], b.pitchBendFormat)
+	if err != nil {
+		return err
+	}
+
+	if err := b.queueMidiEvent(b.createMidiEvent(0xE0, note.channel, uint8(value&0x7F), uint8(value>>7))); err != nil {
+		return err
+	}
+	zone.bent[note.channel] = value != 0x2000
+	debugHandlers("MPE bend ch:%d val:%d", b.oscChannel(note.channel), value)
+
+	return nil
+}
+
+// handleMPEPressure sets one note's pressure as channel pressure on its
+// member channel: args id and value.
+func (b *Bridge) handleMPEPressure(zone *mpeZone, msg *osc.Message) error {
+	if len(msg.Arguments) < 2 {
+		return errors.New("mpe pressure requires 2 arguments: id and value")
+	}
+	note, err := zone.soundingNote(msg)
+	if err != nil {
+		return err
+	}
+	pressure := toUint8(msg.Arguments[1])
+
+	if err := b.queueMidiEvent(b.createMidiEvent(0xD0, note.channel, pressure)); err != nil {
+		return err
+	}
+	debugHandlers("MPE pressure ch:%d val:%d", b.oscChannel(note.channel), pressure)
+
+	return nil
+}
+
+// handleMPETimbre sets one note's timbre as CC74 on its member channel:
+// args id and value.
+func (b *Bridge) handleMPETimbre(zone *mpeZone, msg *osc.Message) error {
+	if len(msg.Arguments) < 2 {
+		return errors.New("mpe timbre requires 2 arguments: id and value")
+	}
+	note, err := zone.soundingNote(msg)
+	if err != nil {
+		return err
+	}
+	value := toUint8(msg.Arguments[1])
+
+	if err := b.queueMidiEvent(b.createMidiEvent(0xB0, note.channel, ccTimbre, value)); err != nil {
+		return err
+	}
+	debugHandlers("MPE timbre ch:%d val:%d", b.oscChannel(note.channel), value)
+
+	return nil
+}
+
+// mpeDecoder turns MPE received on one input port back into per-note
+// messages. Notes are numbered in arrival order. RT thread only.
+type mpeDecoder struct {
+	ids    [16][128]int32 // Id of the sounding note by channel and key; 0 for none
+	nextID int32
+}
+
+// parseMPE converts a channel message on a member channel to /mpe
+// messages, or returns nil to send it as a plain /midi message: a bend,
+// pressure or CC74 with no note sounding on the channel, for example.
+func (b *Bridge) parseMPE(port *bridgePort, zone *mpeZone, data []byte) []*osc.Message {
+	status, channel := data[0]&0xF0, data[0]&0x0F
+	if len(data) < channelMessageLength(status) {
+		return nil
+	}
+	d := &port.mpe
+	ids := &d.ids[channel]
+
+	switch status {
+	case 0x90, 0x80:
+		note, velocity := data[1]&0x7F, data[2]&0x7F
+		var msgs []*osc.Message
+		if id := ids[note]; id != 0 {
+			msgs = append(msgs, osc.NewMessage(zone.path+"/note_off", id, int32(velocity)))
+			ids[note] = 0
+		}
+		if status == 0x90 && velocity > 0 {
+			d.nextID++
+			if d.nextID <= 0 {
+				d.nextID = 1
+			}
+			ids[note] = d.nextID
+			msgs = append(msgs, osc.NewMessage(zone.path+"/note_on", d.nextID, int32(note), int32(velocity)))
+		}
+		return msgs
+
+	case 0xE0:
+		value := uint16(data[2]&0x7F)<<7 | uint16(data[1]&0x7F)
+		return mpePerNote(ids, zone.path+"/bend", pitchBendArgument(value, b.pitchBendFormat))
+	case 0xD0:
+		return mpePerNote(ids, zone.path+"/pressure", int32(data[1]&0x7F))
+	case 0xB0:
+		if data[1]&0x7F == ccTimbre {
+			return mpePerNote(ids, zone.path+"/timbre", int32(data[2]&0x7F))
+		}
+	}
+	return nil
+}
+
+// mpePerNote sends a channel-wide value to every note sounding on the
+// channel, usually just one.
+func mpePerNote(ids *[128]int32, address string, value interface{}) []*osc.Message {
+	var msgs []*osc.Message
+	for _, id := range ids {
+		if id != 0 {
+			msgs = append(msgs, osc.NewMessage(address, id, value))
+		}
+	}
+	return msgs
+}
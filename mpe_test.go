@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hypebeast/go-osc/osc"
+)
+
+func TestNewMPEZones(t *testing.T) {
+	tests := []struct {
+		lower, upper int
+		wantPaths    []string
+		wantMembers  [][]uint8
+		wantErr      bool
+	}{
+		{0, 0, nil, nil, false},
+		{3, 0, []string{"/mpe"}, [][]uint8{{1, 2, 3}}, false},
+		{0, 2, []string{"/mpe"}, [][]uint8{{14, 13}}, false},
+		{7, 7, []string{"/mpe", "/mpe/upper"}, [][]uint8{{1, 2, 3, 4, 5, 6, 7}, {14, 13, 12, 11, 10, 9, 8}}, false},
+		{15, 0, []string{"/mpe"}, nil, false},
+		{8, 7, nil, nil, true},
+		{16, 0, nil, nil, true},
+		{-1, 0, nil, nil, true},
+	}
+
+	for _, tt := range tests {
+		zones, err := newMPEZones(tt.lower, tt.upper)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("newMPEZones(%d, %d) error = %v, wantErr %v", tt.lower, tt.upper, err, tt.wantErr)
+			continue
+		}
+		for i, zone := range zones {
+			if zone.path != tt.wantPaths[i] {
+				t.Errorf("newMPEZones(%d, %d): zone %d path %s, expected %s", tt.lower, tt.upper, i, zone.path, tt.wantPaths[i])
+			}
+			if tt.wantMembers != nil && !reflect.DeepEqual(zone.members, tt.wantMembers[i]) {
+				t.Errorf("newMPEZones(%d, %d): zone %d members %v, expected %v", tt.lower, tt.upper, i, zone.members, tt.wantMembers[i])
+			}
+		}
+	}
+}
+
+func TestBridgeMPEOutput(t *testing.T) {
+	bridge, backend, _ := newTestBridge(t, Config{PitchBendFormat: pitchBendSigned, MPELowerZone: 2})
+	out := backend.port("midi_out")
+	expect := func(want ...[]byte) {
+		t.Helper()
+		backend.cycle(64)
+		if len(out.written) != len(want) {
+			t.Fatalf("Expected %d MIDI events, got %v", len(want), out.written)
+		}
+		for i, event := range out.written {
+			if !bytes.Equal(event.Buffer, want[i]) {
+				t.Errorf("Event %d: expected % X, got % X", i, want[i], event.Buffer)
+			}
+		}
+	}
+
+	// The MPE Configuration Message goes out first
+	expect([]byte{0xB0, 101, 0}, []byte{0xB0, 100, 6}, []byte{0xB0, 6, 2}, []byte{0xB0, 101, 127}, []byte{0xB0, 100, 127})
+
+	// Each note gets its own member channel, and expression follows the note
+	bridge.dispatcher.Dispatch(osc.NewMessage("/mpe/note_on", int32(10), int32(60), int32(100)))
+	bridge.dispatcher.Dispatch(osc.NewMessage("/mpe/note_on", int32(11), int32(64), int32(90)))
+	bridge.dispatcher.Dispatch(osc.NewMessage("/mpe/bend", int32(11), int32(4096)))
+	bridge.dispatcher.Dispatch(osc.NewMessage("/mpe/pressure", int32(10), int32(50)))
+	bridge.dispatcher.Dispatch(osc.NewMessage("/mpe/timbre", int32(11), int32(20)))
+	expect([]byte{0x91, 60, 100}, []byte{0x92, 64, 90}, []byte{0xE2, 0x00, 0x60}, []byte{0xD1, 50}, []byte{0xB2, 74, 20})
+
+	// A released channel is reused last while another is free; a bent
+	// channel is recentered before its next note
+	bridge.dispatcher.Dispatch(osc.NewMessage("/mpe/note_off", int32(11)))
+	bridge.dispatcher.Dispatch(osc.NewMessage("/mpe/note_on", int32(12), int32(67), int32(80)))
+	expect([]byte{0x82, 64, 0}, []byte{0xE2, 0x00, 0x40}, []byte{0x92, 67, 80})
+
+	// Unknown ids are rejected
+	if err := bridge.handleMPEBend(bridge.mpeZones[0], osc.NewMessage("/mpe/bend", int32(11), int32(0))); err == nil {
+		t.Error("Expected an error for a released note id")
+	}
+}
+
+func TestBridgeMPEInput(t *testing.T) {
+	_, backend, conn := newTestBridge(t, Config{PitchBendFormat: pitchBendSigned, MPELowerZone: 3})
+	in := backend.port("midi_in")
+
+	in.send(0, 0xE1, 0x00, 0x40) // Bend before the note: no note to key it to
+	in.send(1, 0x91, 60, 100)
+	in.send(2, 0xE1, 0x00, 0x50)
+	in.send(3, 0xB1, 74, 64)
+	in.send(4, 0x92, 64, 90)
+	in.send(5, 0xD2, 30)
+	in.send(6, 0x81, 60, 0)
+	in.send(7, 0x90, 48, 100) // Manager channel
+	backend.cycle(64)
+
+	want := []struct {
+		address string
+		args    []interface{}
+	}{
+		{"/midi/1/pitch_bend", []interface{}{int32(0)}},
+		{"/mpe/note_on", []interface{}{int32(1), int32(60), int32(100)}},
+		{"/mpe/bend", []interface{}{int32(1), int32(2048)}},
+		{"/mpe/timbre", []interface{}{int32(1), int32(64)}},
+		{"/mpe/note_on", []interface{}{int32(2), int32(64), int32(90)}},
+		{"/mpe/pressure", []interface{}{int32(2), int32(30)}},
+		{"/mpe/note_off", []interface{}{int32(1), int32(0)}},
+		{"/midi/0/note_on", []interface{}{int32(48), int32(100)}},
+	}
+	for _, w := range want {
+		msg := receiveOSC(t, conn)
+		if msg.Address != w.address || !reflect.DeepEqual(msg.Arguments, w.args) {
+			t.Errorf("Expected %s %v, got %s %v", w.address, w.args, msg.Address, msg.Arguments)
+		}
+	}
+}
+
+func TestSetupMPEHandlersError(t *testing.T) {
+	zones, err := newMPEZones(3, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	bridge := &Bridge{dispatcher: newOSCDispatcher(), mpeZones: zones}
+	bridge.dispatcher.AddMsgHandler("/mpe/bend", func(*osc.Message) {})
+	if err := bridge.setupMPEHandlers(); err == nil || !strings.Contains(err.Error(), "/mpe/bend") {
+		t.Errorf("Expected error for /mpe/bend, got %v", err)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/hypebeast/go-osc/osc"
+	"golang.org/x/net/ipv4"
+)
+
+// Broadcast needs nothing special: Go enables SO_BROADCAST on UDP sockets,
+// so osc.Client can send to 255.255.255.255 or a subnet's broadcast address.
+
+// parseMulticastGroup parses an IPv4 multicast group address.
+func parseMulticastGroup(group string) (net.IP, error) {
+	ip := net.ParseIP(group).To4()
+	if ip == nil || !ip.IsMulticast() {
+		return nil, fmt.Errorf("invalid multicast group %q (expected an IPv4 address in 224.0.0.0/4)", group)
+	}
+	return ip, nil
+}
+
+// multicastInterface looks up the interface for multicast; empty lets the
+// system choose.
+func multicastInterface(name string) (*net.Interface, error) {
+	if name == "" {
+		return nil, nil
+	}
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid multicast interface %q: %w", name, err)
+	}
+	return iface, nil
+}
+
+// listenOSCMulticast opens the OSC server socket joined to the multicast
+// group. It still receives unicast packets sent to the port.
+func (b *Bridge) listenOSCMulticast() (*net.UDPConn, error) {
+	_, port, err := net.SplitHostPort(b.oscServer.Addr)
+	if err != nil {
+		return nil, err
+	}
+	addr, err := net.ResolveUDPAddr("udp4", net.JoinHostPort(b.multicastGroup.String(), port))
+	if err != nil {
+		return nil, err
+	}
+	return net.ListenMulticastUDP("udp4", b.multicastIface, addr)
+}
+
+// multicastSender sends OSC packets to an IPv4 multicast group with the
+// configured TTL and interface. Looped-back copies are kept, so listeners
+// on the same host receive them too.
+type multicastSender struct {
+	group *net.UDPAddr
+	ttl   int
+	iface *net.Interface
+	conn  *net.UDPConn
+}
+
+func (s *multicastSender) Send(packet osc.Packet) error {
+	data, err := packet.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	if s.conn == nil {
+		if err := s.open(); err != nil {
+			return err
+		}
+	}
+	_, err = s.conn.WriteTo(data, s.group)
+	return err
+}
+
+func (s *multicastSender) open() error {
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return err
+	}
+	p := ipv4.NewPacketConn(conn)
+	if err := p.SetMulticastTTL(s.ttl); err != nil {
+		conn.Close()
+		return fmt.Errorf("cannot set multicast TTL: %w", err)
+	}
+	if s.iface != nil {
+		if err := p.SetMulticastInterface(s.iface); err != nil {
+			conn.Close()
+			return fmt.Errorf("cannot send multicast on %s: %w", s.iface.Name, err)
+		}
+	}
+	if err := p.SetMulticastLoopback(true); err != nil {
+		conn.Close()
+		return fmt.Errorf("cannot enable multicast loopback: %w", err)
+	}
+	s.conn = conn
+	return nil
+}
+
+func (s *multicastSender) Close() error {
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
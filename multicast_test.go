@@ -0,0 +1,120 @@
+package main
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/hypebeast/go-osc/osc"
+)
+
+// testGroup is an organization-local group used on the loopback interface.
+var testGroup = net.IPv4(239, 255, 77, 1)
+
+// loopbackInterface returns the loopback interface, skipping the test if
+// it can't be used for multicast.
+func loopbackInterface(t *testing.T) *net.Interface {
+	t.Helper()
+
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		t.Skipf("Cannot list interfaces: %v", err)
+	}
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagLoopback != 0 && iface.Flags&net.FlagUp != 0 {
+			conn, err := net.ListenMulticastUDP("udp4", &iface, &net.UDPAddr{IP: testGroup})
+			if err != nil {
+				t.Skipf("No multicast on %s: %v", iface.Name, err)
+			}
+			conn.Close()
+			return &iface
+		}
+	}
+	t.Skip("No loopback interface")
+	return nil
+}
+
+func TestParseMulticastGroup(t *testing.T) {
+	tests := []struct {
+		group   string
+		wantErr bool
+	}{
+		{"239.0.0.1", false},
+		{"224.0.0.251", false},
+		{"192.168.1.255", true},
+		{"ff02::1", true},
+		{"osc.local", true},
+	}
+	for _, tt := range tests {
+		if _, err := parseMulticastGroup(tt.group); (err != nil) != tt.wantErr {
+			t.Errorf("parseMulticastGroup(%q) error = %v, wantErr %v", tt.group, err, tt.wantErr)
+		}
+	}
+}
+
+func TestBridgeMulticastOutput(t *testing.T) {
+	lo := loopbackInterface(t)
+	listener, err := net.ListenMulticastUDP("udp4", lo, &net.UDPAddr{IP: testGroup})
+	if err != nil {
+		t.Fatalf("Cannot join group: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	_, backend, _ := newTestBridge(t, Config{
+		PitchBendFormat: pitchBendSigned,
+		OSCTargets:      []OSCTarget{{Host: testGroup.String(), Port: listener.LocalAddr().(*net.UDPAddr).Port}},
+		MulticastTTL:    0,
+		MulticastIface:  lo.Name,
+	})
+	backend.port("midi_in").send(0, 0x90, 60, 100)
+	backend.cycle(64)
+
+	if msg := receiveOSC(t, listener); msg.Address != "/midi/0/note_on" {
+		t.Errorf("Expected /midi/0/note_on, got %s", msg.Address)
+	}
+}
+
+func TestBridgeMulticastInput(t *testing.T) {
+	lo := loopbackInterface(t)
+	bridge, backend, _ := newTestBridge(t, Config{
+		PitchBendFormat: pitchBendSigned,
+		MulticastGroup:  testGroup.String(),
+		MulticastIface:  lo.Name,
+	})
+	conn, err := bridge.listenOSCMulticast()
+	if err != nil {
+		t.Fatalf("Cannot join group: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go bridge.serveOSCPackets(conn)
+
+	sender := &multicastSender{group: &net.UDPAddr{IP: testGroup, Port: conn.LocalAddr().(*net.UDPAddr).Port}, iface: lo}
+	defer sender.Close()
+	if err := sender.Send(osc.NewMessage("/midi/0/note_on", int32(60), int32(100))); err != nil {
+		t.Fatalf("Cannot send to group: %v", err)
+	}
+
+	out := backend.port("midi_out")
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		backend.cycle(64)
+		if len(out.written) > 0 {
+			return
+		}
+	}
+	t.Error("Expected a note from the multicast group")
+}
+
+func TestNewBridgeMulticast(t *testing.T) {
+	for _, cfg := range []Config{
+		{MulticastGroup: "10.0.0.1"},
+		{MulticastTTL: 256},
+		{MulticastIface: "no-such-interface0"},
+		{MulticastGroup: "239.0.0.1", OSCTransport: oscTransportTCPLen},
+		{OSCTargets: []OSCTarget{{Host: "239.0.0.1", Port: 8000}}, OSCTransport: oscTransportTCPSLIP},
+	} {
+		cfg.PitchBendFormat = pitchBendSigned
+		if _, err := newBridge(cfg, newFakeBackend(48000).opener()); err == nil {
+			t.Errorf("Expected error for %+v", cfg)
+		}
+	}
+}
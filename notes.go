@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/hypebeast/go-osc/osc"
+)
+
+// releaseTimeout bounds how long Cleanup waits for the process callback to
+// send the note-offs of notes still sounding.
+const releaseTimeout = 500 * time.Millisecond
+
+// ccAllNotesOff is sent after releasing notes with --all-notes-off.
+const ccAllNotesOff = 123
+
+// noteTracker records the notes sounding on an output port, so they can be
+// released if their note-offs never come. Only the process callback
+// changes it; entries are atomic so /bridge/notes can read them.
+type noteTracker struct {
+	started [16][128]atomic.Int64 // When each note started, in Unix nanoseconds; 0 if not sounding
+	active  atomic.Int32          // Number of sounding notes
+
+	release atomic.Bool // Set when the port is disconnected; see notifyPortDisconnected
+}
+
+// track updates the table from a message written to the port.
+func (t *noteTracker) track(data []byte, now int64) {
+	if len(data) < 3 {
+		return
+	}
+	status, channel := data[0]&0xF0, data[0]&0x0F
+	switch {
+	case status == 0x90 && data[2] != 0:
+		if t.started[channel][data[1]&0x7F].Swap(now) == 0 {
+			t.active.Add(1)
+		}
+	case status == 0x80 || status == 0x90:
+		if t.started[channel][data[1]&0x7F].Swap(0) != 0 {
+			t.active.Add(-1)
+		}
+	case status == 0xB0 && (data[1] == ccAllNotesOff || data[1] == 120): // All Notes Off, All Sound Off
+		for note := range t.started[channel] {
+			if t.started[channel][note].Swap(0) != 0 {
+				t.active.Add(-1)
+			}
+		}
+	}
+}
+
+// releaseNotes writes note-offs at the start of the period for the port's
+// notes that started before the cutoff, in Unix nanoseconds, followed by
+// CC 123 on their channels with --all-notes-off. RT thread only.
+func (b *Bridge) releaseNotes(port *bridgePort, cutoff int64) {
+	t := &port.notes
+	if t.active.Load() == 0 {
+		return
+	}
+	b.noteOff.Time = 0
+	for ch := range t.started {
+		released := false
+		for note := range t.started[ch] {
+			if started := t.started[ch][note].Load(); started != 0 && started < cutoff {
+				b.noteOff.Buffer = append(b.noteOff.Buffer[:0], 0x80|uint8(ch), uint8(note), 0)
+				b.writeEvent(port, b.noteOff)
+				released = true
+			}
+		}
+		if released && b.allNotesOff {
+			b.noteOff.Buffer = append(b.noteOff.Buffer[:0], 0xB0|uint8(ch), ccAllNotesOff, 0)
+			b.writeEvent(port, b.noteOff)
+		}
+	}
+	debugBridge("Port %s: released hanging notes", port.name)
+}
+
+// releaseHangingNotes runs at the start of each period: it completes a
+// shutdown release, handles release requests and disconnected ports, and
+// ends notes held longer than --max-note-duration. RT thread only.
+func (b *Bridge) releaseHangingNotes(now time.Time) {
+	// The note-offs of the last period have been delivered
+	if b.releaseAck != nil {
+		close(b.releaseAck)
+		b.releaseAck = nil
+	}
+
+	all := false
+	select {
+	case b.releaseAck = <-b.releaseRequests:
+		all = true
+	default:
+	}
+
+	for _, port := range b.outPorts {
+		switch {
+		case all || port.notes.release.Swap(false):
+			b.releaseNotes(port, now.UnixNano()+1)
+		case b.maxNoteDuration > 0:
+			b.releaseNotes(port, now.Add(-b.maxNoteDuration).UnixNano())
+		}
+	}
+}
+
+// releaseAllNotes has the process callback send note-offs for every note
+// still sounding, and waits until they are delivered.
+func (b *Bridge) releaseAllNotes() {
+	sounding := false
+	for _, port := range b.outPorts {
+		sounding = sounding || port.notes.active.Load() > 0
+	}
+	if !b.activated || !sounding {
+		return
+	}
+
+	ack := make(chan struct{})
+	select {
+	case b.releaseRequests <- ack:
+	default:
+		return // Already releasing
+	}
+	select {
+	case <-ack:
+		debugBridge("Released sounding notes")
+	case <-time.After(releaseTimeout):
+		debugBridge("Timed out releasing sounding notes")
+	}
+}
+
+// notifyPortDisconnected marks an output port's notes for release when a
+// connection from it is removed. It runs on a backend thread.
+func (b *Bridge) notifyPortDisconnected(name string) {
+	for _, port := range b.outPorts {
+		if port.port.Name() == name {
+			port.notes.release.Store(true)
+		}
+	}
+}
+
+// handleNotes sends the sounding notes of each output port as
+// /bridge/notes [channel, note, seconds, ...], prefixed for named ports.
+// The table goes out whole or not at all: the replies are only queued if
+// there is room for every port's. Handlers never run alongside the queue
+// being closed, and the sender never blocks on a target, so the sends
+// complete even if the process callback takes some of that room first.
+func (b *Bridge) handleNotes(msg *osc.Message) error {
+	now := time.Now().UnixNano()
+	total := 0
+	replies := make([]*osc.Message, 0, len(b.outPorts))
+	for _, port := range b.outPorts {
+		reply := osc.NewMessage(port.prefix + "/bridge/notes")
+		for ch := range port.notes.started {
+			for note := range port.notes.started[ch] {
+				if started := port.notes.started[ch][note].Load(); started != 0 {
+					held := float32(time.Duration(now - started).Seconds())
+					reply.Append(int32(b.oscChannel(uint8(ch))), int32(note), held)
+					total++
+				}
+			}
+		}
+		replies = append(replies, reply)
+	}
+
+	if free := cap(b.oscOutQueue) - len(b.oscOutQueue); free < len(replies) {
+		return fmt.Errorf("OSC output queue full, dropping /bridge/notes for %d ports", len(replies))
+	}
+	for _, reply := range replies {
+		b.oscOutQueue <- reply
+	}
+	fmt.Printf("NOTES sounding:%d\n", total)
+	return nil
+}
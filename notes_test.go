@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/hypebeast/go-osc/osc"
+)
+
+func TestNoteTracker(t *testing.T) {
+	tests := []struct {
+		name  string
+		input [][]byte
+		want  int32
+	}{
+		{"note on", [][]byte{{0x90, 60, 100}}, 1},
+		{"note on twice", [][]byte{{0x90, 60, 100}, {0x90, 60, 90}}, 1},
+		{"note off", [][]byte{{0x90, 60, 100}, {0x80, 60, 0}}, 0},
+		{"note on velocity 0", [][]byte{{0x91, 60, 100}, {0x91, 60, 0}}, 0},
+		{"other channel", [][]byte{{0x90, 60, 100}, {0x81, 60, 0}}, 1},
+		{"all notes off", [][]byte{{0x92, 60, 100}, {0x92, 64, 100}, {0x90, 67, 100}, {0xB2, 123, 0}}, 1},
+		{"all sound off", [][]byte{{0x92, 60, 100}, {0xB2, 120, 0}}, 0},
+		{"unrelated", [][]byte{{0xB0, 7, 100}, {0xC0, 5}, {0xF8}}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var tracker noteTracker
+			for _, data := range tt.input {
+				tracker.track(data, 1)
+			}
+			if got := tracker.active.Load(); got != tt.want {
+				t.Errorf("Expected %d sounding notes, got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+// expectWritten checks the events an output port wrote in the last period.
+func expectWritten(t *testing.T, port *fakePort, want ...[]byte) {
+	t.Helper()
+	if len(port.written) != len(want) {
+		t.Fatalf("Expected %d MIDI events, got %v", len(want), port.written)
+	}
+	for i, event := range port.written {
+		if !bytes.Equal(event.Buffer, want[i]) {
+			t.Errorf("Event %d: expected % X, got % X", i, want[i], event.Buffer)
+		}
+	}
+}
+
+func TestBridgeMaxNoteDuration(t *testing.T) {
+	bridge, backend, _ := newTestBridge(t, Config{PitchBendFormat: pitchBendSigned, MaxNoteDuration: 20 * time.Millisecond, AllNotesOff: true})
+	out := backend.port("midi_out")
+
+	// Periods start at times set by the test, not the wall clock
+	clock := time.Unix(1000, 0)
+	bridge.now = func() time.Time { return clock }
+	period := func(elapsed time.Duration) {
+		clock = clock.Add(elapsed)
+		backend.cycle(64)
+	}
+
+	bridge.dispatcher.Dispatch(osc.NewMessage("/midi/0/note_on", int32(60), int32(100)))
+	period(0)
+	bridge.dispatcher.Dispatch(osc.NewMessage("/midi/0/cc", int32(7), int32(90)))
+	period(20 * time.Millisecond)
+	expectWritten(t, out, []byte{0xB0, 7, 90}) // Not yet
+
+	period(time.Millisecond)
+	expectWritten(t, out, []byte{0x80, 60, 0}, []byte{0xB0, 123, 0})
+
+	period(time.Second)
+	expectWritten(t, out)
+}
+
+func TestBridgeDisconnectReleasesNotes(t *testing.T) {
+	bridge, backend, _ := newTestBridge(t, Config{
+		PitchBendFormat: pitchBendSigned,
+		Ports:           []PortConfig{{Name: "a", Direction: portOutput}, {Name: "b", Direction: portOutput}},
+	})
+
+	bridge.dispatcher.Dispatch(osc.NewMessage("/port/a/midi/0/note_on", int32(60), int32(100)))
+	bridge.dispatcher.Dispatch(osc.NewMessage("/port/b/midi/1/note_on", int32(64), int32(100)))
+	backend.cycle(64)
+
+	// Only the disconnected port releases its notes
+	backend.disconnected("test:a", "synth:in")
+	backend.cycle(64)
+	expectWritten(t, backend.port("a"), []byte{0x80, 60, 0})
+	expectWritten(t, backend.port("b"))
+}
+
+func TestBridgeReleaseOnCleanup(t *testing.T) {
+	bridge, backend, _ := newTestBridge(t, Config{PitchBendFormat: pitchBendSigned})
+	out := backend.port("midi_out")
+	if err := bridge.activate(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	bridge.dispatcher.Dispatch(osc.NewMessage("/midi/0/note_on", int32(60), int32(100)))
+	bridge.dispatcher.Dispatch(osc.NewMessage("/midi/2/note_on", int32(36), int32(100)))
+	bridge.dispatcher.Dispatch(osc.NewMessage("/midi/2/note_off", int32(36), int32(0)))
+	backend.cycle(64)
+
+	released := make(chan struct{})
+	go func() {
+		bridge.releaseAllNotes()
+		close(released)
+	}()
+
+	// Run periods until the release is acknowledged
+	var written [][]byte
+	for deadline := time.Now().Add(2 * time.Second); ; {
+		backend.cycle(64)
+		for _, event := range out.written {
+			written = append(written, event.Buffer)
+		}
+		select {
+		case <-released:
+		default:
+			if time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond)
+				continue
+			}
+			t.Fatal("Release was not acknowledged")
+		}
+		break
+	}
+
+	if len(written) != 1 || !bytes.Equal(written[0], []byte{0x80, 60, 0}) {
+		t.Errorf("Expected one note-off for the sounding note, got % X", written)
+	}
+}
+
+func TestBridgeNotesTable(t *testing.T) {
+	bridge, backend, conn := newTestBridge(t, Config{PitchBendFormat: pitchBendSigned, ChannelBase: 1})
+
+	bridge.dispatcher.Dispatch(osc.NewMessage("/midi/1/note_on", int32(60), int32(100)))
+	bridge.dispatcher.Dispatch(osc.NewMessage("/midi/10/note_on", int32(36), int32(100)))
+	backend.cycle(64)
+
+	bridge.dispatcher.Dispatch(osc.NewMessage("/bridge/notes"))
+	msg := receiveOSC(t, conn)
+	if msg.Address != "/bridge/notes" || len(msg.Arguments) != 6 {
+		t.Fatalf("Expected /bridge/notes with 2 notes, got %s %v", msg.Address, msg.Arguments)
+	}
+	if msg.Arguments[0] != int32(1) || msg.Arguments[1] != int32(60) || msg.Arguments[3] != int32(10) || msg.Arguments[4] != int32(36) {
+		t.Errorf("Unexpected note table %v", msg.Arguments)
+	}
+	if held, ok := msg.Arguments[2].(float32); !ok || held < 0 || held > 5 {
+		t.Errorf("Expected the time held in seconds, got %v", msg.Arguments[2])
+	}
+}
+
+func TestHandleNotesQueueFull(t *testing.T) {
+	bridge := &Bridge{
+		outPorts:    []*bridgePort{{name: "midi_out"}, {name: "drums", prefix: "/port/drums"}},
+		oscOutQueue: make(chan *osc.Message, 2),
+	}
+	bridge.oscOutQueue <- osc.NewMessage("/midi/1/note_on")
+
+	// One slot is left for two ports' tables: neither is sent
+	if err := bridge.handleNotes(osc.NewMessage("/bridge/notes")); err == nil {
+		t.Error("Expected error with the OSC output queue full")
+	}
+	if n := len(bridge.oscOutQueue); n != 1 {
+		t.Errorf("Expected no table queued, got %d messages", n)
+	}
+
+	<-bridge.oscOutQueue
+	if err := bridge.handleNotes(osc.NewMessage("/bridge/notes")); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if first, second := <-bridge.oscOutQueue, <-bridge.oscOutQueue; first.Address != "/bridge/notes" || second.Address != "/port/drums/bridge/notes" {
+		t.Errorf("Expected both tables, got %s and %s", first.Address, second.Address)
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// PortConfig declares a named MIDI port. Named ports are addressed with an
+// OSC prefix: /port/<name>/midi/... writes to output port <name>, and MIDI
+// from input port <name> is sent as /port/<name>/midi/....
+type PortConfig struct {
+	Name      string
+	Direction portDirection
+}
+
+// parsePortSpec parses a --port value of the form name:in or name:out.
+func parsePortSpec(spec string) (PortConfig, error) {
+	i := strings.LastIndexByte(spec, ':')
+	if i < 0 {
+		return PortConfig{}, fmt.Errorf("invalid port %q (expected name:in or name:out)", spec)
+	}
+	dir, err := parsePortDirection(spec[i+1:])
+	if err != nil {
+		return PortConfig{}, fmt.Errorf("invalid port %q: %w", spec, err)
+	}
+	port := PortConfig{Name: spec[:i], Direction: dir}
+	if err := validatePortName(port.Name); err != nil {
+		return PortConfig{}, fmt.Errorf("invalid port %q: %w", spec, err)
+	}
+	return port, nil
+}
+
+func parsePortDirection(s string) (portDirection, error) {
+	switch s {
+	case "in":
+		return portInput, nil
+	case "out":
+		return portOutput, nil
+	}
+	return 0, fmt.Errorf("direction %q must be in or out", s)
+}
+
+// validatePortName checks that a name can be used both as a MIDI port name
+// and as one segment of an OSC address.
+func validatePortName(name string) error {
+	if name == "" {
+		return errors.New("port name must not be empty")
+	}
+	if strings.ContainsAny(name, "/: #,"+oscPatternChars) {
+		return fmt.Errorf("port name %q may not contain any of /:#,%s or spaces", name, oscPatternChars)
+	}
+	return nil
+}
+
+// portFlag collects repeated --port flags.
+type portFlag []PortConfig
+
+func (f *portFlag) String() string {
+	specs := make([]string, len(*f))
+	for i, p := range *f {
+		specs[i] = p.Name + ":" + p.Direction.String()
+	}
+	return strings.Join(specs, ",")
+}
+
+func (f *portFlag) Set(value string) error {
+	port, err := parsePortSpec(value)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, port)
+	return nil
+}
+
+// bridgePort is a MIDI port registered by the bridge.
+type bridgePort struct {
+	name   string
+	dir    portDirection
+	prefix string // OSC address prefix, /port/<name>; empty for default ports
+	port   midiPort
+
+	controllers ccAssembler // Input ports only; RT thread only
+	mpe         mpeDecoder  // Input ports only; RT thread only
+	clockTicks  uint32      // Input ports only; clock ticks since Start; RT thread only
+	notes       noteTracker // Output ports only
+}
+
+// compileConnectPattern compiles an auto-connect regexp; empty disables it.
+func compileConnectPattern(option, pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s pattern: %w", option, err)
+	}
+	return re, nil
+}
+
+// autoConnect connects the output ports to every external port matching
+// connectOut, and every external port matching connectIn to the input
+// ports. Existing connections are left alone, so it is safe to repeat.
+func (b *Bridge) autoConnect() {
+	connect := func(pattern *regexp.Regexp, dir portDirection, ports []*bridgePort) {
+		if pattern == nil {
+			return
+		}
+		external, err := b.backend.ExternalPorts(dir)
+		if err != nil {
+			fmt.Printf("WARNING: Cannot list MIDI ports: %v\n", err)
+			return
+		}
+		for _, name := range external {
+			if !pattern.MatchString(name) {
+				continue
+			}
+			for _, port := range ports {
+				source, destination := port.port.Name(), name
+				if dir == portOutput {
+					source, destination = name, port.port.Name()
+				}
+				switch err := b.backend.Connect(source, destination); {
+				case err == nil:
+					fmt.Printf("CONNECTED %s -> %s\n", source, destination)
+				case errors.Is(err, errAlreadyConnected):
+				default:
+					fmt.Printf("WARNING: %v\n", err)
+				}
+			}
+		}
+	}
+
+	connect(b.connectOut, portInput, b.outPorts)
+	connect(b.connectIn, portOutput, b.inPorts)
+}
+
+// notifyPortsChanged is the backend's port registration callback. It only
+// wakes watchPorts, since backends don't allow connecting from callbacks.
+func (b *Bridge) notifyPortsChanged() {
+	select {
+	case b.portsChanged <- struct{}{}:
+	default: // A re-scan is already pending
+	}
+}
+
+// watchPorts re-applies the auto-connect patterns whenever ports appear,
+// until Cleanup.
+func (b *Bridge) watchPorts() {
+	for {
+		select {
+		case <-b.portsChanged:
+			debugBridge("MIDI ports changed, re-applying auto-connect")
+			b.autoConnect()
+		case <-b.done:
+			return
+		}
+	}
+}
+
+// portInfo describes a MIDI port for --list-ports.
+type portInfo struct {
+	Name        string   `json:"name"`
+	Client      string   `json:"client"`
+	Direction   string   `json:"direction"` // in (receives MIDI) or out (sends it)
+	Type        string   `json:"type"`      // physical (hardware) or virtual
+	Aliases     []string `json:"aliases"`
+	Connections []string `json:"connections"`
+}
+
+// ListPorts prints the MIDI ports of the named backend as text or JSON.
+func ListPorts(backendName, format string) error {
+	open, err := lookupBackend(backendName)
+	if err != nil {
+		return err
+	}
+	if backendName == "" {
+		backendName = "jack"
+	}
+	title := fmt.Sprintf("Available %s MIDI ports:", strings.ToUpper(backendName))
+	return listPorts(os.Stdout, open, title, format)
+}
+
+// listPorts writes the ports of the backend opened with open.
+func listPorts(w io.Writer, open backendOpener, title, format string) error {
+	if !validListFormat(format) {
+		return fmt.Errorf("invalid list format %q (expected text or json)", format)
+	}
+	backend, err := open("osc-midi-bridge-list")
+	if err != nil {
+		return err
+	}
+	defer backend.Close()
+
+	ports, err := backend.ListPorts()
+	if err != nil {
+		return err
+	}
+	return writePortList(w, title, ports, format)
+}
+
+// validListFormat reports whether format is a --format value.
+func validListFormat(format string) bool {
+	return format == "text" || format == "json"
+}
+
+// writePortList prints ports as text or as a JSON array.
+func writePortList(w io.Writer, title string, ports []portInfo, format string) error {
+	switch format {
+	case "json":
+		// Empty lists as [] rather than null
+		list := make([]portInfo, len(ports))
+		for i, port := range ports {
+			if port.Aliases == nil {
+				port.Aliases = []string{}
+			}
+			if port.Connections == nil {
+				port.Connections = []string{}
+			}
+			list[i] = port
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(list)
+	case "text":
+	default:
+		return fmt.Errorf("invalid list format %q (expected text or json)", format)
+	}
+
+	fmt.Fprintln(w, title)
+	fmt.Fprintln(w, strings.Repeat("=", len(title)))
+	if len(ports) == 0 {
+		fmt.Fprintln(w, "No MIDI ports found")
+		return nil
+	}
+	for i, port := range ports {
+		fmt.Fprintf(w, "%d. %s (%s, %s)\n", i+1, port.Name, port.Direction, port.Type)
+		fmt.Fprintf(w, "   Client: %s\n", port.Client)
+		if len(port.Aliases) > 0 {
+			fmt.Fprintf(w, "   Aliases: %s\n", strings.Join(port.Aliases, ", "))
+		}
+		if len(port.Connections) > 0 {
+			fmt.Fprintf(w, "   Connections: %s\n", strings.Join(port.Connections, ", "))
+		} else {
+			fmt.Fprintln(w, "   Connections: none")
+		}
+	}
+	return nil
+}
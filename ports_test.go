@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParsePortSpec(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    PortConfig
+		wantErr bool
+	}{
+		{"drums:out", PortConfig{"drums", portOutput}, false},
+		{"keys:in", PortConfig{"keys", portInput}, false},
+		{"synth-2_a:out", PortConfig{"synth-2_a", portOutput}, false},
+		{"drums", PortConfig{}, true},
+		{"drums:both", PortConfig{}, true},
+		{":out", PortConfig{}, true},
+		{"a/b:out", PortConfig{}, true},
+		{"a*:in", PortConfig{}, true},
+		{"a b:in", PortConfig{}, true},
+		{"a:b:in", PortConfig{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := parsePortSpec(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parsePortSpec(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parsePortSpec(%q) = %v, want %v", tt.spec, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPortFlag(t *testing.T) {
+	var ports portFlag
+	for _, spec := range []string{"drums:out", "keys:in"} {
+		if err := ports.Set(spec); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if err := ports.Set("bad"); err == nil {
+		t.Error("Expected error for a port without direction")
+	}
+	if len(ports) != 2 || ports.String() != "drums:out,keys:in" {
+		t.Errorf("Expected drums:out,keys:in, got %s", ports.String())
+	}
+}
+
+func TestWritePortList(t *testing.T) {
+	ports := []portInfo{
+		{
+			Name:        "system:midi_capture_1",
+			Client:      "system",
+			Direction:   "out",
+			Type:        "physical",
+			Aliases:     []string{"alsa_pcm:Keystation/midi_capture_1"},
+			Connections: []string{"osc-midi-bridge:midi_in"},
+		},
+		{Name: "osc-midi-bridge:midi_in", Client: "osc-midi-bridge", Direction: "in", Type: "virtual"},
+	}
+
+	var text bytes.Buffer
+	if err := writePortList(&text, "Ports:", ports, "text"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, want := range []string{
+		"1. system:midi_capture_1 (out, physical)",
+		"   Client: system",
+		"   Aliases: alsa_pcm:Keystation/midi_capture_1",
+		"   Connections: osc-midi-bridge:midi_in",
+		"2. osc-midi-bridge:midi_in (in, virtual)",
+		"   Connections: none",
+	} {
+		if !strings.Contains(text.String(), want+"\n") {
+			t.Errorf("Expected line %q in:\n%s", want, text.String())
+		}
+	}
+
+	var js bytes.Buffer
+	if err := writePortList(&js, "Ports:", ports, "json"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var got []portInfo
+	if err := json.Unmarshal(js.Bytes(), &got); err != nil {
+		t.Fatalf("Invalid JSON: %v\n%s", err, js.String())
+	}
+	ports[1].Aliases, ports[1].Connections = []string{}, []string{}
+	if !reflect.DeepEqual(got, ports) {
+		t.Errorf("Expected %+v, got %+v", ports, got)
+	}
+
+	js.Reset()
+	if err := writePortList(&js, "Ports:", nil, "json"); err != nil || strings.TrimSpace(js.String()) != "[]" {
+		t.Errorf("Expected [] for no ports, got %q (%v)", js.String(), err)
+	}
+	if err := writePortList(&js, "Ports:", nil, "xml"); err == nil {
+		t.Error("Expected error for an unknown format")
+	}
+}
+
+func TestListPorts(t *testing.T) {
+	backend := newFakeBackend(48000)
+	backend.external["synth:midi_in"] = portInput
+	backend.external["keys:midi_out"] = portOutput
+	backend.connections[[2]string{"keys:midi_out", "synth:midi_in"}] = true
+
+	var out bytes.Buffer
+	if err := listPorts(&out, backend.opener(), "Available FAKE MIDI ports:", "text"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, want := range []string{
+		"Available FAKE MIDI ports:",
+		"1. keys:midi_out (out, virtual)",
+		"   Connections: synth:midi_in",
+		"2. synth:midi_in (in, virtual)",
+		"   Connections: keys:midi_out",
+	} {
+		if !strings.Contains(out.String(), want+"\n") {
+			t.Errorf("Expected line %q in:\n%s", want, out.String())
+		}
+	}
+	if !backend.closed {
+		t.Error("Expected the listing client to be closed")
+	}
+
+	if err := listPorts(&out, backend.opener(), "", "xml"); err == nil {
+		t.Error("Expected error for an unknown format")
+	}
+	if err := ListPorts("coremidi", "text"); err == nil {
+		t.Error("Expected error for an unknown backend")
+	}
+}
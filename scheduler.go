@@ -0,0 +1,115 @@
+package main
+
+import (
+	"math"
+	"time"
+)
+
+// maxScheduleAhead bounds how far in the future a bundle timetag may
+// schedule MIDI. JACK frame times are 32-bit and wrap, so comparisons are
+// only meaningful within half the counter range (about 3 hours at 192kHz).
+const maxScheduleAhead = time.Hour
+
+// scheduledEvent is a MIDI event waiting for an absolute JACK frame time.
+type scheduledEvent struct {
+	frame uint32
+	seq   uint64 // Insertion order, so events at the same frame stay FIFO
+	event *MidiEvent
+}
+
+// midiScheduler holds timestamped MIDI events in frame order until the
+// process callback reaches them. It is a binary min-heap over a fixed-size
+// slice, so push and pop never allocate in the real-time thread.
+type midiScheduler struct {
+	items []scheduledEvent
+	seq   uint64
+}
+
+func newMidiScheduler(capacity int) *midiScheduler {
+	return &midiScheduler{items: make([]scheduledEvent, 0, capacity)}
+}
+
+func (s *midiScheduler) len() int {
+	return len(s.items)
+}
+
+// push adds an event for the given frame. It returns false if the scheduler
+// is full.
+func (s *midiScheduler) push(frame uint32, event *MidiEvent) bool {
+	if len(s.items) == cap(s.items) {
+		return false
+	}
+	s.seq++
+	s.items = append(s.items, scheduledEvent{frame: frame, seq: s.seq, event: event})
+
+	// Sift up
+	i := len(s.items) - 1
+	for i > 0 {
+		parent := (i - 1) / 2
+		if !s.less(i, parent) {
+			break
+		}
+		s.items[i], s.items[parent] = s.items[parent], s.items[i]
+		i = parent
+	}
+	return true
+}
+
+// peek returns the frame of the earliest event.
+func (s *midiScheduler) peek() (uint32, bool) {
+	if len(s.items) == 0 {
+		return 0, false
+	}
+	return s.items[0].frame, true
+}
+
+// pop removes and returns the earliest event, or nil if empty.
+func (s *midiScheduler) pop() *MidiEvent {
+	if len(s.items) == 0 {
+		return nil
+	}
+	event := s.items[0].event
+	last := len(s.items) - 1
+	s.items[0] = s.items[last]
+	s.items[last] = scheduledEvent{} // Drop the reference for the GC
+	s.items = s.items[:last]
+
+	// Sift down
+	i := 0
+	for {
+		smallest := i
+		if left := 2*i + 1; left < len(s.items) && s.less(left, smallest) {
+			smallest = left
+		}
+		if right := 2*i + 2; right < len(s.items) && s.less(right, smallest) {
+			smallest = right
+		}
+		if smallest == i {
+			break
+		}
+		s.items[i], s.items[smallest] = s.items[smallest], s.items[i]
+		i = smallest
+	}
+	return event
+}
+
+func (s *midiScheduler) less(i, j int) bool {
+	a, b := s.items[i], s.items[j]
+	if a.frame != b.frame {
+		return frameBefore(a.frame, b.frame)
+	}
+	return a.seq < b.seq
+}
+
+// frameBefore reports whether frame a comes before frame b, allowing for
+// wraparound of the 32-bit JACK frame counter.
+func frameBefore(a, b uint32) bool {
+	return int32(a-b) < 0
+}
+
+// frameForTime maps a wall-clock time to a JACK frame time, given a
+// reference point where refFrame was the frame time at refTime.
+func frameForTime(at, refTime time.Time, refFrame, sampleRate uint32) uint32 {
+	frames := math.Round(at.Sub(refTime).Seconds() * float64(sampleRate))
+	return refFrame + uint32(int64(frames))
+}
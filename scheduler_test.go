@@ -0,0 +1,94 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMidiSchedulerOrder(t *testing.T) {
+	s := newMidiScheduler(16)
+	frames := []uint32{500, 100, 300, 100, 0, 900, 300}
+	events := make([]*MidiEvent, len(frames))
+	for i, frame := range frames {
+		events[i] = &MidiEvent{}
+		if !s.push(frame, events[i]) {
+			t.Fatalf("push %d failed", i)
+		}
+	}
+
+	// Earliest frame first; equal frames in insertion order
+	expected := []int{4, 1, 3, 2, 6, 0, 5}
+	for _, idx := range expected {
+		frame, ok := s.peek()
+		if !ok || frame != frames[idx] {
+			t.Fatalf("peek = %d, %t, expected %d", frame, ok, frames[idx])
+		}
+		if event := s.pop(); event != events[idx] {
+			t.Fatalf("pop returned wrong event for frame %d", frames[idx])
+		}
+	}
+	if s.len() != 0 || s.pop() != nil {
+		t.Error("Expected empty scheduler")
+	}
+	if _, ok := s.peek(); ok {
+		t.Error("Expected peek on empty scheduler to fail")
+	}
+}
+
+func TestMidiSchedulerCapacity(t *testing.T) {
+	s := newMidiScheduler(2)
+	if !s.push(1, &MidiEvent{}) || !s.push(2, &MidiEvent{}) {
+		t.Fatal("Expected pushes within capacity to succeed")
+	}
+	if s.push(3, &MidiEvent{}) {
+		t.Error("Expected push beyond capacity to fail")
+	}
+
+	// The backing array is never reallocated
+	before := cap(s.items)
+	s.pop()
+	s.push(4, &MidiEvent{})
+	if cap(s.items) != before {
+		t.Errorf("Scheduler reallocated: capacity %d -> %d", before, cap(s.items))
+	}
+}
+
+func TestMidiSchedulerWraparound(t *testing.T) {
+	s := newMidiScheduler(4)
+	late := &MidiEvent{}
+	early := &MidiEvent{}
+
+	// Frame 10 after the counter wraps comes after 0xFFFFFFF0
+	s.push(10, late)
+	s.push(0xFFFFFFF0, early)
+	if s.pop() != early || s.pop() != late {
+		t.Error("Expected events ordered across frame counter wraparound")
+	}
+
+	if !frameBefore(0xFFFFFFFF, 0) || frameBefore(0, 0xFFFFFFFF) {
+		t.Error("frameBefore does not handle wraparound")
+	}
+}
+
+func TestFrameForTime(t *testing.T) {
+	ref := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		at       time.Time
+		refFrame uint32
+		expected uint32
+	}{
+		{"same time", ref, 1000, 1000},
+		{"10ms later", ref.Add(10 * time.Millisecond), 1000, 1480},
+		{"1s later", ref.Add(time.Second), 0, 48000},
+		{"in the past", ref.Add(-time.Millisecond), 1000, 952},
+		{"across wraparound", ref.Add(time.Millisecond), 0xFFFFFFF0, 32},
+	}
+
+	for _, tt := range tests {
+		if frame := frameForTime(tt.at, ref, tt.refFrame, 48000); frame != tt.expected {
+			t.Errorf("%s: frameForTime = %d, expected %d", tt.name, frame, tt.expected)
+		}
+	}
+}
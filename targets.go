@@ -0,0 +1,400 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hypebeast/go-osc/osc"
+)
+
+// maxSubscriptions bounds the targets clients can add with /bridge/subscribe.
+const maxSubscriptions = 64
+
+// maxReplyPeers bounds the senders remembered with --reply-to all; the
+// least recently heard is forgotten first.
+const maxReplyPeers = 64
+
+// Reply modes selectable with --reply-to
+const (
+	replyOff  = "off"
+	replyLast = "last" // The most recent sender
+	replyAll  = "all"  // Every sender heard within the subscription lifetime
+)
+
+func validReplyMode(mode string) bool {
+	return mode == replyOff || mode == replyLast || mode == replyAll
+}
+
+// OSCTarget is a destination for MIDI→OSC messages. Only messages whose
+// address matches Pattern, an OSC address pattern, are sent to it.
+type OSCTarget struct {
+	Host    string
+	Port    int
+	Pattern string // Empty matches every address
+}
+
+// parseOSCTarget parses a --osc-target value of the form host:port or
+// host:port/pattern, e.g. 10.0.0.5:7000/midi/*/cc.
+func parseOSCTarget(spec string) (OSCTarget, error) {
+	hostPort, pattern := spec, ""
+	if i := strings.IndexByte(spec, '/'); i >= 0 {
+		hostPort, pattern = spec[:i], spec[i:]
+	}
+	host, portStr, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		return OSCTarget{}, fmt.Errorf("invalid OSC target %q (expected host:port or host:port/pattern)", spec)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 1 || port > 65535 {
+		return OSCTarget{}, fmt.Errorf("invalid OSC target %q: port must be 1-65535", spec)
+	}
+	if host == "" {
+		host = "localhost"
+	}
+	return OSCTarget{Host: host, Port: port, Pattern: pattern}, nil
+}
+
+func (t OSCTarget) String() string {
+	return net.JoinHostPort(t.Host, strconv.Itoa(t.Port)) + t.Pattern
+}
+
+func (t OSCTarget) matches(address string) bool {
+	return t.Pattern == "" || matchOSCAddress(t.Pattern, address)
+}
+
+// oscTargetFlag collects repeated --osc-target flags.
+type oscTargetFlag []OSCTarget
+
+func (f *oscTargetFlag) String() string {
+	specs := make([]string, len(*f))
+	for i, t := range *f {
+		specs[i] = t.String()
+	}
+	return strings.Join(specs, ",")
+}
+
+func (f *oscTargetFlag) Set(value string) error {
+	target, err := parseOSCTarget(value)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, target)
+	return nil
+}
+
+// oscRoute is a target in the bridge's routing table; subscriptions and
+// reply peers expire unless renewed.
+type oscRoute struct {
+	target  OSCTarget
+	expires time.Time      // Zero for targets from the configuration
+	peer    bool           // Added by --reply-to rather than configured or subscribed
+	conn    net.PacketConn // Socket to reply from; nil for a socket of its own
+}
+
+// oscDestination identifies the sender used for a target; targets with the
+// same host, port and socket share it.
+type oscDestination struct {
+	host string
+	port int
+	conn net.PacketConn
+}
+
+// destinations returns where a message with the given address goes, and
+// the set of destinations still in use by any target. Expired
+// subscriptions are dropped.
+func (b *Bridge) destinations(address string, now time.Time) ([]oscDestination, map[oscDestination]bool) {
+	b.targetsMu.Lock()
+	defer b.targetsMu.Unlock()
+
+	b.expireSubscriptions(now)
+	live := make(map[oscDestination]bool, len(b.targets))
+	var dests []oscDestination
+	for _, route := range b.targets {
+		dest := oscDestination{route.target.Host, route.target.Port, route.conn}
+		if route.target.matches(address) && !live[dest] {
+			dests = append(dests, dest)
+		}
+		live[dest] = true
+	}
+	return dests, live
+}
+
+// expireSubscriptions removes subscriptions that weren't renewed in time.
+// Must be called with targetsMu held.
+func (b *Bridge) expireSubscriptions(now time.Time) {
+	routes := b.targets[:0]
+	for _, route := range b.targets {
+		if !route.expires.IsZero() && now.After(route.expires) {
+			fmt.Printf("EXPIRED %s\n", route.target)
+			continue
+		}
+		routes = append(routes, route)
+	}
+	b.targets = routes
+}
+
+// subscribe adds a target, or renews it if it is already subscribed.
+func (b *Bridge) subscribe(target OSCTarget, now time.Time) error {
+	b.targetsMu.Lock()
+	defer b.targetsMu.Unlock()
+
+	b.expireSubscriptions(now)
+	subscriptions := 0
+	for i, route := range b.targets {
+		if route.peer {
+			continue
+		}
+		if route.target == target {
+			if !route.expires.IsZero() {
+				b.targets[i].expires = now.Add(b.subscriptionTTL)
+			}
+			return nil
+		}
+		if !route.expires.IsZero() {
+			subscriptions++
+		}
+	}
+	if subscriptions >= maxSubscriptions {
+		return fmt.Errorf("cannot subscribe %s: limit of %d subscriptions reached", target, maxSubscriptions)
+	}
+	b.targets = append(b.targets, oscRoute{target: target, expires: now.Add(b.subscriptionTTL)})
+	fmt.Printf("SUBSCRIBED %s for %s\n", target, b.subscriptionTTL)
+	return nil
+}
+
+// unsubscribe removes the subscriptions of host:port with the given
+// pattern, or all of them if pattern is nil. Configured targets stay.
+func (b *Bridge) unsubscribe(host string, port int, pattern *string) {
+	b.targetsMu.Lock()
+	defer b.targetsMu.Unlock()
+
+	routes := b.targets[:0]
+	for _, route := range b.targets {
+		t := route.target
+		if !route.expires.IsZero() && !route.peer && t.Host == host && t.Port == port && (pattern == nil || t.Pattern == *pattern) {
+			fmt.Printf("UNSUBSCRIBED %s\n", t)
+			continue
+		}
+		routes = append(routes, route)
+	}
+	b.targets = routes
+}
+
+// notePeer records the sender of an OSC packet as a --reply-to target,
+// renewing it if already known. conn is the socket the packet arrived on.
+func (b *Bridge) notePeer(addr net.Addr, conn net.PacketConn, now time.Time) {
+	udpAddr, ok := addr.(*net.UDPAddr)
+	if !ok {
+		return
+	}
+	target := OSCTarget{Host: udpAddr.IP.String(), Port: udpAddr.Port}
+	if !b.replyFromServer {
+		conn = nil
+	}
+
+	b.targetsMu.Lock()
+	defer b.targetsMu.Unlock()
+
+	peers, oldest := 0, -1
+	for i, route := range b.targets {
+		if !route.peer {
+			continue
+		}
+		if route.target == target {
+			b.targets[i].expires = now.Add(b.subscriptionTTL)
+			return
+		}
+		peers++
+		if oldest < 0 || route.expires.Before(b.targets[oldest].expires) {
+			oldest = i
+		}
+	}
+
+	// Make room: --reply-to last keeps only the newest sender
+	if peers > 0 && (b.replyTo == replyLast || peers >= maxReplyPeers) {
+		routes := b.targets[:0]
+		for i, route := range b.targets {
+			if route.peer && (b.replyTo == replyLast || i == oldest) {
+				debugTransport("Forgetting OSC sender %s", route.target)
+				continue
+			}
+			routes = append(routes, route)
+		}
+		b.targets = routes
+	}
+
+	b.targets = append(b.targets, oscRoute{target: target, expires: now.Add(b.subscriptionTTL), peer: true, conn: conn})
+	fmt.Printf("REPLYING TO %s\n", target)
+}
+
+// parseSubscription reads the [host, port, pattern] arguments of
+// /bridge/subscribe and /bridge/unsubscribe; pattern is optional.
+func parseSubscription(msg *osc.Message) (host string, port int, pattern *string, err error) {
+	if len(msg.Arguments) < 2 {
+		return "", 0, nil, fmt.Errorf("%s requires arguments: host, port[, pattern]", msg.Address)
+	}
+	host, ok := msg.Arguments[0].(string)
+	if !ok {
+		return "", 0, nil, fmt.Errorf("%s host must be a string, got %T", msg.Address, msg.Arguments[0])
+	}
+	if host == "" {
+		host = "localhost"
+	}
+	port, ok = toInt(msg.Arguments[1])
+	if !ok || port < 1 || port > 65535 {
+		return "", 0, nil, fmt.Errorf("%s port must be 1-65535, got %v", msg.Address, msg.Arguments[1])
+	}
+	if len(msg.Arguments) > 2 {
+		p, ok := msg.Arguments[2].(string)
+		if !ok || (p != "" && p[0] != '/') {
+			return "", 0, nil, fmt.Errorf("%s pattern must be an OSC address pattern, got %v", msg.Address, msg.Arguments[2])
+		}
+		pattern = &p
+	}
+	return host, port, pattern, nil
+}
+
+// handleSubscribe adds or renews the target given by a /bridge/subscribe
+// message: host, port and an optional address pattern.
+func (b *Bridge) handleSubscribe(msg *osc.Message) error {
+	host, port, pattern, err := parseSubscription(msg)
+	if err != nil {
+		return err
+	}
+	target := OSCTarget{Host: host, Port: port}
+	if pattern != nil {
+		target.Pattern = *pattern
+	}
+	return b.subscribe(target, time.Now())
+}
+
+// handleUnsubscribe removes targets given by a /bridge/unsubscribe
+// message: host, port and optionally the pattern they subscribed with.
+func (b *Bridge) handleUnsubscribe(msg *osc.Message) error {
+	host, port, pattern, err := parseSubscription(msg)
+	if err != nil {
+		return err
+	}
+	b.unsubscribe(host, port, pattern)
+	return nil
+}
+
+// oscTargetQueueSize is how many messages may wait for a slow destination
+// before more are dropped.
+const oscTargetQueueSize = 64
+
+// oscTargetQueue holds the messages for one destination. They are sent by
+// its own goroutine, so a slow or unreachable target, such as one added
+// with /bridge/subscribe, only loses its own messages.
+type oscTargetQueue struct {
+	send chan *osc.Message
+	done chan struct{} // Closed once send is closed and emptied
+}
+
+// newOSCTargetQueue starts sending queued messages with client.
+func newOSCTargetQueue(dest oscDestination, client oscSender) *oscTargetQueue {
+	q := &oscTargetQueue{
+		send: make(chan *osc.Message, oscTargetQueueSize),
+		done: make(chan struct{}),
+	}
+	go q.sendLoop(dest, client)
+	return q
+}
+
+// sendLoop sends queued messages until send is closed, then closes client.
+func (q *oscTargetQueue) sendLoop(dest oscDestination, client oscSender) {
+	defer close(q.done)
+	defer closeOSCSender(client)
+	for msg := range q.send {
+		if err := client.Send(msg); errors.Is(err, errOSCTargetDown) {
+			debugTransport("Dropping OSC message %s: %v", msg.Address, err)
+		} else if err != nil {
+			fmt.Printf("WARNING: Failed to send OSC message %s to %s: %v\n", msg.Address, dest, err)
+		}
+	}
+}
+
+func (d oscDestination) String() string {
+	return net.JoinHostPort(d.host, strconv.Itoa(d.port))
+}
+
+// sendOSC queues a message for every target it matches, starting a queue
+// on first use and closing those no target uses any more. Only called from
+// the OSC sender goroutine, which owns queues.
+func (b *Bridge) sendOSC(msg *osc.Message, queues map[oscDestination]*oscTargetQueue) {
+	dests, live := b.destinations(msg.Address, time.Now())
+	closeUnusedQueues(queues, live)
+
+	for _, dest := range dests {
+		q, ok := queues[dest]
+		if !ok {
+			q = newOSCTargetQueue(dest, b.newDestinationSender(dest))
+			queues[dest] = q
+		}
+		select {
+		case q.send <- msg:
+		default:
+			debugTransport("OSC target %s is too slow, dropping %s", dest, msg.Address)
+		}
+	}
+}
+
+// expireTargets drops expired subscriptions and closes the queues of the
+// destinations they leave unused, so an idle bridge forgets them too. Only
+// called from the OSC sender goroutine.
+func (b *Bridge) expireTargets(now time.Time, queues map[oscDestination]*oscTargetQueue) {
+	_, live := b.destinations("", now)
+	closeUnusedQueues(queues, live)
+}
+
+// closeUnusedQueues closes and removes the queues of destinations that are
+// not live.
+func closeUnusedQueues(queues map[oscDestination]*oscTargetQueue, live map[oscDestination]bool) {
+	for dest, q := range queues {
+		if !live[dest] {
+			close(q.send)
+			delete(queues, dest)
+		}
+	}
+}
+
+// newDestinationSender returns the sender for a destination: the server
+// socket for replies, a multicast socket, or the transport's sender.
+func (b *Bridge) newDestinationSender(dest oscDestination) oscSender {
+	if dest.conn != nil {
+		return &packetConnSender{conn: dest.conn, addr: &net.UDPAddr{IP: net.ParseIP(dest.host), Port: dest.port}}
+	}
+	if ip := net.ParseIP(dest.host).To4(); ip != nil && ip.IsMulticast() {
+		return &multicastSender{group: &net.UDPAddr{IP: ip, Port: dest.port}, ttl: b.multicastTTL, iface: b.multicastIface}
+	}
+	return newOSCSender(b.oscTransport, dest.host, dest.port)
+}
+
+func closeOSCSender(client oscSender) {
+	if closer, ok := client.(io.Closer); ok {
+		if err := closer.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+			debugTransport("Error closing OSC sender: %v", err)
+		}
+	}
+}
+
+// packetConnSender sends OSC packets from a socket shared with the OSC
+// server, so replies come from the port the sender sent to.
+type packetConnSender struct {
+	conn net.PacketConn
+	addr net.Addr
+}
+
+func (s *packetConnSender) Send(packet osc.Packet) error {
+	data, err := packet.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	_, err = s.conn.WriteTo(data, s.addr)
+	return err
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hypebeast/go-osc/osc"
+)
+
+func TestParseOSCTarget(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    OSCTarget
+		wantErr bool
+	}{
+		{"10.0.0.5:7000", OSCTarget{"10.0.0.5", 7000, ""}, false},
+		{"desk.local:7000/midi/*/cc", OSCTarget{"desk.local", 7000, "/midi/*/cc"}, false},
+		{"[::1]:9000/port/keys/midi/*/*", OSCTarget{"::1", 9000, "/port/keys/midi/*/*"}, false},
+		{":8000", OSCTarget{"localhost", 8000, ""}, false},
+		{"localhost", OSCTarget{}, true},
+		{"localhost:0", OSCTarget{}, true},
+		{"localhost:http", OSCTarget{}, true},
+		{"/midi/*/cc", OSCTarget{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := parseOSCTarget(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseOSCTarget(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseOSCTarget(%q) = %v, want %v", tt.spec, got, tt.want)
+			}
+		})
+	}
+}
+
+// udpTarget returns an OSC target for a listening socket.
+func udpTarget(conn *net.UDPConn, pattern string) OSCTarget {
+	return OSCTarget{Host: "127.0.0.1", Port: conn.LocalAddr().(*net.UDPAddr).Port, Pattern: pattern}
+}
+
+// expectNoOSC fails if the socket receives a message soon.
+func expectNoOSC(t *testing.T, conn *net.UDPConn) {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	buf := make([]byte, 65536)
+	if n, err := conn.Read(buf); err == nil {
+		packet, _ := osc.ParsePacket(string(buf[:n]))
+		t.Errorf("Expected no OSC message, got %v", packet)
+	}
+}
+
+func TestBridgeOSCTargets(t *testing.T) {
+	all, cc := listenOSC(t), listenOSC(t)
+	_, backend, _ := newTestBridge(t, Config{
+		PitchBendFormat: pitchBendSigned,
+		OSCTargets:      []OSCTarget{udpTarget(all, ""), udpTarget(cc, "/midi/*/cc")},
+	})
+
+	in := backend.port("midi_in")
+	in.send(0, 0x90, 60, 100)
+	in.send(1, 0xB0, 7, 90)
+	backend.cycle(64)
+
+	for _, want := range []string{"/midi/0/note_on", "/midi/0/cc"} {
+		if msg := receiveOSC(t, all); msg.Address != want {
+			t.Errorf("Unfiltered target: expected %s, got %s", want, msg.Address)
+		}
+	}
+	if msg := receiveOSC(t, cc); msg.Address != "/midi/0/cc" {
+		t.Errorf("Filtered target: expected /midi/0/cc, got %s", msg.Address)
+	}
+	expectNoOSC(t, cc)
+}
+
+func TestBridgeSlowOSCTarget(t *testing.T) {
+	// A TCP target that accepts but never reads
+	stalled, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Cannot listen: %v", err)
+	}
+	defer stalled.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		if conn, err := stalled.Accept(); err == nil {
+			conn.(*net.TCPConn).SetReadBuffer(4096)
+			accepted <- conn
+		}
+	}()
+
+	udp := listenOSC(t)
+	slow := OSCTarget{Host: "127.0.0.1", Port: stalled.Addr().(*net.TCPAddr).Port}
+	bridge, _, _ := newTestBridge(t, Config{
+		PitchBendFormat: pitchBendSigned,
+		OSCTargets:      []OSCTarget{udpTarget(udp, ""), slow},
+	})
+
+	// The slow target is sent to over TCP with a small buffer, so it stalls soon
+	client := newOSCSender(oscTransportTCPSLIP, slow.Host, slow.Port).(*oscStreamClient)
+	if err := client.Send(osc.NewMessage("/hello")); err != nil {
+		t.Fatalf("Cannot connect: %v", err)
+	}
+	client.conn.(*net.TCPConn).SetWriteBuffer(4096)
+	queues := map[oscDestination]*oscTargetQueue{
+		{host: slow.Host, port: slow.Port}: newOSCTargetQueue(oscDestination{host: slow.Host, port: slow.Port}, client),
+	}
+	defer func() {
+		if conn := <-accepted; conn != nil {
+			conn.Close()
+		}
+		for _, q := range queues {
+			close(q.send)
+		}
+	}()
+
+	// The UDP target receives every message promptly while the TCP one falls behind
+	buf := make([]byte, 65536)
+	for i := 0; i < 2*oscTargetQueueSize; i++ {
+		bridge.sendOSC(osc.NewMessage("/padded", int32(i), strings.Repeat("x", 8192)), queues)
+		udp.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
+		n, err := udp.Read(buf)
+		if err != nil {
+			t.Fatalf("Message %d: UDP target received nothing: %v", i, err)
+		}
+		packet, err := osc.ParsePacket(string(buf[:n]))
+		if msg, ok := packet.(*osc.Message); err != nil || !ok || msg.Arguments[0] != int32(i) {
+			t.Fatalf("Message %d: unexpected %v (%v)", i, packet, err)
+		}
+	}
+	if q := queues[oscDestination{host: slow.Host, port: slow.Port}]; len(q.send) != oscTargetQueueSize {
+		t.Errorf("Expected the TCP target's queue to be full, got %d messages", len(q.send))
+	}
+}
+
+func TestBridgeSubscriptions(t *testing.T) {
+	bridge, backend, conn := newTestBridge(t, Config{PitchBendFormat: pitchBendSigned})
+	sub := listenOSC(t)
+	port := int32(sub.LocalAddr().(*net.UDPAddr).Port)
+	in := backend.port("midi_in")
+
+	bridge.dispatcher.Dispatch(osc.NewMessage("/bridge/subscribe", "127.0.0.1", port, "/midi/*/note_on"))
+	in.send(0, 0xB0, 7, 90)
+	in.send(1, 0x90, 60, 100)
+	backend.cycle(64)
+	if msg := receiveOSC(t, sub); msg.Address != "/midi/0/note_on" {
+		t.Errorf("Expected /midi/0/note_on, got %s", msg.Address)
+	}
+	receiveOSC(t, conn) // The configured target still gets everything
+	receiveOSC(t, conn)
+
+	// Unsubscribing without a pattern removes every subscription of host:port
+	bridge.dispatcher.Dispatch(osc.NewMessage("/bridge/unsubscribe", "127.0.0.1", port))
+	in.send(0, 0x90, 62, 100)
+	backend.cycle(64)
+	receiveOSC(t, conn)
+	expectNoOSC(t, sub)
+
+	// Invalid subscriptions are rejected
+	for _, msg := range []*osc.Message{
+		osc.NewMessage("/bridge/subscribe", "127.0.0.1"),
+		osc.NewMessage("/bridge/subscribe", int32(1), port),
+		osc.NewMessage("/bridge/subscribe", "127.0.0.1", int32(70000)),
+		osc.NewMessage("/bridge/subscribe", "127.0.0.1", port, "midi"),
+	} {
+		bridge.dispatcher.Dispatch(msg)
+	}
+	bridge.targetsMu.Lock()
+	defer bridge.targetsMu.Unlock()
+	if len(bridge.targets) != 1 {
+		t.Errorf("Expected only the configured target, got %v", bridge.targets)
+	}
+}
+
+func TestSubscriptionExpiry(t *testing.T) {
+	bridge := &Bridge{
+		targets:         []oscRoute{{target: OSCTarget{Host: "localhost", Port: 8000}}},
+		subscriptionTTL: time.Minute,
+	}
+	start := time.Now()
+	target := OSCTarget{Host: "tablet", Port: 9000}
+
+	if err := bridge.subscribe(target, start); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// Renewing extends the lifetime instead of adding a target
+	if err := bridge.subscribe(target, start.Add(50*time.Second)); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		at   time.Duration
+		want int
+	}{
+		{90 * time.Second, 2},
+		{111 * time.Second, 1}, // Expired; the configured target stays
+	}
+	for _, tt := range tests {
+		dests, _ := bridge.destinations("/midi/0/note_on", start.Add(tt.at))
+		if len(dests) != tt.want {
+			t.Errorf("After %s: expected %d destinations, got %v", tt.at, tt.want, dests)
+		}
+	}
+
+	// Subscriptions are limited
+	for i := 0; i < maxSubscriptions; i++ {
+		if err := bridge.subscribe(OSCTarget{Host: "tablet", Port: 1000 + i}, start); err != nil {
+			t.Fatalf("Subscription %d: unexpected error: %v", i, err)
+		}
+	}
+	if err := bridge.subscribe(OSCTarget{Host: "tablet", Port: 9999}, start); err == nil {
+		t.Error("Expected error beyond the subscription limit")
+	}
+}
+
+func TestBridgeSubscriptionExpiryIdle(t *testing.T) {
+	bridge, _, _ := newTestBridge(t, Config{PitchBendFormat: pitchBendSigned, SubscriptionTTL: 50 * time.Millisecond})
+	bridge.dispatcher.Dispatch(osc.NewMessage("/bridge/subscribe", "127.0.0.1", int32(9999)))
+	bridge.targetsMu.Lock()
+	subscribed := len(bridge.targets) == 2
+	bridge.targetsMu.Unlock()
+	if !subscribed {
+		t.Fatal("Expected the subscription to be added")
+	}
+
+	// Nothing is sent, yet the subscription goes once it expires
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		bridge.targetsMu.Lock()
+		targets := len(bridge.targets)
+		bridge.targetsMu.Unlock()
+		if targets == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the subscription to expire, still have %d targets", targets)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestBridgeReplyTo(t *testing.T) {
+	tests := []struct {
+		mode       string
+		fromServer bool
+		want       []bool // Whether each sender gets the reply
+	}{
+		{replyLast, false, []bool{false, true}},
+		{replyAll, false, []bool{true, true}},
+		{replyAll, true, []bool{true, true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s/%t", tt.mode, tt.fromServer), func(t *testing.T) {
+			bridge, backend, _ := newTestBridge(t, Config{
+				PitchBendFormat: pitchBendSigned,
+				ReplyTo:         tt.mode,
+				ReplyFromServer: tt.fromServer,
+			})
+			server, err := net.ListenPacket("udp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("Cannot listen: %v", err)
+			}
+			defer server.Close()
+			go bridge.serveOSCPackets(server)
+
+			// Each sender sends a note; once both are played, both were noted
+			senders := []*net.UDPConn{listenOSC(t), listenOSC(t)}
+			for i, conn := range senders {
+				data, _ := osc.NewMessage("/midi/0/note_on", int32(60+i), int32(100)).MarshalBinary()
+				if _, err := conn.WriteTo(data, server.LocalAddr()); err != nil {
+					t.Fatalf("Cannot send: %v", err)
+				}
+			}
+			played := 0
+			for deadline := time.Now().Add(2 * time.Second); played < 2 && time.Now().Before(deadline); {
+				time.Sleep(time.Millisecond)
+				backend.cycle(64)
+				played += len(backend.port("midi_out").written)
+			}
+			if played != 2 {
+				t.Fatalf("Expected 2 notes played, got %d", played)
+			}
+
+			backend.port("midi_in").send(0, 0x90, 67, 90)
+			backend.cycle(64)
+			for i, conn := range senders {
+				if !tt.want[i] {
+					expectNoOSC(t, conn)
+					continue
+				}
+				buf := make([]byte, 65536)
+				conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+				_, from, err := conn.ReadFromUDP(buf)
+				if err != nil {
+					t.Fatalf("Sender %d: no reply: %v", i, err)
+				}
+				if fromServer := from.String() == server.LocalAddr().String(); fromServer != tt.fromServer {
+					t.Errorf("Sender %d: reply from %s, server is %s", i, from, server.LocalAddr())
+				}
+			}
+		})
+	}
+}
+
+func TestNewBridgeReplyTo(t *testing.T) {
+	for _, cfg := range []Config{
+		{ReplyTo: "everyone"},
+		{ReplyTo: replyAll, OSCTransport: oscTransportTCPSLIP},
+	} {
+		cfg.PitchBendFormat = pitchBendSigned
+		if _, err := newBridge(cfg, newFakeBackend(48000).opener()); err == nil {
+			t.Errorf("Expected error for reply mode %s over %s", cfg.ReplyTo, cfg.OSCTransport)
+		}
+	}
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/GeoffreyPlitt/debuggo"
+	"github.com/hypebeast/go-osc/osc"
+)
+
+var debugTransport = debuggo.Debug("transport")
+
+// OSC transports selectable with --osc-transport. The stream transports
+// differ only in how packets are framed on the TCP connection.
+const (
+	oscTransportUDP     = "udp"
+	oscTransportTCPSLIP = "tcp-slip" // OSC 1.1: SLIP (RFC 1055) frames, END before and after
+	oscTransportTCPLen  = "tcp-len"  // OSC 1.0: int32 big-endian size, then the packet
+)
+
+// maxOSCFrameSize bounds a packet read from a stream, so a corrupt length
+// or a missing SLIP END can't exhaust memory.
+const maxOSCFrameSize = 1 << 20
+
+// SLIP special bytes
+const (
+	slipEnd    = 0xC0
+	slipEsc    = 0xDB
+	slipEscEnd = 0xDC
+	slipEscEsc = 0xDD
+)
+
+func validOSCTransport(transport string) bool {
+	switch transport {
+	case oscTransportUDP, oscTransportTCPSLIP, oscTransportTCPLen:
+		return true
+	}
+	return false
+}
+
+// appendOSCFrame appends packet to dst framed for a stream transport.
+func appendOSCFrame(dst, packet []byte, transport string) []byte {
+	if transport == oscTransportTCPLen {
+		dst = binary.BigEndian.AppendUint32(dst, uint32(len(packet)))
+		return append(dst, packet...)
+	}
+
+	dst = append(dst, slipEnd)
+	for _, c := range packet {
+		switch c {
+		case slipEnd:
+			dst = append(dst, slipEsc, slipEscEnd)
+		case slipEsc:
+			dst = append(dst, slipEsc, slipEscEsc)
+		default:
+			dst = append(dst, c)
+		}
+	}
+	return append(dst, slipEnd)
+}
+
+// readOSCFrame reads the next packet from a stream transport. It returns
+// io.EOF if the stream ends between packets.
+func readOSCFrame(r *bufio.Reader, transport string) ([]byte, error) {
+	if transport == oscTransportTCPLen {
+		var size [4]byte
+		if _, err := io.ReadFull(r, size[:]); err != nil {
+			return nil, err
+		}
+		n := binary.BigEndian.Uint32(size[:])
+		if n > maxOSCFrameSize {
+			return nil, fmt.Errorf("OSC packet of %d bytes exceeds %d", n, maxOSCFrameSize)
+		}
+		packet := make([]byte, n)
+		if _, err := io.ReadFull(r, packet); err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		return packet, nil
+	}
+
+	var packet []byte
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			if len(packet) > 0 {
+				return nil, unexpectedEOF(err)
+			}
+			return nil, err
+		}
+		switch c {
+		case slipEnd:
+			if len(packet) > 0 {
+				return packet, nil
+			}
+			continue // Empty frame between two ENDs
+		case slipEsc:
+			if c, err = r.ReadByte(); err != nil {
+				return nil, unexpectedEOF(err)
+			}
+			switch c {
+			case slipEscEnd:
+				c = slipEnd
+			case slipEscEsc:
+				c = slipEsc
+			default:
+				return nil, fmt.Errorf("invalid SLIP escape 0x%02X", c)
+			}
+		}
+		if len(packet) == maxOSCFrameSize {
+			return nil, fmt.Errorf("OSC packet exceeds %d bytes", maxOSCFrameSize)
+		}
+		packet = append(packet, c)
+	}
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// serveOSCPackets dispatches the OSC packets received on a UDP socket until
+// it is closed. Unlike osc.Server, it sees each packet's sender, which
+// --reply-to needs, and skips malformed packets instead of stopping.
+func (b *Bridge) serveOSCPackets(conn net.PacketConn) error {
+	buf := make([]byte, 65535)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+		packet, err := osc.ParsePacket(string(buf[:n]))
+		if err != nil || packet == nil {
+			debugTransport("Dropping malformed OSC packet from %s: %v", addr, err)
+			continue
+		}
+		if b.replyTo != replyOff {
+			b.notePeer(addr, conn, time.Now())
+		}
+		b.oscServer.Dispatcher.Dispatch(packet)
+	}
+}
+
+// listenOSCStream opens the TCP listener for a stream transport.
+func (b *Bridge) listenOSCStream() (net.Listener, error) {
+	return net.Listen("tcp", b.oscServer.Addr)
+}
+
+// serveOSCStream accepts any number of TCP clients and dispatches the
+// packets each sends, until the listener is closed; the clients are then
+// disconnected.
+func (b *Bridge) serveOSCStream(ln net.Listener) error {
+	var mu sync.Mutex
+	clients := make(map[net.Conn]struct{})
+	defer func() {
+		mu.Lock()
+		defer mu.Unlock()
+		for conn := range clients {
+			conn.Close()
+		}
+	}()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		clients[conn] = struct{}{}
+		mu.Unlock()
+		go func() {
+			b.readOSCStream(conn)
+			mu.Lock()
+			delete(clients, conn)
+			mu.Unlock()
+		}()
+	}
+}
+
+// readOSCStream dispatches packets from one TCP client in stream order.
+func (b *Bridge) readOSCStream(conn net.Conn) {
+	defer conn.Close()
+	debugTransport("OSC client %s connected", conn.RemoteAddr())
+
+	r := bufio.NewReader(conn)
+	for {
+		frame, err := readOSCFrame(r, b.oscTransport)
+		if err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed) {
+				debugTransport("OSC client %s disconnected", conn.RemoteAddr())
+			} else {
+				fmt.Printf("WARNING: Closing OSC connection from %s: %v\n", conn.RemoteAddr(), err)
+			}
+			return
+		}
+		packet, err := osc.ParsePacket(string(frame))
+		if err != nil || packet == nil {
+			debugTransport("Dropping malformed OSC packet from %s: %v", conn.RemoteAddr(), err)
+			continue
+		}
+		b.oscServer.Dispatcher.Dispatch(packet)
+	}
+}
+
+// oscSender delivers outgoing OSC packets; osc.Client is the UDP one.
+type oscSender interface {
+	Send(packet osc.Packet) error
+}
+
+// oscWriteTimeout bounds a write to a TCP target that stopped reading.
+const oscWriteTimeout = 2 * time.Second
+
+// Delays before dialing a TCP target again after a failed dial, doubling
+// while the target stays down.
+const (
+	oscRedialMin = time.Second
+	oscRedialMax = 30 * time.Second
+)
+
+// errOSCTargetDown is returned for packets to a TCP target while waiting to
+// dial it again.
+var errOSCTargetDown = errors.New("OSC target is down")
+
+// newOSCSender returns the sender for a transport.
+func newOSCSender(transport, host string, port int) oscSender {
+	if transport == oscTransportUDP {
+		return osc.NewClient(host, port)
+	}
+	return &oscStreamClient{
+		addr:      net.JoinHostPort(host, fmt.Sprint(port)),
+		transport: transport,
+	}
+}
+
+// oscStreamClient sends OSC packets over a TCP connection. It dials on
+// first use and again after a failed write, so the target may restart;
+// after a failed dial, packets are dropped until the redial delay passes.
+// It is not safe for concurrent use.
+type oscStreamClient struct {
+	addr      string
+	transport string
+	conn      net.Conn
+	buf       []byte
+	redialAt  time.Time     // No dialing before this
+	backoff   time.Duration // Delay after the last failed dial; 0 once connected
+}
+
+func (c *oscStreamClient) Send(packet osc.Packet) error {
+	data, err := packet.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	if c.conn == nil {
+		if wait := time.Until(c.redialAt); wait > 0 {
+			return fmt.Errorf("%w, retrying in %s", errOSCTargetDown, wait.Round(time.Millisecond))
+		}
+		if c.conn, err = net.DialTimeout("tcp", c.addr, time.Second); err != nil {
+			c.backoff = min(max(2*c.backoff, oscRedialMin), oscRedialMax)
+			c.redialAt = time.Now().Add(c.backoff)
+			return err
+		}
+		c.backoff = 0
+		debugTransport("Connected to OSC target %s", c.addr)
+	}
+
+	c.buf = appendOSCFrame(c.buf[:0], data, c.transport)
+	c.conn.SetWriteDeadline(time.Now().Add(oscWriteTimeout))
+	if _, err := c.conn.Write(c.buf); err != nil {
+		c.Close()
+		return err
+	}
+	return nil
+}
+
+func (c *oscStreamClient) Close() error {
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/hypebeast/go-osc/osc"
+)
+
+func TestAppendOSCFrame(t *testing.T) {
+	packet := []byte{'/', 0xC0, 'a', 0xDB, 0}
+
+	tests := []struct {
+		transport string
+		want      []byte
+	}{
+		{oscTransportTCPSLIP, []byte{0xC0, '/', 0xDB, 0xDC, 'a', 0xDB, 0xDD, 0, 0xC0}},
+		{oscTransportTCPLen, []byte{0, 0, 0, 5, '/', 0xC0, 'a', 0xDB, 0}},
+	}
+	for _, tt := range tests {
+		if got := appendOSCFrame(nil, packet, tt.transport); !bytes.Equal(got, tt.want) {
+			t.Errorf("%s: expected % X, got % X", tt.transport, tt.want, got)
+		}
+	}
+}
+
+func TestReadOSCFrame(t *testing.T) {
+	packets := [][]byte{[]byte("/a\x00\x00,\x00\x00\x00"), {0xC0, 0xDB, 0xC0}, {1, 2, 3, 4}}
+
+	for _, transport := range []string{oscTransportTCPSLIP, oscTransportTCPLen} {
+		var stream []byte
+		for _, p := range packets {
+			stream = appendOSCFrame(stream, p, transport)
+		}
+		r := bufio.NewReader(bytes.NewReader(stream))
+		for i, want := range packets {
+			got, err := readOSCFrame(r, transport)
+			if err != nil {
+				t.Fatalf("%s: packet %d: unexpected error: %v", transport, i, err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("%s: packet %d: expected % X, got % X", transport, i, want, got)
+			}
+		}
+		if _, err := readOSCFrame(r, transport); err != io.EOF {
+			t.Errorf("%s: expected EOF after the last packet, got %v", transport, err)
+		}
+	}
+}
+
+func TestReadOSCFrameErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		transport string
+		stream    []byte
+	}{
+		{"truncated SLIP", oscTransportTCPSLIP, []byte{0xC0, '/', 'a'}},
+		{"bad SLIP escape", oscTransportTCPSLIP, []byte{0xC0, 0xDB, 'x', 0xC0}},
+		{"truncated size", oscTransportTCPLen, []byte{0, 0}},
+		{"truncated packet", oscTransportTCPLen, []byte{0, 0, 0, 8, '/', 'a'}},
+		{"oversized packet", oscTransportTCPLen, []byte{0x7F, 0, 0, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := readOSCFrame(bufio.NewReader(bytes.NewReader(tt.stream)), tt.transport)
+			if err == nil || err == io.EOF {
+				t.Errorf("Expected an error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestOSCStreamClientStalledTarget(t *testing.T) {
+	// A target that accepts but never reads
+	target, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Cannot listen: %v", err)
+	}
+	defer target.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		if conn, err := target.Accept(); err == nil {
+			accepted <- conn
+		}
+	}()
+	defer func() {
+		select {
+		case conn := <-accepted:
+			conn.Close()
+		default:
+		}
+	}()
+
+	client := newOSCSender(oscTransportTCPSLIP, "127.0.0.1", target.Addr().(*net.TCPAddr).Port).(*oscStreamClient)
+	defer client.Close()
+
+	// Writes fail once the socket buffers are full instead of blocking
+	msg := osc.NewMessage("/blob", make([]byte, 1<<20))
+	for i := 0; ; i++ {
+		if i == 256 {
+			t.Fatal("Expected a write to time out")
+		}
+		start := time.Now()
+		err := client.Send(msg)
+		if elapsed := time.Since(start); elapsed > oscWriteTimeout+time.Second {
+			t.Fatalf("Send blocked for %s", elapsed)
+		}
+		if err != nil {
+			break
+		}
+	}
+}
+
+func TestOSCStreamClientRedial(t *testing.T) {
+	// Find a port nothing listens on
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Cannot listen: %v", err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+
+	client := newOSCSender(oscTransportTCPLen, "127.0.0.1", port).(*oscStreamClient)
+	defer client.Close()
+	msg := osc.NewMessage("/midi/0/note_on", int32(60), int32(100))
+	if err := client.Send(msg); err == nil || errors.Is(err, errOSCTargetDown) {
+		t.Fatalf("Expected a dial error, got %v", err)
+	}
+
+	// Until the delay passes, messages are dropped without dialing
+	ln, err = net.Listen("tcp", ln.Addr().String())
+	if err != nil {
+		t.Skipf("Cannot listen again on port %d: %v", port, err)
+	}
+	defer ln.Close()
+	if err := client.Send(msg); !errors.Is(err, errOSCTargetDown) {
+		t.Errorf("Expected errOSCTargetDown, got %v", err)
+	}
+	if client.conn != nil {
+		t.Error("Expected no connection during the redial delay")
+	}
+
+	client.redialAt = time.Now()
+	if err := client.Send(msg); err != nil {
+		t.Errorf("Expected the target to be dialed again, got %v", err)
+	}
+	if client.backoff != 0 {
+		t.Errorf("Expected the delay to reset once connected, got %s", client.backoff)
+	}
+}
+
+func TestBridgeOSCStream(t *testing.T) {
+	for _, transport := range []string{oscTransportTCPSLIP, oscTransportTCPLen} {
+		t.Run(transport, func(t *testing.T) {
+			target, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("Cannot listen: %v", err)
+			}
+			defer target.Close()
+
+			backend := newFakeBackend(48000)
+			bridge, err := newBridge(Config{
+				OSCPort:         0,
+				OSCTransport:    transport,
+				ClientName:      "test",
+				PortName:        "midi_out",
+				OSCTargetHost:   "127.0.0.1",
+				OSCTargetPort:   target.Addr().(*net.TCPAddr).Port,
+				PitchBendFormat: pitchBendSigned,
+			}, backend.opener())
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			defer bridge.Cleanup()
+
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("Cannot listen: %v", err)
+			}
+			defer ln.Close()
+			go bridge.serveOSCStream(ln)
+
+			// Two clients at once, each sending one framed message
+			for i, note := range []int32{60, 64} {
+				conn, err := net.Dial("tcp", ln.Addr().String())
+				if err != nil {
+					t.Fatalf("Client %d cannot connect: %v", i, err)
+				}
+				defer conn.Close()
+				data, _ := osc.NewMessage("/midi/0/note_on", note, int32(100)).MarshalBinary()
+				if _, err := conn.Write(appendOSCFrame(nil, data, transport)); err != nil {
+					t.Fatalf("Client %d cannot send: %v", i, err)
+				}
+			}
+
+			out := backend.port("midi_out")
+			notes := make(map[byte]bool)
+			for deadline := time.Now().Add(2 * time.Second); len(notes) < 2 && time.Now().Before(deadline); {
+				backend.cycle(64)
+				for _, event := range out.written {
+					notes[event.Buffer[1]] = true
+				}
+				time.Sleep(time.Millisecond)
+			}
+			if !notes[60] || !notes[64] {
+				t.Errorf("Expected notes 60 and 64 from both clients, got %v", notes)
+			}
+
+			// MIDI input is sent framed to the target
+			backend.port("midi_in").send(0, 0x90, 67, 90)
+			backend.cycle(64)
+			conn, err := target.Accept()
+			if err != nil {
+				t.Fatalf("Bridge did not connect to the target: %v", err)
+			}
+			defer conn.Close()
+			conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+			frame, err := readOSCFrame(bufio.NewReader(conn), transport)
+			if err != nil {
+				t.Fatalf("No OSC message received: %v", err)
+			}
+			packet, err := osc.ParsePacket(string(frame))
+			if err != nil {
+				t.Fatalf("Invalid OSC packet: %v", err)
+			}
+			if msg, ok := packet.(*osc.Message); !ok || msg.Address != "/midi/0/note_on" {
+				t.Errorf("Expected /midi/0/note_on, got %v", packet)
+			}
+		})
+	}
+}
+
+func TestNewBridgeOSCTransport(t *testing.T) {
+	_, err := newBridge(Config{
+		OSCTransport:    "sctp",
+		PitchBendFormat: pitchBendSigned,
+	}, newFakeBackend(48000).opener())
+	if err == nil {
+		t.Error("Expected error for an unknown OSC transport")
+	}
+}
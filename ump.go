@@ -0,0 +1,259 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/hypebeast/go-osc/osc"
+	"github.com/xthexder/go-jack"
+)
+
+// Universal MIDI Packet (UMP) message types carrying channel voice messages
+const (
+	umpMIDI1ChannelVoice = 0x2 // MIDI 1.0 bytes in one word
+	umpMIDI2ChannelVoice = 0x4 // MIDI 2.0 in two words
+)
+
+// MIDI 2.0 channel voice opcodes without a MIDI 1.0 status of the same
+// number. Note Off/On, Poly Pressure, Control Change, Program Change,
+// Channel Pressure and Pitch Bend keep their MIDI 1.0 status nibble.
+const (
+	umpRegisteredPerNote    = 0x0
+	umpAssignablePerNote    = 0x1
+	umpRegisteredController = 0x2 // RPN
+	umpAssignableController = 0x3 // NRPN
+	umpRelativeRegistered   = 0x4
+	umpRelativeAssignable   = 0x5
+	umpPerNotePitchBend     = 0x6
+	umpPerNoteManagement    = 0xF
+)
+
+// umpBankValid is the Program Change option flag for a valid bank.
+const umpBankValid = 0x01
+
+// umpPacketWords returns the size of a UMP in 32-bit words from its message
+// type.
+func umpPacketWords(messageType uint8) int {
+	switch messageType {
+	case 0x0, 0x1, 0x2, 0x6, 0x7:
+		return 1
+	case 0x3, 0x4, 0x8, 0x9, 0xA:
+		return 2
+	case 0xB, 0xC:
+		return 3
+	default:
+		return 4
+	}
+}
+
+// scaleUp widens a value with the MIDI 2.0 min-center-max algorithm: 0,
+// the center and the maximum map to 0, the center and the maximum of the
+// wider range, and values above the center repeat their low bits to fill
+// the new ones, so the steps stay evenly spaced.
+func scaleUp(value uint32, srcBits, dstBits uint) uint32 {
+	scaleBits := dstBits - srcBits
+	shifted := value << scaleBits
+	if value <= 1<<(srcBits-1) {
+		return shifted
+	}
+
+	repeatBits := srcBits - 1
+	repeat := value & (1<<repeatBits - 1)
+	if scaleBits > repeatBits {
+		repeat <<= scaleBits - repeatBits
+	} else {
+		repeat >>= repeatBits - scaleBits
+	}
+	for repeat != 0 {
+		shifted |= repeat
+		repeat >>= repeatBits
+	}
+	return shifted
+}
+
+// scaleDown narrows a value by dropping its low bits, the inverse of
+// scaleUp.
+func scaleDown(value uint32, srcBits, dstBits uint) uint32 {
+	return value >> (srcBits - dstBits)
+}
+
+// umpToMIDI1 translates one channel voice UMP to MIDI 1.0 bytes, following
+// the specification's translation rules. The result may hold several
+// messages, e.g. the controller sequence of an RPN. It is nil for messages
+// MIDI 1.0 has no equivalent for (per-note controllers, per-note pitch bend
+// and management, relative controllers), which are dropped.
+func umpToMIDI1(words []uint32) ([]byte, error) {
+	messageType := uint8(words[0] >> 28)
+	if len(words) < umpPacketWords(messageType) {
+		return nil, fmt.Errorf("incomplete UMP of type %X: %d words", messageType, len(words))
+	}
+	status := uint8(words[0]>>16) & 0xF0
+	channel := uint8(words[0]>>16) & 0x0F
+	b1, b2 := uint8(words[0]>>8)&0x7F, uint8(words[0])&0x7F
+
+	switch messageType {
+	case umpMIDI1ChannelVoice:
+		if status < 0x80 || status >= 0xF0 { // Channel voice only; system messages are type 1
+			return nil, fmt.Errorf("invalid MIDI 1.0 channel voice status %02X in UMP", status)
+		}
+		return []byte{status | channel, b1, b2}[:channelMessageLength(status)], nil
+	case umpMIDI2ChannelVoice:
+	default:
+		return nil, fmt.Errorf("UMP message type %X is not a channel voice message", messageType)
+	}
+
+	data := words[1]
+	opcode := status >> 4
+	cc := func(out []byte, controller, value uint8) []byte {
+		return append(out, 0xB0|channel, controller, value&0x7F)
+	}
+
+	switch opcode {
+	case 0x8: // Note Off
+		return []byte{0x80 | channel, b1, uint8(scaleDown(data>>16, 16, 7))}, nil
+	case 0x9: // Note On; velocity 0 is valid in MIDI 2.0 but a Note Off in MIDI 1.0
+		velocity := uint8(scaleDown(data>>16, 16, 7))
+		if velocity == 0 {
+			velocity = 1
+		}
+		return []byte{0x90 | channel, b1, velocity}, nil
+	case 0xA: // Poly Pressure
+		return []byte{0xA0 | channel, b1, uint8(scaleDown(data, 32, 7))}, nil
+	case 0xB: // Control Change
+		return []byte{0xB0 | channel, b1, uint8(scaleDown(data, 32, 7))}, nil
+	case 0xC: // Program Change, after the bank if valid
+		var out []byte
+		if uint8(words[0])&umpBankValid != 0 {
+			out = cc(out, 0, uint8(data>>8))
+			out = cc(out, 32, uint8(data))
+		}
+		return append(out, 0xC0|channel, uint8(data>>24)&0x7F), nil
+	case 0xD: // Channel Pressure
+		return []byte{0xD0 | channel, uint8(scaleDown(data, 32, 7))}, nil
+	case 0xE: // Pitch Bend
+		value := scaleDown(data, 32, 14)
+		return []byte{0xE0 | channel, uint8(value) & 0x7F, uint8(value >> 7)}, nil
+	case umpRegisteredController, umpAssignableController:
+		msbCC, lsbCC := uint8(ccRPNMSB), uint8(ccRPNLSB)
+		if opcode == umpAssignableController {
+			msbCC, lsbCC = ccNRPNMSB, ccNRPNLSB
+		}
+		value := scaleDown(data, 32, 14)
+		out := cc(nil, msbCC, b1)
+		out = cc(out, lsbCC, b2)
+		out = cc(out, ccDataEntryMSB, uint8(value>>7))
+		return cc(out, ccDataEntryLSB, uint8(value)), nil
+	case umpRegisteredPerNote, umpAssignablePerNote, umpRelativeRegistered, umpRelativeAssignable,
+		umpPerNotePitchBend, umpPerNoteManagement:
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unknown MIDI 2.0 channel voice opcode %X", opcode)
+}
+
+// umpMIDI2 builds a MIDI 2.0 channel voice message in group 0.
+func umpMIDI2(opcode, channel, b1, b2 uint8, data uint32) []uint32 {
+	return []uint32{
+		umpMIDI2ChannelVoice<<28 | uint32(opcode)<<20 | uint32(channel&0x0F)<<16 | uint32(b1)<<8 | uint32(b2),
+		data,
+	}
+}
+
+// midi1ToUMP translates a MIDI 1.0 channel message other than Control
+// Change to MIDI 2.0, scaling values up. A Program Change carries the bank
+// last selected on the channel, if any.
+func midi1ToUMP(data []byte, c *ccChannel) []uint32 {
+	status, channel := data[0]&0xF0, data[0]&0x0F
+	switch status {
+	case 0x80:
+		return umpMIDI2(0x8, channel, data[1]&0x7F, 0, scaleUp(uint32(data[2]&0x7F), 7, 16)<<16)
+	case 0x90:
+		opcode := uint8(0x9)
+		if data[2]&0x7F == 0 {
+			opcode = 0x8
+		}
+		return umpMIDI2(opcode, channel, data[1]&0x7F, 0, scaleUp(uint32(data[2]&0x7F), 7, 16)<<16)
+	case 0xA0:
+		return umpMIDI2(0xA, channel, data[1]&0x7F, 0, scaleUp(uint32(data[2]&0x7F), 7, 32))
+	case 0xC0:
+		var flags uint8
+		program := uint32(data[1]&0x7F) << 24
+		if c.known&1 != 0 {
+			flags = umpBankValid
+			program |= uint32(c.msb[0])<<8 | uint32(c.bankLSB)
+		}
+		return umpMIDI2(0xC, channel, 0, flags, program)
+	case 0xD0:
+		return umpMIDI2(0xD, channel, 0, 0, scaleUp(uint32(data[1]&0x7F), 7, 32))
+	case 0xE0:
+		return umpMIDI2(0xE, channel, 0, 0, scaleUp(uint32(data[2]&0x7F)<<7|uint32(data[1]&0x7F), 14, 32))
+	}
+	return nil
+}
+
+// controllerUMP translates a reassembled controller value to MIDI 2.0:
+// 14-bit values are scaled from 14 bits and RPN and NRPN become Registered
+// and Assignable Controller messages. Bank select is carried by Program
+// Change instead, so controllers 0 and 32 give nil.
+func controllerUMP(v controllerMessage) []uint32 {
+	switch v.kind {
+	case "cc":
+		if v.number == 0 || v.number == 32 {
+			return nil
+		}
+		return umpMIDI2(0xB, v.channel, uint8(v.number), 0, scaleUp(uint32(v.value), 7, 32))
+	case "cc14":
+		if v.number == 0 {
+			return nil
+		}
+		return umpMIDI2(0xB, v.channel, uint8(v.number), 0, scaleUp(uint32(v.value), 14, 32))
+	case "rpn":
+		return umpMIDI2(umpRegisteredController, v.channel, uint8(v.number>>7), uint8(v.number&0x7F), scaleUp(uint32(v.value), 14, 32))
+	case "nrpn":
+		return umpMIDI2(umpAssignableController, v.channel, uint8(v.number>>7), uint8(v.number&0x7F), scaleUp(uint32(v.value), 14, 32))
+	}
+	return nil
+}
+
+// umpMessage wraps UMP words in an /ump message, one int32 per word.
+func umpMessage(words []uint32) *osc.Message {
+	msg := osc.NewMessage("/ump")
+	for _, w := range words {
+		msg.Append(int32(w))
+	}
+	return msg
+}
+
+// handleUMP translates the channel voice UMPs in a /ump message to MIDI
+// 1.0: args are the packets' 32-bit words, as int32.
+func (b *Bridge) handleUMP(msg *osc.Message) error {
+	if len(msg.Arguments) == 0 {
+		return errors.New("ump requires at least 1 argument: UMP words")
+	}
+	words := make([]uint32, len(msg.Arguments))
+	for i, arg := range msg.Arguments {
+		w, ok := toInt(arg)
+		if !ok {
+			return fmt.Errorf("ump word %d must be an integer, got %v", i, arg)
+		}
+		words[i] = uint32(w)
+	}
+
+	for len(words) > 0 {
+		n := min(umpPacketWords(uint8(words[0]>>28)), len(words))
+		data, err := umpToMIDI1(words[:n])
+		if err != nil {
+			return err
+		}
+		if data == nil {
+			debugHandlers("No MIDI 1.0 translation for UMP %08X, dropped", words[0])
+		} else {
+			event := &MidiEvent{midiData: &jack.MidiData{Buffer: data}}
+			if err := b.queueMidiEvent(event); err != nil {
+				return err
+			}
+			fmt.Printf("UMP %08X -> % X\n", words[0], data)
+		}
+		words = words[n:]
+	}
+	return nil
+}
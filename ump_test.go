@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/hypebeast/go-osc/osc"
+)
+
+// Expected values follow the MIDI 2.0 Bit Scaling and Resolution
+// specification's min-center-max algorithm.
+func TestScaleUp(t *testing.T) {
+	tests := []struct {
+		value            uint32
+		srcBits, dstBits uint
+		want             uint32
+	}{
+		// 7 → 16 bits (velocity)
+		{0, 7, 16, 0x0000},
+		{1, 7, 16, 0x0200},
+		{63, 7, 16, 0x7E00},
+		{64, 7, 16, 0x8000},
+		{65, 7, 16, 0x8208},
+		{127, 7, 16, 0xFFFF},
+		// 7 → 32 bits (controllers, pressure)
+		{0, 7, 32, 0x00000000},
+		{1, 7, 32, 0x02000000},
+		{64, 7, 32, 0x80000000},
+		{65, 7, 32, 0x82082082},
+		{127, 7, 32, 0xFFFFFFFF},
+		// 14 → 32 bits (pitch bend, RPN data)
+		{0x0000, 14, 32, 0x00000000},
+		{0x0001, 14, 32, 0x00040000},
+		{0x2000, 14, 32, 0x80000000},
+		{0x2001, 14, 32, 0x80040020},
+		{0x3FFF, 14, 32, 0xFFFFFFFF},
+	}
+
+	for _, tt := range tests {
+		if got := scaleUp(tt.value, tt.srcBits, tt.dstBits); got != tt.want {
+			t.Errorf("scaleUp(%d, %d, %d) = %#x, expected %#x", tt.value, tt.srcBits, tt.dstBits, got, tt.want)
+		}
+	}
+}
+
+func TestScaleDown(t *testing.T) {
+	tests := []struct {
+		value            uint32
+		srcBits, dstBits uint
+		want             uint32
+	}{
+		{0xFFFF, 16, 7, 127},
+		{0x8000, 16, 7, 64},
+		{0x01FF, 16, 7, 0},
+		{0xFFFFFFFF, 32, 7, 127},
+		{0x80000000, 32, 7, 64},
+		{0x80000000, 32, 14, 0x2000},
+		{0xFFFFFFFF, 32, 14, 0x3FFF},
+	}
+
+	for _, tt := range tests {
+		if got := scaleDown(tt.value, tt.srcBits, tt.dstBits); got != tt.want {
+			t.Errorf("scaleDown(%#x, %d, %d) = %d, expected %d", tt.value, tt.srcBits, tt.dstBits, got, tt.want)
+		}
+	}
+
+	// Scaling up and back down is lossless
+	for _, bits := range []struct{ src, dst uint }{{7, 16}, {7, 32}, {14, 32}} {
+		for v := uint32(0); v < 1<<bits.src; v++ {
+			if got := scaleDown(scaleUp(v, bits.src, bits.dst), bits.dst, bits.src); got != v {
+				t.Fatalf("%d bits → %d → %d bits: %d became %d", bits.src, bits.dst, bits.src, v, got)
+			}
+		}
+	}
+}
+
+func TestUMPToMIDI1(t *testing.T) {
+	tests := []struct {
+		name    string
+		words   []uint32
+		want    []byte
+		wantErr bool
+	}{
+		{"note on", []uint32{0x40913C00, 0xFFFF0000}, []byte{0x91, 60, 127}, false},
+		{"note on velocity too small for 7 bits", []uint32{0x40903C00, 0x01000000}, []byte{0x90, 60, 1}, false},
+		{"note off", []uint32{0x40803C00, 0x80000000}, []byte{0x80, 60, 64}, false},
+		{"poly pressure", []uint32{0x40A03C00, 0x80000000}, []byte{0xA0, 60, 64}, false},
+		{"control change", []uint32{0x40B20700, 0xFFFFFFFF}, []byte{0xB2, 7, 127}, false},
+		{"program change", []uint32{0x40C00000, 0x05000000}, []byte{0xC0, 5}, false},
+		{"program change with bank", []uint32{0x40C00001, 0x05000102}, []byte{0xB0, 0, 1, 0xB0, 32, 2, 0xC0, 5}, false},
+		{"channel pressure", []uint32{0x40D30000, 0x02000000}, []byte{0xD3, 1}, false},
+		{"pitch bend center", []uint32{0x40E00000, 0x80000000}, []byte{0xE0, 0x00, 0x40}, false},
+		{"pitch bend max", []uint32{0x40E00000, 0xFFFFFFFF}, []byte{0xE0, 0x7F, 0x7F}, false},
+		{"registered controller", []uint32{0x40200000, 0x80000000}, []byte{0xB0, 101, 0, 0xB0, 100, 0, 0xB0, 6, 64, 0xB0, 38, 0}, false},
+		{"assignable controller", []uint32{0x40310208, 0xFFFFFFFF}, []byte{0xB1, 99, 2, 0xB1, 98, 8, 0xB1, 6, 127, 0xB1, 38, 127}, false},
+		{"per-note controller is dropped", []uint32{0x40003C4A, 0x80000000}, nil, false},
+		{"per-note pitch bend is dropped", []uint32{0x40603C00, 0x80000000}, nil, false},
+		{"relative controller is dropped", []uint32{0x40400007, 0x00000001}, nil, false},
+		{"MIDI 1.0 channel voice", []uint32{0x20923C64}, []byte{0x92, 60, 100}, false},
+		{"MIDI 1.0 program change", []uint32{0x20C10500}, []byte{0xC1, 5}, false},
+		{"MIDI 1.0 system status", []uint32{0x20F30500}, nil, true},
+		{"MIDI 1.0 data byte status", []uint32{0x20403C64}, nil, true},
+		{"incomplete", []uint32{0x40903C00}, nil, true},
+		{"not channel voice", []uint32{0x10F80000}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := umpToMIDI1(tt.words)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("umpToMIDI1() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("Expected % X, got % X", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestMIDI1ToUMP(t *testing.T) {
+	var bank ccChannel
+	bank.msb[0], bank.known, bank.bankLSB = 1, 1, 2
+
+	tests := []struct {
+		name string
+		data []byte
+		bank ccChannel
+		want []uint32
+	}{
+		{"note on", []byte{0x91, 60, 127}, ccChannel{}, []uint32{0x40913C00, 0xFFFF0000}},
+		{"note on velocity 0", []byte{0x90, 60, 0}, ccChannel{}, []uint32{0x40803C00, 0x00000000}},
+		{"note off", []byte{0x80, 60, 64}, ccChannel{}, []uint32{0x40803C00, 0x80000000}},
+		{"poly pressure", []byte{0xA0, 60, 127}, ccChannel{}, []uint32{0x40A03C00, 0xFFFFFFFF}},
+		{"program change", []byte{0xC0, 5}, ccChannel{}, []uint32{0x40C00000, 0x05000000}},
+		{"program change with bank", []byte{0xC0, 5}, bank, []uint32{0x40C00001, 0x05000102}},
+		{"channel pressure", []byte{0xD3, 64}, ccChannel{}, []uint32{0x40D30000, 0x80000000}},
+		{"pitch bend", []byte{0xE0, 0x00, 0x40}, ccChannel{}, []uint32{0x40E00000, 0x80000000}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := midi1ToUMP(tt.data, &tt.bank); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected %08X, got %08X", tt.want, got)
+			}
+		})
+	}
+
+	controllers := []struct {
+		value controllerMessage
+		want  []uint32
+	}{
+		{controllerMessage{"cc", 0, 7, 64}, []uint32{0x40B00700, 0x80000000}},
+		{controllerMessage{"cc14", 1, 1, 0x3FFF}, []uint32{0x40B10100, 0xFFFFFFFF}},
+		{controllerMessage{"rpn", 0, 0, 0x2000}, []uint32{0x40200000, 0x80000000}},
+		{controllerMessage{"nrpn", 2, 1<<7 | 8, 0}, []uint32{0x40320108, 0x00000000}},
+		{controllerMessage{"cc", 0, 0, 1}, nil}, // Bank select goes with Program Change
+		{controllerMessage{"cc14", 0, 0, 1<<7 | 2}, nil},
+	}
+	for _, tt := range controllers {
+		if got := controllerUMP(tt.value); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("controllerUMP(%v): expected %08X, got %08X", tt.value, tt.want, got)
+		}
+	}
+}
+
+func TestBridgeUMPToMIDI(t *testing.T) {
+	bridge, backend, _ := newTestBridge(t, Config{PitchBendFormat: pitchBendSigned})
+	out := backend.port("midi_out")
+
+	// Words are int32 on the wire; 0xFFFF0000 arrives negative
+	bridge.dispatcher.Dispatch(osc.NewMessage("/ump", int32(0x40913C00), int32(-0x10000), int32(0x20B20740)))
+	backend.cycle(64)
+
+	want := [][]byte{{0x91, 60, 127}, {0xB2, 7, 64}}
+	if len(out.written) != len(want) {
+		t.Fatalf("Expected %d MIDI events, got %v", len(want), out.written)
+	}
+	for i, event := range out.written {
+		if !bytes.Equal(event.Buffer, want[i]) {
+			t.Errorf("Event %d: expected % X, got % X", i, want[i], event.Buffer)
+		}
+	}
+}
+
+func TestBridgeMIDI2Output(t *testing.T) {
+	_, backend, conn := newTestBridge(t, Config{PitchBendFormat: pitchBendSigned, MIDI2: true})
+	in := backend.port("midi_in")
+
+	in.send(0, 0x90, 60, 127)
+	in.send(1, 0xB0, 0, 1) // Bank select
+	in.send(2, 0xB0, 32, 2)
+	in.send(3, 0xC0, 5)
+	in.send(4, 0xB0, 7, 64)
+	in.send(5, 0xF8) // System messages stay as they are
+	backend.cycle(64)
+
+	want := []struct {
+		address string
+		args    []interface{}
+	}{
+		{"/ump", []interface{}{int32(0x40903C00), int32(-0x10000)}},
+		{"/ump", []interface{}{int32(0x40C00001), int32(0x05000102)}},
+		{"/midi/clock", nil},
+		{"/ump", []interface{}{int32(0x40B00700), int32(-0x80000000)}},
+	}
+	for _, w := range want {
+		msg := receiveOSC(t, conn)
+		if msg.Address != w.address || (len(w.args) > 0 && !reflect.DeepEqual(msg.Arguments, w.args)) {
+			t.Errorf("Expected %s %v, got %s %v", w.address, w.args, msg.Address, msg.Arguments)
+		}
+	}
+}
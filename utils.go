@@ -1,5 +1,10 @@
 package main
 
+import (
+	"fmt"
+	"math"
+)
+
 func toUint8(v interface{}) uint8 {
 	switch val := v.(type) {
 	case int:
@@ -38,3 +43,133 @@ func toUint8(v interface{}) uint8 {
 		return 0
 	}
 }
+
+// toInt converts a numeric OSC argument to an int, truncating floats.
+// The second return value is false for non-numeric arguments.
+func toInt(v interface{}) (int, bool) {
+	switch val := v.(type) {
+	case int:
+		return val, true
+	case int32:
+		return int(val), true
+	case int64:
+		return int(val), true
+	case uint:
+		return int(val), true
+	case float32:
+		return int(val), true
+	case float64:
+		return int(val), true
+	default:
+		return 0, false
+	}
+}
+
+// toFloat64 converts a numeric OSC argument to a float64. The second
+// return value is false for non-numeric arguments.
+func toFloat64(v interface{}) (float64, bool) {
+	switch val := v.(type) {
+	case float32:
+		return float64(val), true
+	case float64:
+		return val, true
+	default:
+		i, ok := toInt(v)
+		return float64(i), ok
+	}
+}
+
+// Pitch bend formats for the OSC side of /midi/{channel}/pitch_bend.
+// Integer arguments are read, and outgoing values written, in the
+// configured format; float arguments are always accepted as -1.0..1.0.
+const (
+	pitchBendSigned   = "signed"   // -8192..8191, 0 is center
+	pitchBendUnsigned = "unsigned" // 0..16383, 8192 is center
+	pitchBendFloat    = "float"    // -1.0..1.0, 0.0 is center
+)
+
+const pitchBendCenter = 8192
+
+func validPitchBendFormat(format string) bool {
+	switch format {
+	case "", pitchBendSigned, pitchBendUnsigned, pitchBendFloat:
+		return true
+	default:
+		return false
+	}
+}
+
+// pitchBendValue converts an OSC pitch bend argument to the unsigned 14-bit
+// value carried by a MIDI pitch bend message.
+func pitchBendValue(v interface{}, format string) (uint16, error) {
+	switch val := v.(type) {
+	case float32:
+		return normalizedPitchBend(float64(val))
+	case float64:
+		return normalizedPitchBend(val)
+	}
+
+	i, ok := toInt(v)
+	if !ok {
+		return 0, fmt.Errorf("unsupported pitch bend argument type %T", v)
+	}
+	if format == pitchBendUnsigned {
+		if i < 0 || i > 16383 {
+			return 0, fmt.Errorf("pitch bend %d out of range 0..16383", i)
+		}
+		return uint16(i), nil
+	}
+	if i < -8192 || i > 8191 {
+		return 0, fmt.Errorf("pitch bend %d out of range -8192..8191", i)
+	}
+	return uint16(i + pitchBendCenter), nil
+}
+
+// normalizedPitchBend maps -1.0..1.0 onto 0..16383 so that both extremes
+// and the center are exactly representable.
+func normalizedPitchBend(f float64) (uint16, error) {
+	if f < -1 || f > 1 || math.IsNaN(f) {
+		return 0, fmt.Errorf("pitch bend %g out of range -1.0..1.0", f)
+	}
+	if f >= 0 {
+		return uint16(pitchBendCenter + math.Round(f*8191)), nil
+	}
+	return uint16(pitchBendCenter + math.Round(f*8192)), nil
+}
+
+// pitchBendArgument converts a 14-bit MIDI pitch bend value to the OSC
+// argument for the given format; the inverse of pitchBendValue.
+func pitchBendArgument(value uint16, format string) interface{} {
+	switch format {
+	case pitchBendUnsigned:
+		return int32(value)
+	case pitchBendFloat:
+		offset := float32(int(value) - pitchBendCenter)
+		if offset >= 0 {
+			return offset / 8191
+		}
+		return offset / 8192
+	default:
+		return int32(int(value) - pitchBendCenter)
+	}
+}
+
+// validateSysEx checks that data is a single complete System Exclusive
+// message: F0, any number of 7-bit data bytes, then F7.
+func validateSysEx(data []byte) error {
+	if len(data) < 2 {
+		return fmt.Errorf("sysex too short (%d bytes)", len(data))
+	}
+	if data[0] != 0xF0 {
+		return fmt.Errorf("sysex must start with F0, got %02X", data[0])
+	}
+	if data[len(data)-1] != 0xF7 {
+		return fmt.Errorf("sysex must end with F7, got %02X", data[len(data)-1])
+	}
+	for i, d := range data[1 : len(data)-1] {
+		if d >= 0x80 {
+			return fmt.Errorf("sysex byte %d is a status byte (%02X)", i+1, d)
+		}
+	}
+	return nil
+}
@@ -28,3 +28,106 @@ func TestToUint8(t *testing.T) {
 		}
 	}
 }
+
+func TestToInt(t *testing.T) {
+	tests := []struct {
+		input    interface{}
+		expected int
+		ok       bool
+	}{
+		{int32(-8192), -8192, true},
+		{int64(16383), 16383, true},
+		{float32(12.9), 12, true},
+		{uint(7), 7, true},
+		{"invalid", 0, false},
+		{nil, 0, false},
+	}
+
+	for _, tt := range tests {
+		result, ok := toInt(tt.input)
+		if result != tt.expected || ok != tt.ok {
+			t.Errorf("toInt(%v) = %d, %t, expected %d, %t", tt.input, result, ok, tt.expected, tt.ok)
+		}
+	}
+}
+
+func TestPitchBendValue(t *testing.T) {
+	tests := []struct {
+		input       interface{}
+		format      string
+		expected    uint16
+		shouldError bool
+	}{
+		{int32(0), pitchBendSigned, 8192, false},
+		{int32(-8192), pitchBendSigned, 0, false},
+		{int32(8191), pitchBendSigned, 16383, false},
+		{int32(0), "", 8192, false}, // Default format is signed
+		{int32(8192), pitchBendSigned, 0, true},
+		{int32(-8193), pitchBendSigned, 0, true},
+		{int32(0), pitchBendUnsigned, 0, false},
+		{int32(16383), pitchBendUnsigned, 16383, false},
+		{int32(16384), pitchBendUnsigned, 0, true},
+		{int32(-1), pitchBendUnsigned, 0, true},
+		{float32(0), pitchBendSigned, 8192, false},
+		{float32(-1), pitchBendUnsigned, 0, false},
+		{float64(1), pitchBendFloat, 16383, false},
+		{float32(0.5), pitchBendFloat, 12288, false},
+		{float32(1.5), pitchBendFloat, 0, true},
+		{"up", pitchBendSigned, 0, true},
+	}
+
+	for _, tt := range tests {
+		result, err := pitchBendValue(tt.input, tt.format)
+		if (err != nil) != tt.shouldError {
+			t.Errorf("pitchBendValue(%v, %q) error = %v, shouldError %v", tt.input, tt.format, err, tt.shouldError)
+			continue
+		}
+		if err == nil && result != tt.expected {
+			t.Errorf("pitchBendValue(%v, %q) = %d, expected %d", tt.input, tt.format, result, tt.expected)
+		}
+	}
+}
+
+func TestPitchBendArgumentRoundTrip(t *testing.T) {
+	inputs := map[string][]interface{}{
+		pitchBendSigned:   {int32(-8192), int32(-1), int32(0), int32(4000), int32(8191)},
+		pitchBendUnsigned: {int32(0), int32(8192), int32(10000), int32(16383)},
+		pitchBendFloat:    {float32(-1), float32(-0.5), float32(-0.25), float32(0), float32(1)},
+	}
+
+	for format, values := range inputs {
+		for _, v := range values {
+			value, err := pitchBendValue(v, format)
+			if err != nil {
+				t.Errorf("pitchBendValue(%v, %q) unexpected error: %v", v, format, err)
+				continue
+			}
+			if result := pitchBendArgument(value, format); result != v {
+				t.Errorf("%s round trip of %v returned %v (%T)", format, v, result, result)
+			}
+		}
+	}
+}
+
+func TestValidateSysEx(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        []byte
+		shouldError bool
+	}{
+		{"identity request", []byte{0xF0, 0x7E, 0x7F, 0x06, 0x01, 0xF7}, false},
+		{"empty body", []byte{0xF0, 0xF7}, false},
+		{"too short", []byte{0xF0}, true},
+		{"missing F0", []byte{0x7E, 0x7F, 0xF7}, true},
+		{"missing F7", []byte{0xF0, 0x7E, 0x7F}, true},
+		{"embedded status byte", []byte{0xF0, 0x41, 0x90, 0xF7}, true},
+		{"nil", nil, true},
+	}
+
+	for _, tt := range tests {
+		err := validateSysEx(tt.data)
+		if (err != nil) != tt.shouldError {
+			t.Errorf("validateSysEx(%s) error = %v, shouldError %v", tt.name, err, tt.shouldError)
+		}
+	}
+}
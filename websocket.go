@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/GeoffreyPlitt/debuggo"
+	"github.com/gorilla/websocket"
+	"github.com/hypebeast/go-osc/osc"
+)
+
+var debugWebSocket = debuggo.Debug("websocket")
+
+// wsWriteTimeout bounds a write to a stalled socket.
+const wsWriteTimeout = 2 * time.Second
+
+// wsAnyOrigin in --ws-origin lets pages from any origin connect.
+const wsAnyOrigin = "*"
+
+// parseWSOrigins parses the comma-separated --ws-origin list into the set
+// of allowed origins, normalized as scheme://host[:port].
+func parseWSOrigins(list string) (map[string]bool, error) {
+	origins := make(map[string]bool)
+	for _, origin := range strings.Split(list, ",") {
+		origin = strings.TrimSpace(origin)
+		switch {
+		case origin == "":
+			continue
+		case origin == wsAnyOrigin:
+			origins[wsAnyOrigin] = true
+			continue
+		}
+		u, err := url.Parse(origin)
+		if err != nil || u.Scheme == "" || u.Host == "" || strings.Trim(u.Path, "/") != "" {
+			return nil, fmt.Errorf("invalid WebSocket origin %q (expected scheme://host[:port] or *)", origin)
+		}
+		origins[strings.ToLower(u.Scheme+"://"+u.Host)] = true
+	}
+	return origins, nil
+}
+
+// checkWSOrigin accepts a WebSocket handshake from a page served by the
+// bridge's own host, from an origin allowed by --ws-origin, or from a
+// client that sends no Origin, which browsers always do. Any other web page
+// open in the browser would otherwise be able to play MIDI and redirect
+// the output with /bridge/subscribe.
+func (b *Bridge) checkWSOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || b.wsOrigins[wsAnyOrigin] || b.wsOrigins[strings.ToLower(origin)] {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	fmt.Printf("WARNING: Refused WebSocket from origin %s (see --ws-origin)\n", origin)
+	return false
+}
+
+// wsHub tracks the connected WebSocket clients, which receive every
+// MIDI→OSC message.
+type wsHub struct {
+	mu      sync.Mutex
+	clients map[*wsClient]bool
+	closed  bool
+}
+
+// wsClient is one connected socket. Messages to it are queued on send and
+// written by its own goroutine, so a slow browser can't hold up the others.
+type wsClient struct {
+	conn *websocket.Conn
+	json bool // Receives JSON text frames instead of binary OSC
+	send chan []byte
+}
+
+func newWSHub() *wsHub {
+	return &wsHub{clients: make(map[*wsClient]bool)}
+}
+
+func (h *wsHub) add(c *wsClient) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return false
+	}
+	h.clients[c] = true
+	return true
+}
+
+func (h *wsHub) remove(c *wsClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.clients[c] {
+		delete(h.clients, c)
+		close(c.send)
+	}
+}
+
+// broadcast queues msg for every client, dropping it for clients whose
+// queue is full.
+func (h *wsHub) broadcast(msg *osc.Message) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var binary, text []byte
+	for c := range h.clients {
+		var err error
+		data := binary
+		if c.json {
+			data = text
+		}
+		if data == nil {
+			if c.json {
+				data, err = encodeJSONMessage(msg)
+				text = data
+			} else {
+				data, err = msg.MarshalBinary()
+				binary = data
+			}
+			if err != nil {
+				debugWebSocket("Cannot encode %s: %v", msg.Address, err)
+				return
+			}
+		}
+
+		select {
+		case c.send <- data:
+		default:
+			debugWebSocket("Client %s is too slow, dropping %s", c.conn.RemoteAddr(), msg.Address)
+		}
+	}
+}
+
+// close disconnects every client; later connections are refused.
+func (h *wsHub) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for c := range h.clients {
+		delete(h.clients, c)
+		close(c.send)
+		c.conn.Close()
+	}
+}
+
+// serveWebSocket serves the WebSocket endpoint on ln until it is closed.
+func (b *Bridge) serveWebSocket(ln net.Listener) error {
+	err := b.wsServer.Serve(ln)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// handleWebSocket upgrades a request to a WebSocket and dispatches the OSC
+// packets it sends: binary frames carry OSC packets, text frames the JSON
+// encoding. Clients connecting with ?format=json receive JSON.
+func (b *Bridge) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	upgrader := websocket.Upgrader{CheckOrigin: b.checkWSOrigin}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		debugWebSocket("Upgrade failed: %v", err)
+		return
+	}
+	defer conn.Close()
+	conn.SetReadLimit(maxOSCFrameSize)
+
+	client := &wsClient{
+		conn: conn,
+		json: r.URL.Query().Get("format") == "json",
+		send: make(chan []byte, 64),
+	}
+	if !b.ws.add(client) {
+		return
+	}
+	defer b.ws.remove(client)
+	debugWebSocket("Client %s connected", conn.RemoteAddr())
+	go client.writeLoop()
+
+	for {
+		kind, data, err := conn.ReadMessage()
+		if err != nil {
+			debugWebSocket("Client %s disconnected: %v", conn.RemoteAddr(), err)
+			return
+		}
+
+		var packet osc.Packet
+		switch kind {
+		case websocket.BinaryMessage:
+			packet, err = osc.ParsePacket(string(data))
+		case websocket.TextMessage:
+			packet, err = decodeJSONMessage(data)
+		default:
+			continue
+		}
+		if err != nil || packet == nil {
+			debugWebSocket("Dropping malformed message from %s: %v", conn.RemoteAddr(), err)
+			continue
+		}
+		b.oscServer.Dispatcher.Dispatch(packet)
+	}
+}
+
+// writeLoop writes queued messages until the client is removed.
+func (c *wsClient) writeLoop() {
+	kind := websocket.BinaryMessage
+	if c.json {
+		kind = websocket.TextMessage
+	}
+	for data := range c.send {
+		c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+		if err := c.conn.WriteMessage(kind, data); err != nil {
+			debugWebSocket("Write to %s failed: %v", c.conn.RemoteAddr(), err)
+			c.conn.Close() // Ends the read loop, which removes the client
+			break
+		}
+	}
+	for range c.send {
+		// Drain until removed
+	}
+}
+
+// jsonMessage is the JSON encoding of an OSC message:
+//
+//	{"address": "/midi/0/note_on", "args": [60, 100]}
+//
+// Integral numbers are int32 arguments and others float32; arrays of bytes
+// are blobs.
+type jsonMessage struct {
+	Address string        `json:"address"`
+	Args    []interface{} `json:"args"`
+}
+
+func encodeJSONMessage(msg *osc.Message) ([]byte, error) {
+	args := make([]interface{}, len(msg.Arguments))
+	for i, arg := range msg.Arguments {
+		if blob, ok := arg.([]byte); ok {
+			ints := make([]int, len(blob)) // Not base64, to mirror decoding
+			for j, c := range blob {
+				ints[j] = int(c)
+			}
+			arg = ints
+		}
+		args[i] = arg
+	}
+	return json.Marshal(jsonMessage{Address: msg.Address, Args: args})
+}
+
+func decodeJSONMessage(data []byte) (*osc.Message, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var m jsonMessage
+	if err := dec.Decode(&m); err != nil {
+		return nil, err
+	}
+	if len(m.Address) == 0 || m.Address[0] != '/' {
+		return nil, fmt.Errorf("invalid OSC address %q", m.Address)
+	}
+
+	msg := osc.NewMessage(m.Address)
+	for i, arg := range m.Args {
+		switch v := arg.(type) {
+		case json.Number:
+			if n, err := v.Int64(); err == nil && n >= math.MinInt32 && n <= math.MaxInt32 {
+				msg.Append(int32(n))
+			} else if f, err := v.Float64(); err == nil {
+				msg.Append(float32(f))
+			} else {
+				return nil, fmt.Errorf("argument %d: invalid number %s", i, v)
+			}
+		case string, bool, nil:
+			msg.Append(v)
+		case []interface{}:
+			blob := make([]byte, len(v))
+			for j, c := range v {
+				n, ok := c.(json.Number)
+				b, err := n.Int64()
+				if !ok || err != nil || b < 0 || b > 255 {
+					return nil, fmt.Errorf("argument %d: blob byte %d must be 0-255", i, j)
+				}
+				blob[j] = byte(b)
+			}
+			msg.Append(blob)
+		default:
+			return nil, fmt.Errorf("argument %d: unsupported JSON type %T", i, v)
+		}
+	}
+	return msg, nil
+}
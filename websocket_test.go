@@ -0,0 +1,195 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/hypebeast/go-osc/osc"
+)
+
+func TestDecodeJSONMessage(t *testing.T) {
+	tests := []struct {
+		json    string
+		want    []interface{}
+		wantErr bool
+	}{
+		{`{"address": "/midi/0/note_on", "args": [60, 100]}`, []interface{}{int32(60), int32(100)}, false},
+		{`{"address": "/midi/0/pitch_bend", "args": [-0.5]}`, []interface{}{float32(-0.5)}, false},
+		{`{"address": "/a", "args": ["x", true, null]}`, []interface{}{"x", true, nil}, false},
+		{`{"address": "/midi/sysex", "args": [[240, 67, 247]]}`, []interface{}{[]byte{0xF0, 0x43, 0xF7}}, false},
+		{`{"address": "/a", "args": [3000000000]}`, []interface{}{float32(3e9)}, false},
+		{`{"address": "/a"}`, nil, false},
+		{`{"address": "a", "args": []}`, nil, true},
+		{`{"address": "/a", "args": [[256]]}`, nil, true},
+		{`{"address": "/a", "args": [{"x": 1}]}`, nil, true},
+		{`[]`, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.json, func(t *testing.T) {
+			msg, err := decodeJSONMessage([]byte(tt.json))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeJSONMessage() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && len(msg.Arguments)+len(tt.want) > 0 && !reflect.DeepEqual(msg.Arguments, tt.want) {
+				t.Errorf("Expected %#v, got %#v", tt.want, msg.Arguments)
+			}
+		})
+	}
+}
+
+func TestEncodeJSONMessage(t *testing.T) {
+	data, err := encodeJSONMessage(osc.NewMessage("/midi/sysex", []byte{0xF0, 0x7E, 0xF7}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if want := `{"address":"/midi/sysex","args":[[240,126,247]]}`; string(data) != want {
+		t.Errorf("Expected %s, got %s", want, data)
+	}
+
+	// Round trip
+	msg, err := decodeJSONMessage(data)
+	if err != nil || !reflect.DeepEqual(msg.Arguments, []interface{}{[]byte{0xF0, 0x7E, 0xF7}}) {
+		t.Errorf("Round trip failed: %v, %v", msg, err)
+	}
+}
+
+func TestBridgeWebSocket(t *testing.T) {
+	bridge, backend, _ := newTestBridge(t, Config{PitchBendFormat: pitchBendSigned})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Cannot listen: %v", err)
+	}
+	go bridge.serveWebSocket(ln)
+
+	dial := func(query string) *websocket.Conn {
+		conn, _, err := websocket.DefaultDialer.Dial("ws://"+ln.Addr().String()+"/"+query, nil)
+		if err != nil {
+			t.Fatalf("Cannot connect: %v", err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		return conn
+	}
+	binaryConn, jsonConn := dial(""), dial("?format=json")
+
+	// Binary OSC and JSON both reach the handlers
+	data, _ := osc.NewMessage("/midi/0/note_on", int32(60), int32(100)).MarshalBinary()
+	if err := binaryConn.WriteMessage(websocket.BinaryMessage, data); err != nil {
+		t.Fatalf("Cannot send: %v", err)
+	}
+	if err := jsonConn.WriteMessage(websocket.TextMessage, []byte(`{"address": "/midi/0/cc", "args": [7, 90]}`)); err != nil {
+		t.Fatalf("Cannot send: %v", err)
+	}
+
+	out := backend.port("midi_out")
+	var written [][]byte
+	for deadline := time.Now().Add(2 * time.Second); len(written) < 2 && time.Now().Before(deadline); {
+		backend.cycle(64)
+		for _, event := range out.written {
+			written = append(written, event.Buffer)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if len(written) != 2 {
+		t.Fatalf("Expected 2 MIDI events, got % X", written)
+	}
+
+	// MIDI input is broadcast to every socket in its format
+	backend.port("midi_in").send(0, 0x90, 67, 90)
+	backend.cycle(64)
+
+	binaryConn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	kind, data, err := binaryConn.ReadMessage()
+	if err != nil || kind != websocket.BinaryMessage {
+		t.Fatalf("Expected a binary message, got %d, %v", kind, err)
+	}
+	packet, err := osc.ParsePacket(string(data))
+	if msg, ok := packet.(*osc.Message); err != nil || !ok || msg.Address != "/midi/0/note_on" {
+		t.Errorf("Expected /midi/0/note_on, got %v (%v)", packet, err)
+	}
+
+	jsonConn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	kind, data, err = jsonConn.ReadMessage()
+	if err != nil || kind != websocket.TextMessage {
+		t.Fatalf("Expected a text message, got %d, %v", kind, err)
+	}
+	if want := `{"address":"/midi/0/note_on","args":[67,90]}`; string(data) != want {
+		t.Errorf("Expected %s, got %s", want, data)
+	}
+}
+
+func TestParseWSOrigins(t *testing.T) {
+	tests := []struct {
+		list    string
+		want    []string
+		wantErr bool
+	}{
+		{"", nil, false},
+		{"http://localhost:3000", []string{"http://localhost:3000"}, false},
+		{"HTTPS://Panel.Example.com/, *", []string{"https://panel.example.com", "*"}, false},
+		{"localhost:3000", nil, true},
+		{"http://localhost/panel", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.list, func(t *testing.T) {
+			origins, err := parseWSOrigins(tt.list)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseWSOrigins() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && len(origins) != len(tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, origins)
+			}
+			for _, origin := range tt.want {
+				if !origins[origin] {
+					t.Errorf("Expected %s to be allowed, got %v", origin, origins)
+				}
+			}
+		})
+	}
+}
+
+func TestBridgeWebSocketOrigin(t *testing.T) {
+	tests := []struct {
+		allowed string
+		origin  string
+		want    bool
+	}{
+		{"", "", true}, // Not a browser
+		{"", "http://{host}", true},
+		{"", "http://evil.example.com", false},
+		{"", "http://localhost:3000", false},
+		{"http://localhost:3000", "http://localhost:3000", true},
+		{"http://localhost:3000", "http://evil.example.com", false},
+		{"*", "http://evil.example.com", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.allowed+" "+tt.origin, func(t *testing.T) {
+			bridge, _, _ := newTestBridge(t, Config{PitchBendFormat: pitchBendSigned, WSOrigin: tt.allowed})
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("Cannot listen: %v", err)
+			}
+			go bridge.serveWebSocket(ln)
+
+			header := http.Header{}
+			if tt.origin != "" {
+				header.Set("Origin", strings.Replace(tt.origin, "{host}", ln.Addr().String(), 1))
+			}
+			conn, _, err := websocket.DefaultDialer.Dial("ws://"+ln.Addr().String()+"/", header)
+			if err == nil {
+				conn.Close()
+			}
+			if got := err == nil; got != tt.want {
+				t.Errorf("Expected connection %t, got %t (%v)", tt.want, got, err)
+			}
+		})
+	}
+}